@@ -0,0 +1,70 @@
+// Package armazenamento guarda os arquivos enviados à API (como as imagens
+// dos produtos) em um backend configurável: o sistema de arquivos local ou
+// um serviço compatível com S3
+package armazenamento
+
+import (
+    "context"
+    "errors"
+    "estoque-api/config"
+    "fmt"
+    "os"
+    "time"
+)
+
+// ErrNaoEncontrado indica que não existe arquivo com a chave informada
+var ErrNaoEncontrado = errors.New("arquivo não encontrado")
+
+// Objeto descreve um arquivo guardado
+type Objeto struct {
+    Chave      string
+    Tamanho    int64
+    Modificado time.Time
+}
+
+// Armazenamento é um backend de arquivos. As chaves são caminhos relativos
+// separados por "/" (por exemplo produtos/<id>/<imagem>.jpg).
+type Armazenamento interface {
+    // Gravar cria ou substitui o arquivo
+    Gravar(ctx context.Context, chave string, dados []byte, tipoConteudo string) error
+    // Ler retorna o conteúdo do arquivo ou ErrNaoEncontrado
+    Ler(ctx context.Context, chave string) ([]byte, error)
+    // Consultar retorna os dados do arquivo ou ErrNaoEncontrado
+    Consultar(ctx context.Context, chave string) (Objeto, error)
+    // Remover apaga o arquivo; remover um arquivo inexistente não é erro
+    Remover(ctx context.Context, chave string) error
+    // Listar chama fn para cada arquivo cuja chave comece com prefixo
+    Listar(ctx context.Context, prefixo string, fn func(Objeto) error) error
+    // URL retorna um endereço de download assinado, válido pelo prazo informado
+    URL(chave string, validade time.Duration) string
+}
+
+// ValidadeURL é o prazo das URLs de download assinadas
+func ValidadeURL() time.Duration {
+    return config.GetDuration("ARMAZENAMENTO_VALIDADE_URL", time.Hour)
+}
+
+// Novo cria o backend do tipo informado (local ou s3) a partir das
+// variáveis de ambiente:
+//   - local: UPLOAD_DIR (padrão uploads) e ARMAZENAMENTO_SEGREDO, a chave das
+//     assinaturas das URLs (padrão JWT_SECRET; vazia, as URLs não são assinadas)
+//   - s3: S3_ENDPOINT, S3_REGIAO (padrão us-east-1), S3_BUCKET, S3_ACCESS_KEY,
+//     S3_SECRET_KEY e S3_PATH_STYLE (padrão true, como no MinIO)
+func Novo(tipo string) (Armazenamento, error) {
+    switch tipo {
+    case "local":
+        segredo := config.Get("ARMAZENAMENTO_SEGREDO", os.Getenv("JWT_SECRET"))
+        return NovoLocal(config.Get("UPLOAD_DIR", "uploads"), "/uploads/", []byte(segredo)), nil
+    case "s3":
+        return NovoS3(
+            config.Get("S3_ENDPOINT", ""),
+            config.Get("S3_REGIAO", "us-east-1"),
+            config.Get("S3_BUCKET", ""),
+            config.Get("S3_ACCESS_KEY", ""),
+            config.Get("S3_SECRET_KEY", ""),
+            config.Get("S3_PATH_STYLE", "true") == "true",
+        )
+    default:
+        return nil, fmt.Errorf("armazenamento %q desconhecido, use local ou s3", tipo)
+    }
+}
@@ -0,0 +1,143 @@
+package armazenamento
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "io/fs"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Local guarda os arquivos em um diretório. As URLs apontam para a rota da
+// API que serve o diretório (Prefixo) e, com Segredo, levam a data de
+// expiração e uma assinatura HMAC conferida por Verificar.
+type Local struct {
+    Diretorio string
+    Prefixo   string
+    Segredo   []byte
+}
+
+// NovoLocal cria o armazenamento no diretório informado
+func NovoLocal(diretorio, prefixo string, segredo []byte) *Local {
+    return &Local{Diretorio: diretorio, Prefixo: prefixo, Segredo: segredo}
+}
+
+// Caminho retorna o caminho do arquivo no disco. A chave é normalizada para
+// que não seja possível sair do diretório com "..".
+func (l *Local) Caminho(chave string) string {
+    return filepath.Join(l.Diretorio, filepath.FromSlash(path.Clean("/"+chave)))
+}
+
+// Gravar escreve em um temporário renomeado ao final, para que o arquivo
+// nunca seja servido pela metade
+func (l *Local) Gravar(ctx context.Context, chave string, dados []byte, tipoConteudo string) error {
+    caminho := l.Caminho(chave)
+    if err := os.MkdirAll(filepath.Dir(caminho), 0755); err != nil {
+        return err
+    }
+    temporario := caminho + ".tmp"
+    if err := os.WriteFile(temporario, dados, 0644); err != nil {
+        return err
+    }
+    return os.Rename(temporario, caminho)
+}
+
+func (l *Local) Ler(ctx context.Context, chave string) ([]byte, error) {
+    dados, err := os.ReadFile(l.Caminho(chave))
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, ErrNaoEncontrado
+    }
+    return dados, err
+}
+
+func (l *Local) Consultar(ctx context.Context, chave string) (Objeto, error) {
+    info, err := os.Stat(l.Caminho(chave))
+    if errors.Is(err, fs.ErrNotExist) || err == nil && info.IsDir() {
+        return Objeto{}, ErrNaoEncontrado
+    }
+    if err != nil {
+        return Objeto{}, err
+    }
+    return Objeto{Chave: chave, Tamanho: info.Size(), Modificado: info.ModTime()}, nil
+}
+
+func (l *Local) Remover(ctx context.Context, chave string) error {
+    err := os.Remove(l.Caminho(chave))
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil
+    }
+    return err
+}
+
+// Listar percorre o diretório; um diretório ainda inexistente não tem arquivos
+func (l *Local) Listar(ctx context.Context, prefixo string, fn func(Objeto) error) error {
+    err := filepath.WalkDir(l.Diretorio, func(caminho string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        if d.IsDir() {
+            return nil
+        }
+
+        relativo, err := filepath.Rel(l.Diretorio, caminho)
+        if err != nil {
+            return err
+        }
+        chave := filepath.ToSlash(relativo)
+        if !strings.HasPrefix(chave, prefixo) {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil {
+            return err
+        }
+        return fn(Objeto{Chave: chave, Tamanho: info.Size(), Modificado: info.ModTime()})
+    })
+    if errors.Is(err, fs.ErrNotExist) {
+        if _, errDir := os.Stat(l.Diretorio); errors.Is(errDir, fs.ErrNotExist) {
+            return nil
+        }
+    }
+    return err
+}
+
+// URL monta o endereço na rota que serve o diretório. Sem segredo
+// configurado, a URL não expira.
+func (l *Local) URL(chave string, validade time.Duration) string {
+    endereco := l.Prefixo + (&url.URL{Path: chave}).EscapedPath()
+    if len(l.Segredo) == 0 {
+        return endereco
+    }
+    expira := strconv.FormatInt(time.Now().Add(validade).Unix(), 10)
+    return endereco + "?expira=" + expira + "&assinatura=" + l.assinar(chave, expira)
+}
+
+// Verificar confere a assinatura e a validade de uma URL gerada por URL.
+// Sem segredo configurado, todas as URLs são aceitas.
+func (l *Local) Verificar(chave, expira, assinatura string) bool {
+    if len(l.Segredo) == 0 {
+        return true
+    }
+    limite, err := strconv.ParseInt(expira, 10, 64)
+    if err != nil || time.Now().Unix() > limite {
+        return false
+    }
+    return hmac.Equal([]byte(assinatura), []byte(l.assinar(chave, expira)))
+}
+
+func (l *Local) assinar(chave, expira string) string {
+    mac := hmac.New(sha256.New, l.Segredo)
+    mac.Write([]byte(chave + "\n" + expira))
+    return hex.EncodeToString(mac.Sum(nil))
+}
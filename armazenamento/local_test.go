@@ -0,0 +1,139 @@
+package armazenamento
+
+import (
+    "context"
+    "net/url"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// parametrosURL separa a chave e os parâmetros de uma URL gerada por Local.URL,
+// como a rota que serve o diretório os recebe
+func parametrosURL(t *testing.T, l *Local, endereco string) (chave, expira, assinatura string) {
+    t.Helper()
+    u, err := url.Parse(endereco)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasPrefix(u.Path, l.Prefixo) {
+        t.Fatalf("URL %s fora do prefixo %s", endereco, l.Prefixo)
+    }
+    return strings.TrimPrefix(u.Path, l.Prefixo), u.Query().Get("expira"), u.Query().Get("assinatura")
+}
+
+func TestLocalURLAssinada(t *testing.T) {
+    l := NovoLocal(t.TempDir(), "/uploads/", []byte("segredo"))
+    const chave = "produtos/abc/imagem com espaço.jpg"
+
+    endereco := l.URL(chave, time.Hour)
+    if !strings.HasPrefix(endereco, "/uploads/produtos/abc/imagem%20com%20espa%C3%A7o.jpg?expira=") {
+        t.Fatalf("URL = %s", endereco)
+    }
+    lida, expira, assinatura := parametrosURL(t, l, endereco)
+    if lida != chave {
+        t.Fatalf("chave = %q, esperado %q", lida, chave)
+    }
+    if !l.Verificar(lida, expira, assinatura) {
+        t.Fatal("URL recém-gerada recusada")
+    }
+
+    outroSegredo := NovoLocal(l.Diretorio, l.Prefixo, []byte("outro"))
+    casos := []struct {
+        nome                      string
+        local                     *Local
+        chave, expira, assinatura string
+    }{
+        {"outra chave", l, "produtos/abc/outra.jpg", expira, assinatura},
+        {"validade estendida", l, lida, expira + "0", assinatura},
+        {"assinatura alterada", l, lida, expira, strings.Repeat("0", len(assinatura))},
+        {"sem assinatura", l, lida, expira, ""},
+        {"validade inválida", l, lida, "amanhã", assinatura},
+        {"outro segredo", outroSegredo, lida, expira, assinatura},
+    }
+    for _, caso := range casos {
+        if caso.local.Verificar(caso.chave, caso.expira, caso.assinatura) {
+            t.Errorf("%s: URL aceita", caso.nome)
+        }
+    }
+}
+
+func TestLocalURLExpirada(t *testing.T) {
+    l := NovoLocal(t.TempDir(), "/uploads/", []byte("segredo"))
+    chave, expira, assinatura := parametrosURL(t, l, l.URL("a.jpg", -time.Minute))
+    if l.Verificar(chave, expira, assinatura) {
+        t.Error("URL expirada aceita")
+    }
+}
+
+func TestLocalURLSemSegredo(t *testing.T) {
+    l := NovoLocal(t.TempDir(), "/uploads/", nil)
+    if endereco := l.URL("produtos/a.jpg", time.Hour); endereco != "/uploads/produtos/a.jpg" {
+        t.Errorf("URL = %s", endereco)
+    }
+    if !l.Verificar("produtos/a.jpg", "", "") {
+        t.Error("sem segredo todas as URLs são aceitas")
+    }
+}
+
+func TestLocalCaminhoNaoSaiDoDiretorio(t *testing.T) {
+    l := NovoLocal(filepath.Join("dados", "uploads"), "/uploads/", nil)
+    for _, chave := range []string{"../../etc/passwd", "/../segredo", "a/../../b"} {
+        caminho := l.Caminho(chave)
+        if !strings.HasPrefix(caminho, l.Diretorio+string(filepath.Separator)) {
+            t.Errorf("Caminho(%q) = %s, fora de %s", chave, caminho, l.Diretorio)
+        }
+    }
+}
+
+func TestLocalGravarLerListarRemover(t *testing.T) {
+    ctx := context.Background()
+    l := NovoLocal(filepath.Join(t.TempDir(), "ainda-nao-existe"), "/uploads/", nil)
+
+    var chaves []string
+    listar := func(prefixo string) {
+        chaves = nil
+        if err := l.Listar(ctx, prefixo, func(o Objeto) error {
+            chaves = append(chaves, o.Chave)
+            return nil
+        }); err != nil {
+            t.Fatal(err)
+        }
+    }
+    listar("")
+    if len(chaves) != 0 {
+        t.Fatalf("diretório inexistente listou %v", chaves)
+    }
+
+    for _, chave := range []string{"produtos/1/a.jpg", "produtos/2/b.jpg", "outros/c.txt"} {
+        if err := l.Gravar(ctx, chave, []byte(chave), "text/plain"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    dados, err := l.Ler(ctx, "produtos/1/a.jpg")
+    if err != nil || string(dados) != "produtos/1/a.jpg" {
+        t.Errorf("Ler = %q, %v", dados, err)
+    }
+    if obj, err := l.Consultar(ctx, "outros/c.txt"); err != nil || obj.Tamanho != int64(len("outros/c.txt")) {
+        t.Errorf("Consultar = %+v, %v", obj, err)
+    }
+
+    listar("produtos/")
+    if strings.Join(chaves, ",") != "produtos/1/a.jpg,produtos/2/b.jpg" {
+        t.Errorf("Listar(produtos/) = %v", chaves)
+    }
+
+    if err := l.Remover(ctx, "produtos/1/a.jpg"); err != nil {
+        t.Fatal(err)
+    }
+    if err := l.Remover(ctx, "produtos/1/a.jpg"); err != nil {
+        t.Errorf("remover de novo: %v", err)
+    }
+    if _, err := l.Ler(ctx, "produtos/1/a.jpg"); err != ErrNaoEncontrado {
+        t.Errorf("Ler removido: %v", err)
+    }
+    if _, err := l.Consultar(ctx, "produtos"); err != ErrNaoEncontrado {
+        t.Errorf("Consultar diretório: %v", err)
+    }
+}
@@ -0,0 +1,327 @@
+package armazenamento
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Hash SHA-256 do corpo vazio, usado nas requisições sem conteúdo
+const hashVazio = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 guarda os arquivos em um bucket de um serviço compatível com S3 (AWS,
+// MinIO e similares). As requisições são assinadas com AWS Signature V4 e as
+// URLs de download são URLs pré-assinadas do próprio serviço.
+type S3 struct {
+    Endpoint      *url.URL
+    Regiao        string
+    Bucket        string
+    ChaveAcesso   string
+    ChaveSecreta  string
+    EstiloCaminho bool // endpoint/bucket/chave em vez de bucket.endpoint/chave
+    cliente       *http.Client
+}
+
+// NovoS3 cria o armazenamento no bucket informado
+func NovoS3(endpoint, regiao, bucket, chaveAcesso, chaveSecreta string, estiloCaminho bool) (*S3, error) {
+    if endpoint == "" || bucket == "" || chaveAcesso == "" || chaveSecreta == "" {
+        return nil, errors.New("s3: informe S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY e S3_SECRET_KEY")
+    }
+    u, err := url.Parse(endpoint)
+    if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+        return nil, fmt.Errorf("s3: endpoint inválido %q", endpoint)
+    }
+    return &S3{
+        Endpoint:      u,
+        Regiao:        regiao,
+        Bucket:        bucket,
+        ChaveAcesso:   chaveAcesso,
+        ChaveSecreta:  chaveSecreta,
+        EstiloCaminho: estiloCaminho,
+        cliente:       &http.Client{Timeout: 60 * time.Second},
+    }, nil
+}
+
+// urlObjeto monta a URL do objeto (ou, com chave vazia, do bucket)
+func (s *S3) urlObjeto(chave string) *url.URL {
+    u := &url.URL{Scheme: s.Endpoint.Scheme, Host: s.Endpoint.Host}
+    if s.EstiloCaminho {
+        u.Path = "/" + s.Bucket + "/" + chave
+    } else {
+        u.Host = s.Bucket + "." + u.Host
+        u.Path = "/" + chave
+    }
+    u.RawPath = codificar(u.Path, false)
+    return u
+}
+
+func (s *S3) Gravar(ctx context.Context, chave string, dados []byte, tipoConteudo string) error {
+    cabecalhos := http.Header{}
+    if tipoConteudo != "" {
+        cabecalhos.Set("Content-Type", tipoConteudo)
+    }
+    resp, err := s.executar(ctx, http.MethodPut, s.urlObjeto(chave), dados, cabecalhos)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+func (s *S3) Ler(ctx context.Context, chave string) ([]byte, error) {
+    resp, err := s.executar(ctx, http.MethodGet, s.urlObjeto(chave), nil, nil)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    return io.ReadAll(resp.Body)
+}
+
+func (s *S3) Consultar(ctx context.Context, chave string) (Objeto, error) {
+    resp, err := s.executar(ctx, http.MethodHead, s.urlObjeto(chave), nil, nil)
+    if err != nil {
+        return Objeto{}, err
+    }
+    resp.Body.Close()
+    modificado, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+    return Objeto{Chave: chave, Tamanho: resp.ContentLength, Modificado: modificado}, nil
+}
+
+func (s *S3) Remover(ctx context.Context, chave string) error {
+    resp, err := s.executar(ctx, http.MethodDelete, s.urlObjeto(chave), nil, nil)
+    if err == ErrNaoEncontrado {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+// Listar usa a ListObjectsV2, seguindo as páginas pelo continuation-token
+func (s *S3) Listar(ctx context.Context, prefixo string, fn func(Objeto) error) error {
+    token := ""
+    for {
+        u := s.urlObjeto("")
+        consulta := url.Values{"list-type": {"2"}, "prefix": {prefixo}}
+        if token != "" {
+            consulta.Set("continuation-token", token)
+        }
+        u.RawQuery = consultaCanonica(consulta)
+
+        resp, err := s.executar(ctx, http.MethodGet, u, nil, nil)
+        if err != nil {
+            return err
+        }
+        var resultado struct {
+            Contents []struct {
+                Key          string    `xml:"Key"`
+                Size         int64     `xml:"Size"`
+                LastModified time.Time `xml:"LastModified"`
+            } `xml:"Contents"`
+            IsTruncated           bool   `xml:"IsTruncated"`
+            NextContinuationToken string `xml:"NextContinuationToken"`
+        }
+        err = xml.NewDecoder(resp.Body).Decode(&resultado)
+        resp.Body.Close()
+        if err != nil {
+            return fmt.Errorf("s3: resposta inválida da listagem: %v", err)
+        }
+
+        for _, obj := range resultado.Contents {
+            if err := fn(Objeto{Chave: obj.Key, Tamanho: obj.Size, Modificado: obj.LastModified}); err != nil {
+                return err
+            }
+        }
+        if !resultado.IsTruncated || resultado.NextContinuationToken == "" {
+            return nil
+        }
+        token = resultado.NextContinuationToken
+    }
+}
+
+// URL gera uma URL pré-assinada de download (GET), aceita pelo serviço até
+// o fim da validade (no máximo 7 dias)
+func (s *S3) URL(chave string, validade time.Duration) string {
+    return s.urlAssinada(chave, validade, time.Now().UTC())
+}
+
+func (s *S3) urlAssinada(chave string, validade time.Duration, agora time.Time) string {
+    if validade > 7*24*time.Hour {
+        validade = 7 * 24 * time.Hour
+    }
+    data, escopo := s.escopo(agora)
+
+    u := s.urlObjeto(chave)
+    consulta := url.Values{
+        "X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+        "X-Amz-Credential":    {s.ChaveAcesso + "/" + escopo},
+        "X-Amz-Date":          {data},
+        "X-Amz-Expires":       {strconv.Itoa(int(validade.Seconds()))},
+        "X-Amz-SignedHeaders": {"host"},
+    }
+    u.RawQuery = consultaCanonica(consulta)
+    u.RawQuery += "&X-Amz-Signature=" + s.assinatura(agora, escopo, requisicaoCanonicaURL(u))
+    return u.String()
+}
+
+// requisicaoCanonicaURL monta a requisição canônica de uma URL pré-assinada,
+// que assina só o host e não o conteúdo
+func requisicaoCanonicaURL(u *url.URL) string {
+    return strings.Join([]string{
+        http.MethodGet,
+        u.EscapedPath(),
+        u.RawQuery,
+        "host:" + u.Host + "\n",
+        "host",
+        "UNSIGNED-PAYLOAD",
+    }, "\n")
+}
+
+// executar envia a requisição assinada. Respostas 404 viram
+// ErrNaoEncontrado e as demais falhas trazem o corpo do erro do serviço.
+func (s *S3) executar(ctx context.Context, metodo string, u *url.URL, corpo []byte, cabecalhos http.Header) (*http.Response, error) {
+    req, err := http.NewRequestWithContext(ctx, metodo, u.String(), bytes.NewReader(corpo))
+    if err != nil {
+        return nil, err
+    }
+    for nome, valores := range cabecalhos {
+        req.Header[nome] = valores
+    }
+    req.ContentLength = int64(len(corpo))
+    if len(corpo) == 0 {
+        req.Body = http.NoBody
+    }
+    s.assinar(req, corpo)
+
+    resp, err := s.cliente.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode == http.StatusNotFound {
+        resp.Body.Close()
+        return nil, ErrNaoEncontrado
+    }
+    if resp.StatusCode >= 300 {
+        detalhe, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        resp.Body.Close()
+        return nil, fmt.Errorf("s3: %s %s: %s %s", metodo, u.Path, resp.Status, strings.TrimSpace(string(detalhe)))
+    }
+    return resp, nil
+}
+
+// assinar acrescenta os cabeçalhos x-amz-* e Authorization da Signature V4
+func (s *S3) assinar(req *http.Request, corpo []byte) {
+    s.assinarEm(req, corpo, time.Now().UTC())
+}
+
+func (s *S3) assinarEm(req *http.Request, corpo []byte, agora time.Time) {
+    data, escopo := s.escopo(agora)
+
+    hashCorpo := hashVazio
+    if len(corpo) > 0 {
+        soma := sha256.Sum256(corpo)
+        hashCorpo = hex.EncodeToString(soma[:])
+    }
+    req.Header.Set("X-Amz-Date", data)
+    req.Header.Set("X-Amz-Content-Sha256", hashCorpo)
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        s.ChaveAcesso, escopo, cabecalhosAssinados, s.assinatura(agora, escopo, requisicaoCanonica(req, hashCorpo, data))))
+}
+
+// Cabeçalhos incluídos na assinatura das requisições
+const cabecalhosAssinados = "host;x-amz-content-sha256;x-amz-date"
+
+// requisicaoCanonica monta a requisição canônica da Signature V4 com os
+// cabeçalhos de cabecalhosAssinados
+func requisicaoCanonica(req *http.Request, hashCorpo, data string) string {
+    return strings.Join([]string{
+        req.Method,
+        req.URL.EscapedPath(),
+        consultaCanonica(req.URL.Query()),
+        "host:" + req.URL.Host + "\n" +
+            "x-amz-content-sha256:" + hashCorpo + "\n" +
+            "x-amz-date:" + data + "\n",
+        cabecalhosAssinados,
+        hashCorpo,
+    }, "\n")
+}
+
+// escopo retorna a data no formato da assinatura e o escopo da credencial
+func (s *S3) escopo(agora time.Time) (string, string) {
+    return agora.Format("20060102T150405Z"), agora.Format("20060102") + "/" + s.Regiao + "/s3/aws4_request"
+}
+
+// assinatura calcula a assinatura da requisição canônica com a chave
+// derivada da chave secreta, da data, da região e do serviço
+func (s *S3) assinatura(agora time.Time, escopo, requisicao string) string {
+    texto := textoAssinatura(agora, escopo, requisicao)
+
+    chave := hmacSHA256([]byte("AWS4"+s.ChaveSecreta), agora.Format("20060102"))
+    chave = hmacSHA256(chave, s.Regiao)
+    chave = hmacSHA256(chave, "s3")
+    chave = hmacSHA256(chave, "aws4_request")
+    return hex.EncodeToString(hmacSHA256(chave, texto))
+}
+
+// textoAssinatura monta o texto assinado (string to sign) a partir do hash
+// da requisição canônica
+func textoAssinatura(agora time.Time, escopo, requisicao string) string {
+    soma := sha256.Sum256([]byte(requisicao))
+    return "AWS4-HMAC-SHA256\n" + agora.Format("20060102T150405Z") + "\n" + escopo + "\n" + hex.EncodeToString(soma[:])
+}
+
+func hmacSHA256(chave []byte, texto string) []byte {
+    mac := hmac.New(sha256.New, chave)
+    mac.Write([]byte(texto))
+    return mac.Sum(nil)
+}
+
+// consultaCanonica ordena e codifica os parâmetros como exige a assinatura
+func consultaCanonica(consulta url.Values) string {
+    chaves := make([]string, 0, len(consulta))
+    for chave := range consulta {
+        chaves = append(chaves, chave)
+    }
+    sort.Strings(chaves)
+
+    var partes []string
+    for _, chave := range chaves {
+        valores := append([]string{}, consulta[chave]...)
+        sort.Strings(valores)
+        for _, v := range valores {
+            partes = append(partes, codificar(chave, true)+"="+codificar(v, true))
+        }
+    }
+    return strings.Join(partes, "&")
+}
+
+// codificar aplica a codificação de URL da AWS: apenas letras, dígitos e
+// "-_.~" ficam como estão (e "/", nos caminhos)
+func codificar(s string, codificarBarra bool) string {
+    var b strings.Builder
+    for _, c := range []byte(s) {
+        switch {
+        case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+            c == '-', c == '_', c == '.', c == '~', c == '/' && !codificarBarra:
+            b.WriteByte(c)
+        default:
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "strings"
+)
+
+// Prefixo que identifica as chaves de API no cabeçalho e em varreduras de
+// segredos vazados
+const prefixoChaveAPI = "ek_"
+
+// EscoposChaveAPI são as permissões que uma chave de API pode receber. O
+// perfil do dono da chave continua valendo: uma chave com estoque:escrever
+// de um usuário comum não movimenta estoque.
+var EscoposChaveAPI = map[string]string{
+    "produtos:ler":     "Consultar produtos, categorias e movimentações",
+    "estoque:escrever": "Movimentar o estoque de produtos, variantes e kits",
+    "relatorios:ler":   "Consultar relatórios",
+}
+
+// GerarChaveAPI gera uma chave no formato ek_<prefixo>_<segredo>. O prefixo
+// é guardado para identificar a chave nas listagens e a chave completa
+// apenas pelo hash.
+func GerarChaveAPI() (chave, prefixo, hash string, err error) {
+    b := make([]byte, 4)
+    if _, err := rand.Read(b); err != nil {
+        return "", "", "", err
+    }
+    prefixo = hex.EncodeToString(b)
+
+    segredo, _, err := GenerateOpaqueToken()
+    if err != nil {
+        return "", "", "", err
+    }
+    chave = prefixoChaveAPI + prefixo + "_" + segredo
+    return chave, prefixo, HashOpaqueToken(chave), nil
+}
+
+// PareceChaveAPI informa se o valor tem o formato de uma chave de API
+func PareceChaveAPI(valor string) bool {
+    return strings.HasPrefix(valor, prefixoChaveAPI)
+}
@@ -2,9 +2,11 @@ package auth
 
 import (
 	"errors"
+	"estoque-api/config"
 	"time"
 	"os"
 	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var jwtKey = []byte(os.Getenv("JWT_SECRET"))
@@ -15,18 +17,29 @@ type Claims struct {
 	jwt.StandardClaims
 }
 
-func GenerateToken(userID, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// ValidadeTokenAcesso é o prazo dos tokens de acesso. Eles são curtos porque
+// a sessão é mantida pelos refresh tokens.
+func ValidadeTokenAcesso() time.Duration {
+	return config.GetDuration("TOKEN_ACESSO_VALIDADE", 15*time.Minute)
+}
+
+// GenerateToken gera um token de acesso com um identificador único (jti),
+// usado para revogá-lo antes de expirar. Retorna também as claims geradas.
+func GenerateToken(userID, role string) (string, *Claims, error) {
+	agora := time.Now()
 	claims := &Claims{
 		UserID: userID,
 		Role:   role,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			Id:        primitive.NewObjectID().Hex(),
+			IssuedAt:  agora.Unix(),
+			ExpiresAt: agora.Add(ValidadeTokenAcesso()).Unix(),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	assinado, err := token.SignedString(jwtKey)
+	return assinado, claims, err
 }
 
 func ValidateToken(tokenStr string) (*Claims, error) {
@@ -43,5 +56,10 @@ func ValidateToken(tokenStr string) (*Claims, error) {
 		return nil, errors.New("token inválido")
 	}
 
+	// Tokens sem jti são do formato antigo e não podem ser revogados
+	if claims.Id == "" {
+		return nil, errors.New("token inválido")
+	}
+
 	return claims, nil
 } 
\ No newline at end of file
@@ -0,0 +1,51 @@
+package auth
+
+import (
+    "context"
+    "estoque-api/database"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Lista de tokens de acesso revogados antes de expirar, pelo jti. Cada
+// registro é apagado pelo índice TTL assim que o token expiraria, então a
+// lista só guarda tokens que ainda seriam aceitos.
+func revogadosCollection() *mongo.Collection {
+    return database.DB.Collection("tokens_revogados")
+}
+
+// InicializarRevogacao cria o índice TTL da lista de tokens revogados
+func InicializarRevogacao() {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    revogadosCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys:    bson.D{{Key: "expira_em", Value: 1}},
+        Options: options.Index().SetExpireAfterSeconds(0),
+    })
+}
+
+// RevogarToken inclui o jti na lista de revogados até a expiração do token
+func RevogarToken(ctx context.Context, jti, userID string, expira time.Time) error {
+    if jti == "" || !expira.After(time.Now()) {
+        return nil
+    }
+    _, err := revogadosCollection().UpdateOne(ctx,
+        bson.M{"_id": jti},
+        bson.M{"$set": bson.M{"user_id": userID, "expira_em": expira, "data_revogacao": time.Now()}},
+        options.Update().SetUpsert(true),
+    )
+    return err
+}
+
+// TokenRevogado informa se o jti está na lista de revogados
+func TokenRevogado(ctx context.Context, jti string) (bool, error) {
+    err := revogadosCollection().FindOne(ctx, bson.M{"_id": jti}).Err()
+    if err == mongo.ErrNoDocuments {
+        return false, nil
+    }
+    return err == nil, err
+}
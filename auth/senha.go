@@ -0,0 +1,134 @@
+package auth
+
+import (
+    "bufio"
+    _ "embed"
+    "estoque-api/config"
+    "fmt"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+//go:embed senhas_comuns.txt
+var listaSenhasComuns string
+
+// Senhas comuns, carregadas da lista embutida no binário
+var senhasComuns = carregarSenhasComuns(listaSenhasComuns)
+
+func carregarSenhasComuns(lista string) map[string]bool {
+    senhas := map[string]bool{}
+    scanner := bufio.NewScanner(strings.NewReader(lista))
+    for scanner.Scan() {
+        linha := strings.TrimSpace(scanner.Text())
+        if linha != "" && !strings.HasPrefix(linha, "#") {
+            senhas[strings.ToLower(linha)] = true
+        }
+    }
+    return senhas
+}
+
+// PoliticaSenha são os requisitos das senhas novas
+type PoliticaSenha struct {
+    TamanhoMinimo  int  `json:"tamanho_minimo"`
+    ClassesMinimas int  `json:"classes_minimas"` // entre minúsculas, maiúsculas, dígitos e símbolos
+    RecusarComuns  bool `json:"recusar_comuns"`
+    RecusarDados   bool `json:"recusar_dados_pessoais"` // email e nome do usuário
+}
+
+// Politica lê a política das variáveis de ambiente SENHA_TAMANHO_MINIMO
+// (padrão 10), SENHA_CLASSES_MINIMAS (padrão 3), SENHA_RECUSAR_COMUNS e
+// SENHA_RECUSAR_DADOS_PESSOAIS (padrão true)
+func Politica() PoliticaSenha {
+    return PoliticaSenha{
+        TamanhoMinimo:  config.GetInt("SENHA_TAMANHO_MINIMO", 10),
+        ClassesMinimas: config.GetInt("SENHA_CLASSES_MINIMAS", 3),
+        RecusarComuns:  config.Get("SENHA_RECUSAR_COMUNS", "true") != "false",
+        RecusarDados:   config.Get("SENHA_RECUSAR_DADOS_PESSOAIS", "true") != "false",
+    }
+}
+
+// Validar confere a senha contra a política e retorna a lista de problemas,
+// vazia quando a senha é aceita. Email e nome são do dono da senha.
+func (p PoliticaSenha) Validar(senha, email, nome string) []string {
+    var problemas []string
+
+    if n := utf8.RuneCountInString(senha); n < p.TamanhoMinimo {
+        problemas = append(problemas, fmt.Sprintf("A senha deve ter pelo menos %d caracteres", p.TamanhoMinimo))
+    }
+
+    if classes := classesCaracteres(senha); classes < p.ClassesMinimas {
+        problemas = append(problemas, fmt.Sprintf(
+            "A senha deve combinar pelo menos %d destes tipos de caractere: letras minúsculas, letras maiúsculas, números e símbolos",
+            p.ClassesMinimas))
+    }
+
+    minuscula := strings.ToLower(senha)
+    if p.RecusarDados {
+        for _, dado := range dadosPessoais(email, nome) {
+            if strings.Contains(minuscula, dado) {
+                problemas = append(problemas, "A senha não pode conter o seu email ou nome")
+                break
+            }
+        }
+    }
+
+    if p.RecusarComuns {
+        base := strings.TrimRightFunc(minuscula, func(r rune) bool {
+            return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+        })
+        if senhasComuns[minuscula] || senhasComuns[base] {
+            problemas = append(problemas, "A senha é comum demais e fácil de adivinhar")
+        }
+    }
+
+    return problemas
+}
+
+// classesCaracteres conta quantos tipos de caractere a senha usa
+func classesCaracteres(senha string) int {
+    var minuscula, maiuscula, digito, simbolo bool
+    for _, r := range senha {
+        switch {
+        case unicode.IsLower(r):
+            minuscula = true
+        case unicode.IsUpper(r):
+            maiuscula = true
+        case unicode.IsDigit(r):
+            digito = true
+        default:
+            simbolo = true
+        }
+    }
+
+    n := 0
+    for _, presente := range []bool{minuscula, maiuscula, digito, simbolo} {
+        if presente {
+            n++
+        }
+    }
+    return n
+}
+
+// dadosPessoais extrai as partes do email e do nome que a senha não pode
+// conter. Partes muito curtas são ignoradas para não recusar senhas por
+// coincidência.
+func dadosPessoais(email, nome string) []string {
+    var dados []string
+    local := strings.ToLower(strings.TrimSpace(email))
+    if i := strings.Index(local, "@"); i >= 0 {
+        local = local[:i]
+    }
+    partes := strings.FieldsFunc(local, func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+    partes = append(partes, local)
+    partes = append(partes, strings.Fields(strings.ToLower(nome))...)
+
+    for _, parte := range partes {
+        if utf8.RuneCountInString(parte) >= 3 {
+            dados = append(dados, parte)
+        }
+    }
+    return dados
+}
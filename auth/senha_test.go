@@ -0,0 +1,126 @@
+package auth
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestPoliticaSenhaValidar(t *testing.T) {
+    padrao := PoliticaSenha{TamanhoMinimo: 10, ClassesMinimas: 3, RecusarComuns: true, RecusarDados: true}
+    const email, nome = "ana.silva@exemplo.com", "Ana Silva"
+
+    casos := []struct {
+        nome      string
+        politica  PoliticaSenha
+        senha     string
+        email     string
+        usuario   string
+        problemas []string // trechos esperados, um por problema
+    }{
+        {nome: "senha forte", politica: padrao, senha: "Correto-Cavalo-42", email: email, usuario: nome},
+        {nome: "curta", politica: padrao, senha: "Ab1!", email: email, usuario: nome,
+            problemas: []string{"pelo menos 10 caracteres"}},
+        {nome: "poucos tipos de caractere", politica: padrao, senha: "abcdefghijkl", email: email, usuario: nome,
+            problemas: []string{"pelo menos 3 destes tipos"}},
+        {nome: "comum", politica: padrao, senha: "Qwerty", email: email, usuario: nome,
+            problemas: []string{"10 caracteres", "3 destes tipos", "comum demais"}},
+        {nome: "comum seguida de símbolos e números", politica: padrao, senha: "Senha@2024", email: email, usuario: nome,
+            problemas: []string{"comum demais"}},
+        {nome: "comum com maiúsculas", politica: padrao, senha: "PASSWORD123!", email: email, usuario: nome,
+            problemas: []string{"comum demais"}},
+        {nome: "comum no meio não é recusada", politica: padrao, senha: "Minha-senha-7X", email: email, usuario: nome},
+        {nome: "contém parte do email", politica: padrao, senha: "Silva#Forte2024", email: email, usuario: "Maria",
+            problemas: []string{"email ou nome"}},
+        {nome: "contém o nome", politica: padrao, senha: "ANA-forte-2024", email: "maria@exemplo.com", usuario: nome,
+            problemas: []string{"email ou nome"}},
+        {nome: "partes curtas do nome são ignoradas", politica: padrao, senha: "Jo-Li-Brilhante9", email: "jo@exemplo.com", usuario: "Li"},
+        {nome: "tudo errado", politica: padrao, senha: "senha", email: email, usuario: nome,
+            problemas: []string{"10 caracteres", "3 destes tipos", "comum demais"}},
+        {nome: "tamanho conta caracteres, não bytes", politica: padrao, senha: "Ação-Úni9", email: email, usuario: nome,
+            problemas: []string{"10 caracteres"}},
+        {nome: "caracteres acentuados", politica: padrao, senha: "Ação-Única9", email: email, usuario: nome},
+        {nome: "política sem lista de comuns", politica: PoliticaSenha{TamanhoMinimo: 8, ClassesMinimas: 3, RecusarDados: true},
+            senha: "Senha@2024", email: email, usuario: nome},
+        {nome: "política sem dados pessoais", politica: PoliticaSenha{TamanhoMinimo: 8, ClassesMinimas: 3, RecusarComuns: true},
+            senha: "AnaSilva#2024", email: email, usuario: nome},
+    }
+
+    for _, caso := range casos {
+        t.Run(caso.nome, func(t *testing.T) {
+            problemas := caso.politica.Validar(caso.senha, caso.email, caso.usuario)
+            if len(problemas) != len(caso.problemas) {
+                t.Fatalf("problemas = %q, esperado %q", problemas, caso.problemas)
+            }
+            for i, trecho := range caso.problemas {
+                if !strings.Contains(problemas[i], trecho) {
+                    t.Errorf("problema %d = %q, esperado conter %q", i, problemas[i], trecho)
+                }
+            }
+        })
+    }
+}
+
+func TestPoliticaVariaveisAmbiente(t *testing.T) {
+    t.Setenv("SENHA_TAMANHO_MINIMO", "")
+    t.Setenv("SENHA_CLASSES_MINIMAS", "")
+    t.Setenv("SENHA_RECUSAR_COMUNS", "")
+    t.Setenv("SENHA_RECUSAR_DADOS_PESSOAIS", "")
+    esperado := PoliticaSenha{TamanhoMinimo: 10, ClassesMinimas: 3, RecusarComuns: true, RecusarDados: true}
+    if p := Politica(); p != esperado {
+        t.Errorf("padrão = %+v, esperado %+v", p, esperado)
+    }
+
+    t.Setenv("SENHA_TAMANHO_MINIMO", "14")
+    t.Setenv("SENHA_CLASSES_MINIMAS", "2")
+    t.Setenv("SENHA_RECUSAR_COMUNS", "false")
+    t.Setenv("SENHA_RECUSAR_DADOS_PESSOAIS", "false")
+    esperado = PoliticaSenha{TamanhoMinimo: 14, ClassesMinimas: 2}
+    if p := Politica(); p != esperado {
+        t.Errorf("configurada = %+v, esperado %+v", p, esperado)
+    }
+}
+
+func TestClassesCaracteres(t *testing.T) {
+    casos := map[string]int{
+        "":               0,
+        "abc":            1,
+        "ABC":            1,
+        "abcABC":         2,
+        "abc123":         2,
+        "aB3":            3,
+        "aB3!":           4,
+        "ação Ú":         3, // o espaço conta como símbolo
+        "12345678":       1,
+        "!@#$%^&*()":     1,
+        "Senha@2024":     4,
+        "correto cavalo": 2,
+    }
+    for senha, esperado := range casos {
+        if n := classesCaracteres(senha); n != esperado {
+            t.Errorf("classesCaracteres(%q) = %d, esperado %d", senha, n, esperado)
+        }
+    }
+}
+
+func TestDadosPessoais(t *testing.T) {
+    dados := dadosPessoais(" Ana.Silva_99@Exemplo.com ", "Ana Maria de Souza")
+    esperado := []string{"ana", "silva", "ana.silva_99", "ana", "maria", "souza"}
+    if strings.Join(dados, ",") != strings.Join(esperado, ",") {
+        t.Errorf("dadosPessoais = %q, esperado %q", dados, esperado)
+    }
+}
+
+func TestCarregarSenhasComuns(t *testing.T) {
+    senhas := carregarSenhasComuns("# comentário\n\nSenha\n  dragon  \n#outro\n")
+    if len(senhas) != 2 || !senhas["senha"] || !senhas["dragon"] {
+        t.Errorf("senhas = %v", senhas)
+    }
+    if len(senhasComuns) < 100 {
+        t.Errorf("lista embutida com apenas %d senhas", len(senhasComuns))
+    }
+    for _, senha := range []string{"123456", "password", "senha", "qwerty"} {
+        if !senhasComuns[senha] {
+            t.Errorf("%q deveria estar na lista de senhas comuns", senha)
+        }
+    }
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "estoque-api/config"
+    "time"
+)
+
+// ValidadeRefreshToken é o prazo de um refresh token. Cada uso gera um novo
+// token com o prazo renovado, então a sessão só expira por inatividade.
+func ValidadeRefreshToken() time.Duration {
+    return config.GetDuration("TOKEN_RENOVACAO_VALIDADE", 30*24*time.Hour)
+}
+
+// ValidadeRedefinicaoSenha é o prazo do token enviado por email para
+// redefinir a senha
+func ValidadeRedefinicaoSenha() time.Duration {
+    return config.GetDuration("SENHA_REDEFINICAO_VALIDADE", time.Hour)
+}
+
+// GenerateOpaqueToken gera um token aleatório (refresh token, redefinição de
+// senha) e o hash que deve ser gravado no banco. O token em si só é entregue
+// ao cliente.
+func GenerateOpaqueToken() (token, hash string, err error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", "", err
+    }
+    token = base64.RawURLEncoding.EncodeToString(b)
+    return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken calcula o hash usado para localizar o token no banco. Como
+// o token é aleatório e longo, um SHA-256 simples basta.
+func HashOpaqueToken(token string) string {
+    soma := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(soma[:])
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha1"
+    "encoding/base32"
+    "encoding/binary"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// Parâmetros dos códigos TOTP (RFC 6238), os padrão dos aplicativos
+// autenticadores: HMAC-SHA1, 6 dígitos e passos de 30 segundos
+const (
+    digitosTOTP = 6
+    passoTOTP   = 30
+)
+
+var base32SemPreenchimento = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GerarSegredoTOTP gera um segredo aleatório de 160 bits em base32, o
+// formato digitado ou lido por QR code nos aplicativos autenticadores
+func GerarSegredoTOTP() (string, error) {
+    b := make([]byte, 20)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return base32SemPreenchimento.EncodeToString(b), nil
+}
+
+// URITOTP monta a URI otpauth:// que os aplicativos autenticadores importam.
+// O cliente a transforma em QR code.
+func URITOTP(emissor, conta, segredo string) string {
+    consulta := url.Values{
+        "secret":    {segredo},
+        "issuer":    {emissor},
+        "algorithm": {"SHA1"},
+        "digits":    {fmt.Sprint(digitosTOTP)},
+        "period":    {fmt.Sprint(passoTOTP)},
+    }
+    rotulo := url.PathEscape(emissor) + ":" + url.PathEscape(conta)
+    // Alguns aplicativos não decodificam "+" como espaço
+    return "otpauth://totp/" + rotulo + "?" + strings.ReplaceAll(consulta.Encode(), "+", "%20")
+}
+
+// PassoTOTP é o número do intervalo de 30 segundos do instante
+func PassoTOTP(t time.Time) int64 {
+    return t.Unix() / passoTOTP
+}
+
+// CodigoTOTP calcula o código do passo (RFC 4226, truncamento dinâmico)
+func CodigoTOTP(segredo string, passo int64) (string, error) {
+    chave, err := base32SemPreenchimento.DecodeString(strings.ToUpper(strings.TrimRight(segredo, "=")))
+    if err != nil {
+        return "", fmt.Errorf("segredo TOTP inválido: %v", err)
+    }
+
+    var contador [8]byte
+    binary.BigEndian.PutUint64(contador[:], uint64(passo))
+    mac := hmac.New(sha1.New, chave)
+    mac.Write(contador[:])
+    soma := mac.Sum(nil)
+
+    deslocamento := soma[len(soma)-1] & 0x0f
+    valor := binary.BigEndian.Uint32(soma[deslocamento:deslocamento+4]) & 0x7fffffff
+    return fmt.Sprintf("%0*d", digitosTOTP, valor%1000000), nil
+}
+
+// VerificarTOTP confere o código aceitando um passo antes e um depois do
+// atual, para tolerar relógios levemente dessincronizados. Retorna o passo
+// correspondente, que deve ser guardado para impedir a reutilização do código.
+func VerificarTOTP(segredo, codigo string, agora time.Time) (int64, bool) {
+    codigo = strings.ReplaceAll(strings.TrimSpace(codigo), " ", "")
+    if len(codigo) != digitosTOTP {
+        return 0, false
+    }
+    atual := PassoTOTP(agora)
+    for passo := atual - 1; passo <= atual+1; passo++ {
+        esperado, err := CodigoTOTP(segredo, passo)
+        if err != nil {
+            return 0, false
+        }
+        if hmac.Equal([]byte(esperado), []byte(codigo)) {
+            return passo, true
+        }
+    }
+    return 0, false
+}
+
+// GerarCodigosRecuperacao gera os códigos de uso único que substituem o
+// autenticador perdido, no formato xxxxx-xxxxx, e os hashes a guardar
+func GerarCodigosRecuperacao(n int) (codigos, hashes []string, err error) {
+    for i := 0; i < n; i++ {
+        b := make([]byte, 7)
+        if _, err := rand.Read(b); err != nil {
+            return nil, nil, err
+        }
+        texto := strings.ToLower(base32SemPreenchimento.EncodeToString(b))[:10]
+        codigo := texto[:5] + "-" + texto[5:]
+        codigos = append(codigos, codigo)
+        hashes = append(hashes, HashCodigoRecuperacao(codigo))
+    }
+    return codigos, hashes, nil
+}
+
+// HashCodigoRecuperacao normaliza o código digitado (maiúsculas, espaços e
+// hífen) e calcula o hash guardado
+func HashCodigoRecuperacao(codigo string) string {
+    codigo = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(codigo)))
+    return HashOpaqueToken(codigo)
+}
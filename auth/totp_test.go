@@ -0,0 +1,179 @@
+package auth
+
+import (
+    "net/url"
+    "regexp"
+    "strings"
+    "testing"
+    "time"
+)
+
+// Segredo dos vetores de teste da RFC 6238 (apêndice B) para HMAC-SHA1: os
+// 20 bytes ASCII "12345678901234567890" em base32
+const segredoRFC = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vetores da RFC 6238 reduzidos a 6 dígitos (os 6 finais dos 8 da RFC)
+var vetoresRFC = []struct {
+    unix   int64
+    codigo string
+}{
+    {59, "287082"},
+    {1111111109, "081804"},
+    {1111111111, "050471"},
+    {1234567890, "005924"},
+    {2000000000, "279037"},
+    {20000000000, "353130"},
+}
+
+func TestCodigoTOTPVetoresRFC6238(t *testing.T) {
+    for _, v := range vetoresRFC {
+        passo := PassoTOTP(time.Unix(v.unix, 0))
+        codigo, err := CodigoTOTP(segredoRFC, passo)
+        if err != nil {
+            t.Fatalf("T=%d: %v", v.unix, err)
+        }
+        if codigo != v.codigo {
+            t.Errorf("T=%d: código %s, esperado %s", v.unix, codigo, v.codigo)
+        }
+    }
+}
+
+func TestCodigoTOTPSegredo(t *testing.T) {
+    // Minúsculas e preenchimento "=" são aceitos
+    codigo, err := CodigoTOTP(strings.ToLower(segredoRFC)+"====", 1)
+    if err != nil || codigo != "287082" {
+        t.Errorf("segredo em minúsculas: %s, %v", codigo, err)
+    }
+    if _, err := CodigoTOTP("não-é-base32!", 1); err == nil {
+        t.Error("segredo inválido deveria falhar")
+    }
+}
+
+func TestVerificarTOTPJanela(t *testing.T) {
+    agora := time.Unix(1111111111, 0)
+    atual := PassoTOTP(agora)
+    codigoDoPasso := func(passo int64) string {
+        c, err := CodigoTOTP(segredoRFC, passo)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return c
+    }
+
+    casos := []struct {
+        nome   string
+        codigo string
+        aceito bool
+        passo  int64
+    }{
+        {"passo atual", codigoDoPasso(atual), true, atual},
+        {"passo anterior", codigoDoPasso(atual - 1), true, atual - 1},
+        {"passo seguinte", codigoDoPasso(atual + 1), true, atual + 1},
+        {"dois passos atrás", codigoDoPasso(atual - 2), false, 0},
+        {"dois passos à frente", codigoDoPasso(atual + 2), false, 0},
+        {"com espaços", " 050 471 ", true, atual},
+        {"dígitos a menos", "05047", false, 0},
+        {"dígitos a mais", "0504711", false, 0},
+        {"vazio", "", false, 0},
+        {"errado", "000000", false, 0},
+    }
+    for _, caso := range casos {
+        t.Run(caso.nome, func(t *testing.T) {
+            passo, ok := VerificarTOTP(segredoRFC, caso.codigo, agora)
+            if ok != caso.aceito {
+                t.Fatalf("aceito = %v, esperado %v", ok, caso.aceito)
+            }
+            if ok && passo != caso.passo {
+                t.Errorf("passo = %d, esperado %d", passo, caso.passo)
+            }
+        })
+    }
+}
+
+func TestVerificarTOTPSegredoInvalido(t *testing.T) {
+    if _, ok := VerificarTOTP("???", "123456", time.Now()); ok {
+        t.Error("segredo inválido não pode aceitar código")
+    }
+}
+
+func TestGerarSegredoTOTP(t *testing.T) {
+    a, err := GerarSegredoTOTP()
+    if err != nil {
+        t.Fatal(err)
+    }
+    b, _ := GerarSegredoTOTP()
+    if a == b {
+        t.Error("segredos repetidos")
+    }
+    // 160 bits em base32 sem preenchimento
+    if len(a) != 32 || !regexp.MustCompile(`^[A-Z2-7]+$`).MatchString(a) {
+        t.Errorf("segredo = %q", a)
+    }
+    if _, err := CodigoTOTP(a, 1); err != nil {
+        t.Errorf("segredo gerado não é utilizável: %v", err)
+    }
+}
+
+func TestURITOTP(t *testing.T) {
+    uri := URITOTP("Estoque API", "ana@exemplo.com", segredoRFC)
+    if !strings.HasPrefix(uri, "otpauth://totp/Estoque%20API:ana@exemplo.com?") {
+        t.Fatalf("uri = %s", uri)
+    }
+    if strings.Contains(uri, "+") {
+        t.Errorf("espaços devem ser codificados como %%20: %s", uri)
+    }
+
+    u, err := url.Parse(uri)
+    if err != nil {
+        t.Fatal(err)
+    }
+    consulta := u.Query()
+    esperado := map[string]string{
+        "secret": segredoRFC, "issuer": "Estoque API", "algorithm": "SHA1", "digits": "6", "period": "30",
+    }
+    for chave, valor := range esperado {
+        if consulta.Get(chave) != valor {
+            t.Errorf("%s = %q, esperado %q", chave, consulta.Get(chave), valor)
+        }
+    }
+}
+
+func TestGerarCodigosRecuperacao(t *testing.T) {
+    codigos, hashes, err := GerarCodigosRecuperacao(10)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(codigos) != 10 || len(hashes) != 10 {
+        t.Fatalf("%d códigos e %d hashes", len(codigos), len(hashes))
+    }
+
+    formato := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+    vistos := map[string]bool{}
+    for i, codigo := range codigos {
+        if !formato.MatchString(codigo) {
+            t.Errorf("código %q fora do formato xxxxx-xxxxx", codigo)
+        }
+        if vistos[codigo] {
+            t.Errorf("código %q repetido", codigo)
+        }
+        vistos[codigo] = true
+        if hashes[i] != HashCodigoRecuperacao(codigo) {
+            t.Errorf("hash do código %d não confere", i)
+        }
+        if hashes[i] == codigo || strings.Contains(hashes[i], strings.ReplaceAll(codigo, "-", "")) {
+            t.Errorf("hash %q expõe o código", hashes[i])
+        }
+    }
+}
+
+func TestHashCodigoRecuperacaoNormaliza(t *testing.T) {
+    esperado := HashCodigoRecuperacao("abcde-fghij")
+    for _, digitado := range []string{"ABCDE-FGHIJ", "abcdefghij", " abcde fghij ", "AbCdE - fGhIj"} {
+        if HashCodigoRecuperacao(digitado) != esperado {
+            t.Errorf("%q deveria ter o mesmo hash de abcde-fghij", digitado)
+        }
+    }
+    if HashCodigoRecuperacao("abcde-fghik") == esperado {
+        t.Error("códigos diferentes com o mesmo hash")
+    }
+}
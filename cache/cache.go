@@ -0,0 +1,53 @@
+// Package cache guarda em memória resultados de consultas pesadas, como as
+// agregações dos relatórios, por um tempo limitado.
+package cache
+
+import (
+    "sync"
+    "time"
+)
+
+type entrada struct {
+    valor    interface{}
+    expiraEm time.Time
+}
+
+var (
+    mu       sync.RWMutex
+    entradas = map[string]entrada{}
+)
+
+// Get retorna o valor guardado na chave, se existir e ainda não tiver expirado
+func Get(chave string) (interface{}, bool) {
+    mu.RLock()
+    e, ok := entradas[chave]
+    mu.RUnlock()
+
+    if !ok || time.Now().After(e.expiraEm) {
+        return nil, false
+    }
+    return e.valor, true
+}
+
+// Set guarda o valor na chave pelo tempo informado
+func Set(chave string, valor interface{}, ttl time.Duration) {
+    mu.Lock()
+    defer mu.Unlock()
+
+    // Aproveita a escrita para descartar entradas vencidas
+    agora := time.Now()
+    for k, e := range entradas {
+        if agora.After(e.expiraEm) {
+            delete(entradas, k)
+        }
+    }
+    entradas[chave] = entrada{valor: valor, expiraEm: agora.Add(ttl)}
+}
+
+// Invalidar descarta todos os resultados guardados. Deve ser chamada sempre
+// que produtos ou o estoque forem alterados.
+func Invalidar() {
+    mu.Lock()
+    entradas = map[string]entrada{}
+    mu.Unlock()
+}
@@ -0,0 +1,105 @@
+// Comando migrar-armazenamento copia os arquivos enviados à API de um backend
+// de armazenamento para outro, por exemplo do diretório local para um bucket
+// S3. Os backends são configurados pelas mesmas variáveis de ambiente da API.
+//
+// Uso:
+//
+//	go run ./cmd/migrar-armazenamento -origem local -destino s3
+//
+// Arquivos que já existem no destino com o mesmo tamanho são ignorados, então
+// o comando pode ser repetido até que a migração termine sem erros. Depois
+// da cópia, altere ARMAZENAMENTO para o novo backend.
+package main
+
+import (
+    "context"
+    "errors"
+    "estoque-api/armazenamento"
+    "flag"
+    "fmt"
+    "log"
+    "mime"
+    "os"
+    "path"
+    "time"
+)
+
+func main() {
+    origem := flag.String("origem", "local", "backend de origem (local ou s3)")
+    destino := flag.String("destino", "s3", "backend de destino (local ou s3)")
+    prefixo := flag.String("prefixo", "", "copia apenas as chaves com este prefixo")
+    removerOrigem := flag.Bool("remover-origem", false, "apaga cada arquivo da origem depois de copiado")
+    simular := flag.Bool("simular", false, "apenas lista o que seria copiado")
+    flag.Parse()
+
+    if *origem == *destino {
+        log.Fatal("origem e destino devem ser backends diferentes")
+    }
+    de, err := armazenamento.Novo(*origem)
+    if err != nil {
+        log.Fatal(err)
+    }
+    para, err := armazenamento.Novo(*destino)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    ctx := context.Background()
+    var copiados, ignorados, falhas int
+    var bytesCopiados int64
+    err = de.Listar(ctx, *prefixo, func(obj armazenamento.Objeto) error {
+        existente, err := para.Consultar(ctx, obj.Chave)
+        if err == nil && existente.Tamanho == obj.Tamanho {
+            ignorados++
+            return nil
+        }
+        if err != nil && !errors.Is(err, armazenamento.ErrNaoEncontrado) {
+            fmt.Fprintf(os.Stderr, "%s: %v\n", obj.Chave, err)
+            falhas++
+            return nil
+        }
+
+        if *simular {
+            fmt.Println("copiaria", obj.Chave)
+            copiados++
+            bytesCopiados += obj.Tamanho
+            return nil
+        }
+        if err := copiar(ctx, de, para, obj.Chave); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %v\n", obj.Chave, err)
+            falhas++
+            return nil
+        }
+        if *removerOrigem {
+            if err := de.Remover(ctx, obj.Chave); err != nil {
+                fmt.Fprintf(os.Stderr, "%s: copiado, mas não removido da origem: %v\n", obj.Chave, err)
+                falhas++
+            }
+        }
+        fmt.Println("copiado", obj.Chave)
+        copiados++
+        bytesCopiados += obj.Tamanho
+        return nil
+    })
+    if err != nil {
+        log.Fatalf("erro ao listar a origem: %v", err)
+    }
+
+    fmt.Printf("%d arquivo(s) copiado(s) (%d bytes), %d já existente(s), %d falha(s)\n", copiados, bytesCopiados, ignorados, falhas)
+    if falhas > 0 {
+        os.Exit(1)
+    }
+}
+
+// copiar lê o arquivo da origem e grava no destino com o tipo de conteúdo
+// deduzido pela extensão
+func copiar(ctx context.Context, de, para armazenamento.Armazenamento, chave string) error {
+    ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+    defer cancel()
+
+    dados, err := de.Ler(ctx, chave)
+    if err != nil {
+        return err
+    }
+    return para.Gravar(ctx, chave, dados, mime.TypeByExtension(path.Ext(chave)))
+}
@@ -0,0 +1,34 @@
+// Package config lê as configurações da aplicação a partir de variáveis de ambiente
+package config
+
+import (
+    "os"
+    "strconv"
+    "time"
+)
+
+// Get retorna o valor da variável de ambiente ou o padrão quando não definida
+func Get(chave, padrao string) string {
+    if v, ok := os.LookupEnv(chave); ok && v != "" {
+        return v
+    }
+    return padrao
+}
+
+// GetInt retorna a variável de ambiente como inteiro, ou o padrão quando não
+// definida ou inválida
+func GetInt(chave string, padrao int) int {
+    if n, err := strconv.Atoi(os.Getenv(chave)); err == nil {
+        return n
+    }
+    return padrao
+}
+
+// GetDuration retorna a variável de ambiente como duração (por exemplo "30s"
+// ou "5m"), ou o padrão quando não definida ou inválida
+func GetDuration(chave string, padrao time.Duration) time.Duration {
+    if d, err := time.ParseDuration(os.Getenv(chave)); err == nil {
+        return d
+    }
+    return padrao
+}
@@ -0,0 +1,76 @@
+// Package email envia as mensagens da API (como a redefinição de senha) por
+// SMTP ou, em desenvolvimento e testes, por remetentes locais que apenas
+// registram as mensagens
+package email
+
+import (
+    "context"
+    "estoque-api/config"
+    "fmt"
+    "sync"
+)
+
+// Mensagem é um email de texto simples
+type Mensagem struct {
+    Para    string
+    Assunto string
+    Corpo   string
+}
+
+// Remetente envia mensagens
+type Remetente interface {
+    Enviar(ctx context.Context, msg Mensagem) error
+}
+
+// Novo cria o remetente do tipo informado (smtp, log ou memoria) a partir
+// das variáveis de ambiente:
+//   - smtp: SMTP_HOST, SMTP_PORTA (padrão 587), SMTP_USUARIO, SMTP_SENHA e
+//     SMTP_REMETENTE (padrão SMTP_USUARIO)
+//   - log: escreve as mensagens na saída da aplicação
+//   - memoria: guarda as mensagens, para testes
+func Novo(tipo string) (Remetente, error) {
+    switch tipo {
+    case "smtp":
+        return NovoSMTP(
+            config.Get("SMTP_HOST", ""),
+            config.GetInt("SMTP_PORTA", 587),
+            config.Get("SMTP_USUARIO", ""),
+            config.Get("SMTP_SENHA", ""),
+            config.Get("SMTP_REMETENTE", config.Get("SMTP_USUARIO", "")),
+        )
+    case "log":
+        return Log{}, nil
+    case "memoria":
+        return &Memoria{}, nil
+    default:
+        return nil, fmt.Errorf("envio de email %q desconhecido, use smtp, log ou memoria", tipo)
+    }
+}
+
+// Log escreve as mensagens na saída em vez de enviá-las
+type Log struct{}
+
+func (Log) Enviar(ctx context.Context, msg Mensagem) error {
+    fmt.Printf("Email para %s: %s\n%s\n", msg.Para, msg.Assunto, msg.Corpo)
+    return nil
+}
+
+// Memoria guarda as mensagens enviadas, para que os testes as consultem
+type Memoria struct {
+    mu        sync.Mutex
+    mensagens []Mensagem
+}
+
+func (m *Memoria) Enviar(ctx context.Context, msg Mensagem) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.mensagens = append(m.mensagens, msg)
+    return nil
+}
+
+// Mensagens retorna uma cópia das mensagens enviadas até agora
+func (m *Memoria) Mensagens() []Mensagem {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return append([]Mensagem(nil), m.mensagens...)
+}
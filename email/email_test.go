@@ -0,0 +1,83 @@
+package email
+
+import (
+    "context"
+    "strings"
+    "testing"
+)
+
+func TestNovo(t *testing.T) {
+    t.Setenv("SMTP_HOST", "")
+    t.Setenv("SMTP_USUARIO", "")
+    t.Setenv("SMTP_REMETENTE", "")
+
+    if _, err := Novo("smtp"); err == nil {
+        t.Error("smtp sem SMTP_HOST deveria falhar")
+    }
+    if _, err := Novo("sendmail"); err == nil {
+        t.Error("tipo desconhecido deveria falhar")
+    }
+    if _, err := Novo(""); err == nil {
+        t.Error("tipo vazio deveria falhar")
+    }
+
+    t.Setenv("SMTP_HOST", "smtp.exemplo.com")
+    t.Setenv("SMTP_USUARIO", "estoque@exemplo.com")
+    r, err := Novo("smtp")
+    if err != nil {
+        t.Fatalf("smtp configurado: %v", err)
+    }
+    s := r.(*SMTP)
+    if s.Porta != 587 || s.Remetente != "estoque@exemplo.com" {
+        t.Errorf("padrões do smtp: porta %d, remetente %q", s.Porta, s.Remetente)
+    }
+}
+
+func TestMemoria(t *testing.T) {
+    m := &Memoria{}
+    msg := Mensagem{Para: "ana@exemplo.com", Assunto: "Teste", Corpo: "corpo"}
+    if err := m.Enviar(context.Background(), msg); err != nil {
+        t.Fatal(err)
+    }
+
+    mensagens := m.Mensagens()
+    if len(mensagens) != 1 || mensagens[0] != msg {
+        t.Fatalf("mensagens = %v", mensagens)
+    }
+    // A lista retornada é uma cópia
+    mensagens[0].Para = "outro@exemplo.com"
+    if m.Mensagens()[0].Para != msg.Para {
+        t.Error("Mensagens expôs a lista interna")
+    }
+}
+
+func TestSMTPMontar(t *testing.T) {
+    s := &SMTP{Remetente: "estoque@exemplo.com"}
+    texto := string(s.montar(Mensagem{Para: "ana@exemplo.com", Assunto: "Redefinição de senha", Corpo: "linha 1\nlinha 2"}))
+
+    cabecalho, corpo, ok := strings.Cut(texto, "\r\n\r\n")
+    if !ok {
+        t.Fatalf("mensagem sem separação entre cabeçalho e corpo: %q", texto)
+    }
+    for _, esperado := range []string{
+        "From: estoque@exemplo.com",
+        "To: ana@exemplo.com",
+        "Subject: =?utf-8?q?Redefini=C3=A7=C3=A3o_de_senha?=",
+        "Content-Type: text/plain; charset=utf-8",
+    } {
+        if !strings.Contains(cabecalho, esperado+"\r\n") {
+            t.Errorf("cabeçalho sem %q:\n%s", esperado, cabecalho)
+        }
+    }
+    if corpo != "linha 1\r\nlinha 2" {
+        t.Errorf("corpo = %q", corpo)
+    }
+}
+
+func TestSMTPRecusaDestinatarioComQuebraDeLinha(t *testing.T) {
+    s := &SMTP{Host: "127.0.0.1", Porta: 1, Remetente: "estoque@exemplo.com"}
+    err := s.Enviar(context.Background(), Mensagem{Para: "ana@exemplo.com\r\nBcc: outro@exemplo.com"})
+    if err == nil || !strings.Contains(err.Error(), "destinatário inválido") {
+        t.Errorf("err = %v", err)
+    }
+}
@@ -0,0 +1,71 @@
+package email
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "mime"
+    "net"
+    "net/smtp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// SMTP envia as mensagens por um servidor SMTP, com STARTTLS quando o
+// servidor oferece e autenticação PLAIN quando há usuário configurado
+type SMTP struct {
+    Host      string
+    Porta     int
+    Usuario   string
+    Senha     string
+    Remetente string
+}
+
+// NovoSMTP cria o remetente SMTP
+func NovoSMTP(host string, porta int, usuario, senha, remetente string) (*SMTP, error) {
+    if host == "" || remetente == "" {
+        return nil, errors.New("smtp: informe SMTP_HOST e SMTP_REMETENTE")
+    }
+    return &SMTP{Host: host, Porta: porta, Usuario: usuario, Senha: senha, Remetente: remetente}, nil
+}
+
+func (s *SMTP) Enviar(ctx context.Context, msg Mensagem) error {
+    if strings.ContainsAny(msg.Para, "\r\n") {
+        return errors.New("smtp: destinatário inválido")
+    }
+
+    endereco := net.JoinHostPort(s.Host, strconv.Itoa(s.Porta))
+    var auth smtp.Auth
+    if s.Usuario != "" {
+        auth = smtp.PlainAuth("", s.Usuario, s.Senha, s.Host)
+    }
+
+    // smtp.SendMail não aceita contexto; o envio roda à parte e a espera é
+    // interrompida quando o contexto termina
+    erro := make(chan error, 1)
+    go func() {
+        erro <- smtp.SendMail(endereco, auth, s.Remetente, []string{msg.Para}, s.montar(msg))
+    }()
+    select {
+    case err := <-erro:
+        return err
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// montar gera a mensagem com os cabeçalhos; o assunto é codificado para
+// aceitar acentos
+func (s *SMTP) montar(msg Mensagem) []byte {
+    var b strings.Builder
+    fmt.Fprintf(&b, "From: %s\r\n", s.Remetente)
+    fmt.Fprintf(&b, "To: %s\r\n", msg.Para)
+    fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Assunto))
+    fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    b.WriteString("MIME-Version: 1.0\r\n")
+    b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+    b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+    b.WriteString(strings.ReplaceAll(msg.Corpo, "\n", "\r\n"))
+    return []byte(b.String())
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "estoque-api/models"
+    "fmt"
+    "net/http"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tipos aceitos nos atributos das categorias
+var tiposAtributo = map[string]bool{
+    "texto":    true,
+    "numero":   true,
+    "inteiro":  true,
+    "booleano": true,
+    "opcao":    true,
+    "data":     true,
+}
+
+// As chaves viram nomes de campo no MongoDB, então não podem conter "." nem "$"
+var chaveAtributoValida = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// chaveAtributo normaliza a chave de um atributo: "Teor Alcoólico" vira
+// "teor_alcoolico"
+func chaveAtributo(s string) string {
+    return strings.ReplaceAll(slugCategoria(s), "-", "_")
+}
+
+// validarAtributosCategoria normaliza e confere as definições de atributos
+// de uma categoria
+func validarAtributosCategoria(atributos []models.AtributoCategoria) error {
+    vistas := map[string]bool{}
+    for i := range atributos {
+        a := &atributos[i]
+        if a.Chave == "" {
+            a.Chave = a.Nome
+        }
+        a.Chave = chaveAtributo(a.Chave)
+        if a.Chave == "" {
+            return fmt.Errorf("atributo %d: informe a chave ou o nome", i+1)
+        }
+        if vistas[a.Chave] {
+            return fmt.Errorf("atributo %s: chave repetida", a.Chave)
+        }
+        vistas[a.Chave] = true
+        if a.Nome == "" {
+            a.Nome = a.Chave
+        }
+
+        a.Tipo = strings.ToLower(strings.TrimSpace(a.Tipo))
+        if a.Tipo == "" {
+            a.Tipo = "texto"
+        }
+        if !tiposAtributo[a.Tipo] {
+            return fmt.Errorf("atributo %s: tipo inválido, use texto, numero, inteiro, booleano, opcao ou data", a.Chave)
+        }
+
+        if a.Tipo == "opcao" {
+            opcoes := map[string]bool{}
+            for _, o := range a.Opcoes {
+                if strings.TrimSpace(o) == "" || opcoes[strings.ToLower(o)] {
+                    return fmt.Errorf("atributo %s: opções vazias ou repetidas", a.Chave)
+                }
+                opcoes[strings.ToLower(o)] = true
+            }
+            if len(opcoes) == 0 {
+                return fmt.Errorf("atributo %s: informe as opções", a.Chave)
+            }
+        } else if len(a.Opcoes) > 0 {
+            return fmt.Errorf("atributo %s: opções só se aplicam ao tipo opcao", a.Chave)
+        }
+
+        numerico := a.Tipo == "numero" || a.Tipo == "inteiro"
+        if !numerico && (a.Minimo != nil || a.Maximo != nil) {
+            return fmt.Errorf("atributo %s: mínimo e máximo só se aplicam a números", a.Chave)
+        }
+        if a.Minimo != nil && a.Maximo != nil && *a.Minimo > *a.Maximo {
+            return fmt.Errorf("atributo %s: mínimo maior que o máximo", a.Chave)
+        }
+    }
+    return nil
+}
+
+// atributoEfetivo é um atributo aplicável à categoria, com a categoria que o
+// definiu (a própria ou um ancestral)
+type atributoEfetivo struct {
+    models.AtributoCategoria
+    CategoriaID primitive.ObjectID `json:"categoria_id"`
+}
+
+// esquemaCategoria reúne os atributos da categoria e de seus ancestrais. Uma
+// subcategoria pode redefinir um atributo herdado usando a mesma chave.
+func esquemaCategoria(ctx context.Context, categoria models.Categoria) ([]atributoEfetivo, error) {
+    ancestrais := map[primitive.ObjectID]models.Categoria{}
+    if len(categoria.Caminho) > 0 {
+        cursor, err := categoriaCollection.Find(ctx, bson.M{"_id": bson.M{"$in": categoria.Caminho}})
+        if err != nil {
+            return nil, err
+        }
+        var lista []models.Categoria
+        if err := cursor.All(ctx, &lista); err != nil {
+            return nil, err
+        }
+        for _, a := range lista {
+            ancestrais[a.ID] = a
+        }
+    }
+
+    var esquema []atributoEfetivo
+    posicao := map[string]int{}
+    niveis := append(append([]primitive.ObjectID{}, categoria.Caminho...), categoria.ID)
+    for _, id := range niveis {
+        nivel, ok := ancestrais[id]
+        if id == categoria.ID {
+            nivel, ok = categoria, true
+        }
+        if !ok {
+            continue
+        }
+        for _, a := range nivel.Atributos {
+            efetivo := atributoEfetivo{AtributoCategoria: a, CategoriaID: nivel.ID}
+            if i, ok := posicao[a.Chave]; ok {
+                esquema[i] = efetivo
+                continue
+            }
+            posicao[a.Chave] = len(esquema)
+            esquema = append(esquema, efetivo)
+        }
+    }
+    return esquema, nil
+}
+
+// esquemaProduto retorna os atributos aplicáveis a um produto da categoria
+// informada. Produtos sem categoria cadastrada não têm atributos.
+func esquemaProduto(ctx context.Context, categoriaID *primitive.ObjectID) ([]atributoEfetivo, error) {
+    if categoriaID == nil {
+        return nil, nil
+    }
+    categoria, err := buscarCategoria(ctx, categoriaID.Hex())
+    if err != nil {
+        return nil, err
+    }
+    return esquemaCategoria(ctx, categoria)
+}
+
+// validarEspecificacoes confere as especificações de um produto contra o
+// esquema da categoria e retorna os valores convertidos para o tipo de cada
+// atributo. Valores vazios são descartados.
+func validarEspecificacoes(esquema []atributoEfetivo, especificacoes map[string]interface{}) (map[string]interface{}, error) {
+    definicoes := make(map[string]models.AtributoCategoria, len(esquema))
+    for _, a := range esquema {
+        definicoes[a.Chave] = a.AtributoCategoria
+    }
+
+    validas := map[string]interface{}{}
+    chaves := make([]string, 0, len(especificacoes))
+    for chave := range especificacoes {
+        chaves = append(chaves, chave)
+    }
+    sort.Strings(chaves)
+    for _, chave := range chaves {
+        v := especificacoes[chave]
+        if s, ok := v.(string); v == nil || ok && strings.TrimSpace(s) == "" {
+            continue
+        }
+        definicao, ok := definicoes[chave]
+        if !ok {
+            return nil, fmt.Errorf("especificação %s não definida para a categoria", chave)
+        }
+        convertido, err := converterEspecificacao(definicao, v)
+        if err != nil {
+            return nil, fmt.Errorf("especificação %s: %v", chave, err)
+        }
+        validas[chave] = convertido
+    }
+
+    for _, a := range esquema {
+        if _, ok := validas[a.Chave]; a.Obrigatorio && !ok {
+            return nil, fmt.Errorf("especificação %s é obrigatória", a.Chave)
+        }
+    }
+    return validas, nil
+}
+
+// converterEspecificacao converte o valor recebido para o tipo do atributo.
+// Números e booleanos também são aceitos como texto, como chegam de planilhas.
+func converterEspecificacao(a models.AtributoCategoria, v interface{}) (interface{}, error) {
+    s, texto := v.(string)
+    s = strings.TrimSpace(s)
+
+    switch a.Tipo {
+    case "numero", "inteiro":
+        n, ok := v.(float64)
+        if texto {
+            var err error
+            if n, err = converterDecimal(s); err == nil {
+                ok = true
+            }
+        }
+        if !ok {
+            return nil, errors.New("informe um número")
+        }
+        if a.Tipo == "inteiro" && !inteira(n) {
+            return nil, errors.New("informe um número inteiro")
+        }
+        if a.Minimo != nil && n < *a.Minimo {
+            return nil, fmt.Errorf("valor menor que o mínimo %g", *a.Minimo)
+        }
+        if a.Maximo != nil && n > *a.Maximo {
+            return nil, fmt.Errorf("valor maior que o máximo %g", *a.Maximo)
+        }
+        return n, nil
+    case "booleano":
+        if b, ok := v.(bool); ok {
+            return b, nil
+        }
+        if b, err := strconv.ParseBool(s); texto && err == nil {
+            return b, nil
+        }
+        return nil, errors.New("informe true ou false")
+    case "opcao":
+        if texto {
+            for _, o := range a.Opcoes {
+                if strings.EqualFold(o, s) {
+                    return o, nil
+                }
+            }
+        }
+        return nil, fmt.Errorf("use uma das opções: %s", strings.Join(a.Opcoes, ", "))
+    case "data":
+        if _, err := time.Parse("2006-01-02", s); !texto || err != nil {
+            return nil, errors.New("informe a data no formato YYYY-MM-DD")
+        }
+        // Guardada como texto ISO, que mantém a ordem nas comparações dos filtros
+        return s, nil
+    default:
+        if !texto {
+            return nil, errors.New("informe um texto")
+        }
+        return s, nil
+    }
+}
+
+// filtrarEspecificacoes acrescenta ao filtro das listagens as condições sobre
+// especificações:
+//   - esp[chave]=valor: igualdade; vários valores separados por vírgula
+//   - esp_min[chave]=n e esp_max[chave]=n: faixa, para números e datas
+func filtrarEspecificacoes(c *gin.Context, filtro bson.M) {
+    condicoes := map[string]bson.M{}
+    condicao := func(chave string) bson.M {
+        campo := "especificacoes." + chave
+        if condicoes[campo] == nil {
+            condicoes[campo] = bson.M{}
+        }
+        return condicoes[campo]
+    }
+
+    for chave, v := range c.QueryMap("esp") {
+        if !chaveAtributoValida.MatchString(chave) {
+            continue
+        }
+        var valores []interface{}
+        for _, item := range strings.Split(v, ",") {
+            valores = append(valores, valoresFiltroEspecificacao(strings.TrimSpace(item))...)
+        }
+        condicao(chave)["$in"] = valores
+    }
+
+    for param, operador := range map[string]string{"esp_min": "$gte", "esp_max": "$lte"} {
+        for chave, v := range c.QueryMap(param) {
+            if !chaveAtributoValida.MatchString(chave) {
+                continue
+            }
+            var limite interface{} = v
+            if n, err := converterDecimal(v); err == nil {
+                limite = n
+            }
+            condicao(chave)[operador] = limite
+        }
+    }
+
+    for campo, cond := range condicoes {
+        filtro[campo] = cond
+    }
+}
+
+// valoresFiltroEspecificacao retorna as formas em que o valor do parâmetro
+// pode estar gravado: texto (sem diferenciar maiúsculas), número ou booleano
+func valoresFiltroEspecificacao(v string) []interface{} {
+    valores := []interface{}{primitive.Regex{Pattern: "^" + regexp.QuoteMeta(v) + "$", Options: "i"}}
+    if n, err := converterDecimal(v); err == nil {
+        valores = append(valores, n)
+    }
+    if b, err := strconv.ParseBool(v); err == nil {
+        valores = append(valores, b)
+    }
+    return valores
+}
+
+// GetAtributosCategoria lista os atributos aplicáveis aos produtos da
+// categoria, incluindo os herdados das categorias ancestrais
+func GetAtributosCategoria(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    categoria, err := buscarCategoria(ctx, c.Param("id"))
+    if err == errCategoriaNaoEncontrada {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Categoria não encontrada"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    esquema, err := esquemaCategoria(ctx, categoria)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if esquema == nil {
+        esquema = []atributoEfetivo{}
+    }
+
+    c.JSON(http.StatusOK, gin.H{"categoria_id": categoria.ID, "nome": categoria.Nome, "atributos": esquema})
+}
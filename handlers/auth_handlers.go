@@ -1,13 +1,12 @@
 package handlers
 
 import (
-    "bytes"
     "context"
     "estoque-api/models"
     "estoque-api/auth"
+    "estoque-api/config"
     "estoque-api/database"
     "fmt"
-    "io"
     "net/http"
     "time"
     "golang.org/x/crypto/bcrypt"
@@ -22,48 +21,110 @@ var userCollection *mongo.Collection
 // InitializeAuthHandlers inicializa as collections necessárias
 func InitializeAuthHandlers() {
     userCollection = database.DB.Collection("users")
+    inicializarSessoes()
+    inicializarSenhas()
+    inicializarProtecaoLogin()
+    inicializarDoisFatores()
+    inicializarChavesAPI()
+    criarAdminInicial()
 }
 
+// criarAdminInicial cria o primeiro admin a partir de ADMIN_EMAIL e
+// ADMIN_SENHA quando ainda não existe nenhum, já que o cadastro público só
+// cria contas "user"
+func criarAdminInicial() {
+    email, senha := config.Get("ADMIN_EMAIL", ""), config.Get("ADMIN_SENHA", "")
+    if email == "" || senha == "" {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if n, err := userCollection.CountDocuments(ctx, bson.M{"role": "admin"}); err != nil || n > 0 {
+        return
+    }
+    if problemas := auth.Politica().Validar(senha, email, "Administrador"); len(problemas) > 0 {
+        fmt.Printf("Admin inicial não criado, ADMIN_SENHA não atende à política de senhas: %v\n", problemas)
+        return
+    }
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(senha), bcrypt.DefaultCost)
+    if err != nil {
+        return
+    }
+    _, err = userCollection.InsertOne(ctx, models.User{
+        ID:          primitive.NewObjectID(),
+        Nome:        "Administrador",
+        Email:       email,
+        Senha:       string(hashedPassword),
+        Role:        "admin",
+        DataCriacao: time.Now(),
+        Ativo:       true,
+    })
+    if err != nil {
+        fmt.Printf("Erro ao criar o admin inicial: %v\n", err)
+        return
+    }
+    fmt.Printf("Admin inicial %s criado\n", email)
+}
+
+// Register é o cadastro público: cria sempre contas "user". Contas de
+// funcionários com outros perfis são criadas por um admin em POST /usuarios.
+// Com REGISTRO_PUBLICO=false o cadastro público fica desativado.
 func Register(c *gin.Context) {
+    if config.Get("REGISTRO_PUBLICO", "true") == "false" {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Cadastro público desativado"})
+        return
+    }
+
     // Criar uma estrutura específica para o registro
     var registerData struct {
         Nome     string `json:"nome" binding:"required"`
         Email    string `json:"email" binding:"required"`
         Senha    string `json:"senha" binding:"required"`
-        Role     string `json:"role"`
     }
 
-    // Log do body recebido
-    body, _ := io.ReadAll(c.Request.Body)
-    fmt.Printf("Body recebido: %s\n", string(body))
-    // Restaura o body para poder ser lido novamente
-    c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
-
     if err := c.ShouldBindJSON(&registerData); err != nil {
         fmt.Printf("Erro no binding: %v\n", err)
         c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler dados do usuário", "details": err.Error()})
         return
     }
 
-    // Log para debug
-    fmt.Printf("Dados após binding: %+v\n", registerData)
+    criarUsuario(c, registerData.Nome, registerData.Email, registerData.Senha, "user", false)
+}
+
+// criarUsuario valida e grava um novo usuário com o perfil informado,
+// respondendo a requisição. Contas de serviço (integrações) não têm senha
+// conhecida: acessam a API apenas por chaves de API.
+func criarUsuario(c *gin.Context, nome, email, senha, role string, contaServico bool) {
+    if contaServico {
+        aleatoria, _, err := auth.GenerateOpaqueToken()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar senha"})
+            return
+        }
+        senha = aleatoria
+    }
 
     // Validações básicas
-    if registerData.Email == "" || registerData.Senha == "" {
+    if email == "" || senha == "" {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Email e senha são obrigatórios"})
         return
     }
+    if !contaServico && !validarSenha(c, senha, email, nome) {
+        return
+    }
 
     // Verifica se o email já existe
     var existingUser models.User
-    err := userCollection.FindOne(context.Background(), bson.M{"email": registerData.Email}).Decode(&existingUser)
+    err := userCollection.FindOne(context.Background(), bson.M{"email": email}).Decode(&existingUser)
     if err == nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Email já cadastrado"})
         return
     }
 
     // Hash da senha
-    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(registerData.Senha), bcrypt.DefaultCost)
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(senha), bcrypt.DefaultCost)
     if err != nil {
         fmt.Printf("Erro ao gerar hash da senha: %v\n", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar senha"})
@@ -73,21 +134,15 @@ func Register(c *gin.Context) {
     // Criar novo usuário
     newUser := models.User{
         ID:           primitive.NewObjectID(),
-        Nome:         registerData.Nome,
-        Email:        registerData.Email,
+        Nome:         nome,
+        Email:        email,
         Senha:        string(hashedPassword),
-        Role:         registerData.Role,
+        Role:         role,
         DataCriacao:  time.Now(),
         Ativo:        true,
+        ContaServico: contaServico,
     }
 
-    if newUser.Role == "" {
-        newUser.Role = "user" // Role padrão
-    }
-
-    // Log para debug
-    fmt.Printf("Dados do usuário antes de salvar: %+v\n", newUser)
-
     _, err = userCollection.InsertOne(context.Background(), newUser)
     if err != nil {
         fmt.Printf("Erro ao salvar usuário: %v\n", err)
@@ -117,37 +172,63 @@ func Login(c *gin.Context) {
         return
     }
 
-    // Log para debug
-    fmt.Printf("Tentativa de login para email: %s\n", credentials.Email)
-    fmt.Printf("Senha fornecida: %s\n", credentials.Senha)
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
 
-    var user models.User
-    err := userCollection.FindOne(context.Background(), bson.M{"email": credentials.Email}).Decode(&user)
+    // Conta ou IP com falhas demais ficam bloqueados temporariamente
+    ip := c.ClientIP()
+    conta := chaveConta(credentials.Email)
+    bloqueadoAte, err := bloqueioLogin(ctx, conta, chaveIP(ip))
     if err != nil {
-        if err == mongo.ErrNoDocuments {
-            fmt.Printf("Usuário não encontrado para email: %s\n", credentials.Email)
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Email não encontrado"})
-            return
-        }
+        fmt.Printf("Erro ao consultar bloqueios de login: %v\n", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar usuário"})
+        return
+    }
+    if !bloqueadoAte.IsZero() {
+        responderBloqueioLogin(c, bloqueadoAte)
+        return
+    }
+
+    var user models.User
+    err = userCollection.FindOne(ctx, bson.M{"email": credentials.Email}).Decode(&user)
+    if err != nil && err != mongo.ErrNoDocuments {
         fmt.Printf("Erro ao buscar usuário: %v\n", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar usuário"})
         return
     }
 
-    // Log para debug
-    fmt.Printf("Usuário encontrado: %+v\n", user)
-    fmt.Printf("Hash da senha armazenada: %s\n", user.Senha)
+    // Para email desconhecido a comparação é feita com um hash fictício: a
+    // resposta leva o mesmo tempo e tem a mesma mensagem de uma senha errada
+    hash := hashFicticio
+    if err == nil {
+        hash = []byte(user.Senha)
+    }
+    if bcrypt.CompareHashAndPassword(hash, []byte(credentials.Senha)) != nil || err != nil {
+        falhasConta, errConta := registrarFalhaLogin(ctx, conta, maximoFalhasConta(), credentials.Email, ip)
+        falhasIP, errIP := registrarFalhaLogin(ctx, chaveIP(ip), maximoFalhasIP(), credentials.Email, ip)
+        if errConta != nil || errIP != nil {
+            fmt.Printf("Erro ao registrar falha de login: %v %v\n", errConta, errIP)
+        }
+        time.Sleep(atrasoFalhaLogin(max(falhasConta, falhasIP)))
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Email ou senha inválidos"})
+        return
+    }
+    tentativasLoginCollection.DeleteOne(ctx, bson.M{"_id": conta})
 
-    // Comparação das senhas
-    err = bcrypt.CompareHashAndPassword([]byte(user.Senha), []byte(credentials.Senha))
-    if err != nil {
-        fmt.Printf("Erro na comparação de senhas: %v\n", err)
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Senha incorreta"})
+    if !user.Ativo {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Usuário inativo"})
+        return
+    }
+
+    // Com dois fatores (ativos ou exigidos pelo perfil) a senha correta leva
+    // a um desafio; os tokens só são emitidos em POST /login/2fa
+    if doisFatoresAtivo(user) || exigeDoisFatores(user) {
+        iniciarDesafioLogin(ctx, c, user)
         return
     }
 
-    // Se chegou aqui, a senha está correta
-    token, err := auth.GenerateToken(user.ID.Hex(), user.Role)
+    // Se chegou aqui, a senha está correta. Cada login inicia uma nova sessão.
+    sessao, err := emitirSessao(ctx, user, primitive.NewObjectID())
     if err != nil {
         fmt.Printf("Erro ao gerar token: %v\n", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
@@ -156,18 +237,16 @@ func Login(c *gin.Context) {
 
     // Atualiza último acesso
     _, err = userCollection.UpdateOne(
-        context.Background(),
+        ctx,
         bson.M{"_id": user.ID},
         bson.M{"$set": bson.M{"ultimo_acesso": time.Now()}},
     )
 
-    c.JSON(http.StatusOK, gin.H{
-        "token": token,
-        "user": gin.H{
-            "id": user.ID,
-            "nome": user.Nome,
-            "email": user.Email,
-            "role": user.Role,
-        },
-    })
+    sessao["user"] = gin.H{
+        "id": user.ID,
+        "nome": user.Nome,
+        "email": user.Email,
+        "role": user.Role,
+    }
+    c.JSON(http.StatusOK, sessao)
 }
\ No newline at end of file
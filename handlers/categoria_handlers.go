@@ -0,0 +1,473 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "estoque-api/database"
+    "estoque-api/models"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "golang.org/x/text/unicode/norm"
+)
+
+var errCategoriaNaoEncontrada = errors.New("categoria não encontrada")
+
+var categoriaCollection *mongo.Collection
+
+// InitializeCategoriaHandlers inicializa a collection de categorias
+func InitializeCategoriaHandlers() {
+    categoriaCollection = database.DB.Collection("categorias")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    categoriaCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {Keys: bson.M{"slug": 1}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.M{"caminho": 1}},
+    })
+    collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {Keys: bson.M{"categoria_id": 1}},
+        // Atende os filtros por qualquer especificação (esp[chave]=valor)
+        {Keys: bson.M{"especificacoes.$**": 1}},
+    })
+}
+
+// slugCategoria normaliza o nome para comparação e uso em URLs:
+// "Bebidas Alcoólicas" e "bebidas alcoolicas" geram "bebidas-alcoolicas"
+func slugCategoria(nome string) string {
+    var b strings.Builder
+    hifen := false
+    for _, r := range norm.NFD.String(strings.ToLower(nome)) {
+        switch {
+        case unicode.Is(unicode.Mn, r):
+            // Descarta os acentos separados pela decomposição NFD
+        case unicode.IsLetter(r) || unicode.IsDigit(r):
+            if hifen && b.Len() > 0 {
+                b.WriteByte('-')
+            }
+            b.WriteRune(r)
+            hifen = false
+        default:
+            hifen = true
+        }
+    }
+    return b.String()
+}
+
+// buscarCategoria localiza uma categoria pelo ID ou pelo slug (o nome
+// também é aceito, pois é convertido em slug)
+func buscarCategoria(ctx context.Context, ref string) (models.Categoria, error) {
+    var categoria models.Categoria
+    filtro := bson.M{"slug": slugCategoria(ref)}
+    if id, err := primitive.ObjectIDFromHex(ref); err == nil {
+        filtro = bson.M{"_id": id}
+    }
+
+    err := categoriaCollection.FindOne(ctx, filtro).Decode(&categoria)
+    if err == mongo.ErrNoDocuments {
+        return categoria, errCategoriaNaoEncontrada
+    }
+    return categoria, err
+}
+
+// descendentesCategoria retorna a categoria e todas as suas subcategorias
+func descendentesCategoria(ctx context.Context, categoria models.Categoria) ([]models.Categoria, error) {
+    cursor, err := categoriaCollection.Find(ctx, bson.M{"caminho": categoria.ID})
+    if err != nil {
+        return nil, err
+    }
+    var descendentes []models.Categoria
+    if err := cursor.All(ctx, &descendentes); err != nil {
+        return nil, err
+    }
+    return append([]models.Categoria{categoria}, descendentes...), nil
+}
+
+// resolverCategoria valida a categoria informada para um produto. Com o ID, a
+// categoria precisa existir e seu nome é copiado para o produto. Só com o
+// nome, o produto é vinculado à categoria de mesmo slug, se houver; caso
+// contrário o nome é mantido como texto livre, como nos cadastros antigos.
+func resolverCategoria(ctx context.Context, nome string, id *primitive.ObjectID) (string, *primitive.ObjectID, error) {
+    var ref string
+    switch {
+    case id != nil:
+        ref = id.Hex()
+    case nome != "":
+        ref = nome
+    default:
+        return "", nil, nil
+    }
+
+    categoria, err := buscarCategoria(ctx, ref)
+    if err == errCategoriaNaoEncontrada && id == nil {
+        return nome, nil, nil
+    }
+    if err != nil {
+        return "", nil, err
+    }
+    return categoria.Nome, &categoria.ID, nil
+}
+
+// GetCategorias lista as categorias em ordem alfabética ou, com arvore=true,
+// aninhadas a partir das categorias raiz
+func GetCategorias(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    cursor, err := categoriaCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"nome": 1}))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    categorias := []models.Categoria{}
+    if err := cursor.All(ctx, &categorias); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    if arvore, _ := strconv.ParseBool(c.Query("arvore")); !arvore {
+        c.JSON(http.StatusOK, categorias)
+        return
+    }
+
+    nos := make(map[primitive.ObjectID]*models.NoCategoria, len(categorias))
+    for _, categoria := range categorias {
+        nos[categoria.ID] = &models.NoCategoria{Categoria: categoria, Subcategorias: []*models.NoCategoria{}}
+    }
+    raizes := []*models.NoCategoria{}
+    for _, categoria := range categorias {
+        no := nos[categoria.ID]
+        if categoria.PaiID != nil {
+            if pai, ok := nos[*categoria.PaiID]; ok {
+                pai.Subcategorias = append(pai.Subcategorias, no)
+                continue
+            }
+        }
+        raizes = append(raizes, no)
+    }
+
+    c.JSON(http.StatusOK, raizes)
+}
+
+// GetCategoria retorna uma categoria pelo ID ou slug
+func GetCategoria(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    categoria, err := buscarCategoria(ctx, c.Param("id"))
+    if err == errCategoriaNaoEncontrada {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Categoria não encontrada"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, categoria)
+}
+
+// caminhoCategoria monta o caminho de uma categoria filha de paiID. Retorna
+// erro se o pai não existir ou se for a própria categoria (id) ou uma de
+// suas subcategorias, o que criaria um ciclo.
+func caminhoCategoria(ctx context.Context, paiID *primitive.ObjectID, id primitive.ObjectID) ([]primitive.ObjectID, error) {
+    if paiID == nil {
+        return []primitive.ObjectID{}, nil
+    }
+    if *paiID == id {
+        return nil, errors.New("uma categoria não pode ser pai de si mesma")
+    }
+
+    var pai models.Categoria
+    if err := categoriaCollection.FindOne(ctx, bson.M{"_id": paiID}).Decode(&pai); err != nil {
+        return nil, errors.New("categoria pai não encontrada")
+    }
+    for _, ancestral := range pai.Caminho {
+        if ancestral == id {
+            return nil, errors.New("uma categoria não pode ser movida para uma de suas subcategorias")
+        }
+    }
+    return append(pai.Caminho, pai.ID), nil
+}
+
+func CreateCategoria(c *gin.Context) {
+    var categoria models.Categoria
+    if err := c.ShouldBindJSON(&categoria); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    if categoria.Slug == "" {
+        categoria.Slug = categoria.Nome
+    }
+    categoria.Slug = slugCategoria(categoria.Slug)
+    if categoria.Slug == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Nome ou slug inválido"})
+        return
+    }
+    if err := validarAtributosCategoria(categoria.Atributos); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    categoria.ID = primitive.NewObjectID()
+    caminho, err := caminhoCategoria(ctx, categoria.PaiID, categoria.ID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    categoria.Caminho = caminho
+    categoria.DataCriacao = time.Now()
+    categoria.UltimaAtualizacao = categoria.DataCriacao
+
+    if _, err := categoriaCollection.InsertOne(ctx, categoria); err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Já existe uma categoria com este slug"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusCreated, categoria)
+}
+
+// UpdateCategoria altera nome, slug, descrição, pai e atributos da categoria. Ao mudar
+// o pai, o caminho das subcategorias é refeito; ao mudar o nome, os produtos
+// vinculados recebem o novo nome.
+func UpdateCategoria(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    var dados models.Categoria
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if dados.Slug == "" {
+        dados.Slug = dados.Nome
+    }
+    dados.Slug = slugCategoria(dados.Slug)
+    if dados.Slug == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Nome ou slug inválido"})
+        return
+    }
+    if err := validarAtributosCategoria(dados.Atributos); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    var atual models.Categoria
+    if err := categoriaCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&atual); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Categoria não encontrada"})
+        return
+    }
+
+    caminho, err := caminhoCategoria(ctx, dados.PaiID, id)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    campos := bson.M{
+        "nome":               dados.Nome,
+        "slug":               dados.Slug,
+        "descricao":          dados.Descricao,
+        "caminho":            caminho,
+        "ultima_atualizacao": time.Now(),
+    }
+    update := bson.M{"$set": campos}
+    if dados.PaiID != nil {
+        campos["pai_id"] = dados.PaiID
+    } else {
+        update["$unset"] = bson.M{"pai_id": ""}
+    }
+    // Os atributos só são alterados quando informados; a lista vazia os remove.
+    // Produtos já cadastrados são conferidos na próxima alteração.
+    if dados.Atributos != nil {
+        campos["atributos"] = dados.Atributos
+    }
+
+    if _, err := categoriaCollection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Já existe uma categoria com este slug"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    if !mesmoCaminho(atual.Caminho, caminho) {
+        if err := moverSubcategorias(ctx, id, caminho); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar subcategorias", "details": err.Error()})
+            return
+        }
+    }
+
+    if atual.Nome != dados.Nome {
+        update := bson.M{"$set": bson.M{"categoria": dados.Nome, "ultima_atualizacao": time.Now()}}
+        if _, err := collection.UpdateMany(ctx, bson.M{"categoria_id": id}, update); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar produtos", "details": err.Error()})
+            return
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Categoria atualizada com sucesso"})
+}
+
+func mesmoCaminho(a, b []primitive.ObjectID) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+// moverSubcategorias troca, no caminho de cada subcategoria, o trecho até a
+// categoria movida pelo novo caminho dela
+func moverSubcategorias(ctx context.Context, id primitive.ObjectID, caminho []primitive.ObjectID) error {
+    cursor, err := categoriaCollection.Find(ctx, bson.M{"caminho": id})
+    if err != nil {
+        return err
+    }
+    var subcategorias []models.Categoria
+    if err := cursor.All(ctx, &subcategorias); err != nil {
+        return err
+    }
+    if len(subcategorias) == 0 {
+        return nil
+    }
+
+    modelos := make([]mongo.WriteModel, 0, len(subcategorias))
+    for _, sub := range subcategorias {
+        for i, ancestral := range sub.Caminho {
+            if ancestral != id {
+                continue
+            }
+            novo := append(append([]primitive.ObjectID{}, caminho...), sub.Caminho[i:]...)
+            modelos = append(modelos, mongo.NewUpdateOneModel().
+                SetFilter(bson.M{"_id": sub.ID}).
+                SetUpdate(bson.M{"$set": bson.M{"caminho": novo}}))
+            break
+        }
+    }
+
+    _, err = categoriaCollection.BulkWrite(ctx, modelos, options.BulkWrite().SetOrdered(false))
+    return err
+}
+
+// DeleteCategoria remove uma categoria sem subcategorias nem produtos
+func DeleteCategoria(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if n, err := categoriaCollection.CountDocuments(ctx, bson.M{"pai_id": id}); err != nil || n > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "A categoria possui subcategorias"})
+        return
+    }
+    if n, err := collection.CountDocuments(ctx, bson.M{"categoria_id": id}); err != nil || n > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "A categoria possui produtos vinculados"})
+        return
+    }
+
+    result, err := categoriaCollection.DeleteOne(ctx, bson.M{"_id": id})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if result.DeletedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Categoria não encontrada"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Categoria removida com sucesso"})
+}
+
+// MigrarCategorias converte as categorias em texto livre dos produtos em
+// categorias cadastradas. Nomes com o mesmo slug ("Bebidas" e "bebidas")
+// passam a apontar para a mesma categoria, criada como raiz se não existir.
+func MigrarCategorias(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    nomes, err := collection.Distinct(ctx, "categoria", bson.M{
+        "categoria_id": bson.M{"$exists": false},
+        "categoria":    bson.M{"$nin": []interface{}{"", nil}},
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    criadas, vinculados := 0, int64(0)
+    for _, v := range nomes {
+        nome, ok := v.(string)
+        if !ok || slugCategoria(nome) == "" {
+            continue
+        }
+
+        categoria, err := buscarCategoria(ctx, nome)
+        if err == errCategoriaNaoEncontrada {
+            agora := time.Now()
+            categoria = models.Categoria{
+                ID:                primitive.NewObjectID(),
+                Nome:              nome,
+                Slug:              slugCategoria(nome),
+                Caminho:           []primitive.ObjectID{},
+                DataCriacao:       agora,
+                UltimaAtualizacao: agora,
+            }
+            _, err = categoriaCollection.InsertOne(ctx, categoria)
+            criadas++
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "criadas": criadas, "produtos_vinculados": vinculados})
+            return
+        }
+
+        result, err := collection.UpdateMany(ctx,
+            bson.M{"categoria": nome, "categoria_id": bson.M{"$exists": false}},
+            bson.M{"$set": bson.M{"categoria": categoria.Nome, "categoria_id": categoria.ID}})
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "criadas": criadas, "produtos_vinculados": vinculados})
+            return
+        }
+        vinculados += result.ModifiedCount
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":             "Migração concluída",
+        "criadas":             criadas,
+        "produtos_vinculados": vinculados,
+    })
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/auth"
+    "estoque-api/database"
+    "estoque-api/models"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var chaveAPICollection *mongo.Collection
+
+func inicializarChavesAPI() {
+    chaveAPICollection = database.DB.Collection("chaves_api")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    chaveAPICollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "hash", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "data_criacao", Value: -1}}},
+    })
+}
+
+// criarChaveAPI gera uma chave para o usuário. Sem validade informada a
+// chave não expira; a chave completa só aparece nesta resposta.
+func criarChaveAPI(c *gin.Context, userID primitive.ObjectID) {
+    var dados struct {
+        Nome         string     `json:"nome" binding:"required"`
+        Escopos      []string   `json:"escopos" binding:"required"`
+        ExpiraEm     *time.Time `json:"expira_em"`
+        ValidadeDias int        `json:"validade_dias"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o nome e os escopos da chave", "details": err.Error()})
+        return
+    }
+    if strings.TrimSpace(dados.Nome) == "" || len(dados.Escopos) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o nome e os escopos da chave"})
+        return
+    }
+
+    escopos := map[string]bool{}
+    for _, escopo := range dados.Escopos {
+        if _, ok := auth.EscoposChaveAPI[escopo]; !ok {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Escopo inválido: " + escopo, "escopos_validos": auth.EscoposChaveAPI})
+            return
+        }
+        escopos[escopo] = true
+    }
+    lista := make([]string, 0, len(escopos))
+    for escopo := range escopos {
+        lista = append(lista, escopo)
+    }
+    sort.Strings(lista)
+
+    agora := time.Now()
+    expira := dados.ExpiraEm
+    if expira == nil && dados.ValidadeDias > 0 {
+        t := agora.AddDate(0, 0, dados.ValidadeDias)
+        expira = &t
+    }
+    if expira != nil && !expira.After(agora) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "A data de expiração deve estar no futuro"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if err := userCollection.FindOne(ctx, bson.M{"_id": userID, "ativo": true}).Err(); err != nil {
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    chave, prefixo, hash, err := auth.GerarChaveAPI()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar a chave"})
+        return
+    }
+    registro := models.ChaveAPI{
+        ID:          primitive.NewObjectID(),
+        UserID:      userID,
+        Nome:        strings.TrimSpace(dados.Nome),
+        Prefixo:     prefixo,
+        Hash:        hash,
+        Escopos:     lista,
+        DataCriacao: agora,
+        CriadaPor:   c.GetString("userID"),
+        ExpiraEm:    expira,
+    }
+    if _, err := chaveAPICollection.InsertOne(ctx, registro); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusCreated, gin.H{
+        "chave":     chave,
+        "chave_api": registro,
+        "message":   "Guarde a chave: ela não será mostrada de novo. Envie-a no cabeçalho X-API-Key",
+    })
+}
+
+// listarChavesAPI lista as chaves do usuário, inclusive revogadas e
+// expiradas, sem o valor das chaves
+func listarChavesAPI(c *gin.Context, userID primitive.ObjectID) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    opts := options.Find().SetSort(bson.M{"data_criacao": -1})
+    cursor, err := chaveAPICollection.Find(ctx, bson.M{"user_id": userID}, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    chaves := []models.ChaveAPI{}
+    if err := cursor.All(ctx, &chaves); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, chaves)
+}
+
+// revogarChaveAPI desativa a chave do usuário imediatamente
+func revogarChaveAPI(c *gin.Context, userID primitive.ObjectID, idChave string) {
+    id, err := primitive.ObjectIDFromHex(idChave)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var chave models.ChaveAPI
+    err = chaveAPICollection.FindOneAndUpdate(ctx,
+        bson.M{"_id": id, "user_id": userID, "data_revogacao": bson.M{"$exists": false}},
+        bson.M{"$set": bson.M{"data_revogacao": time.Now()}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&chave)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Chave não encontrada ou já revogada"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, chave)
+}
+
+// idUsuarioRota lê o ID do usuário do parâmetro :id
+func idUsuarioRota(c *gin.Context) (primitive.ObjectID, bool) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return id, false
+    }
+    return id, true
+}
+
+// idUsuarioAutenticado lê o ID do usuário do token
+func idUsuarioAutenticado(c *gin.Context) (primitive.ObjectID, bool) {
+    id, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+        return id, false
+    }
+    return id, true
+}
+
+// GetEscoposChaveAPI lista os escopos disponíveis para as chaves
+func GetEscoposChaveAPI(c *gin.Context) {
+    c.JSON(http.StatusOK, auth.EscoposChaveAPI)
+}
+
+func GetMinhasChavesAPI(c *gin.Context) {
+    if id, ok := idUsuarioAutenticado(c); ok {
+        listarChavesAPI(c, id)
+    }
+}
+
+func CreateMinhaChaveAPI(c *gin.Context) {
+    if id, ok := idUsuarioAutenticado(c); ok {
+        criarChaveAPI(c, id)
+    }
+}
+
+func RevogarMinhaChaveAPI(c *gin.Context) {
+    if id, ok := idUsuarioAutenticado(c); ok {
+        revogarChaveAPI(c, id, c.Param("chave"))
+    }
+}
+
+// GetChavesAPIUsuario lista as chaves de um usuário ou conta de serviço
+func GetChavesAPIUsuario(c *gin.Context) {
+    if id, ok := idUsuarioRota(c); ok {
+        listarChavesAPI(c, id)
+    }
+}
+
+// CreateChaveAPIUsuario cria uma chave para um usuário, normalmente uma
+// conta de serviço, que não faz login
+func CreateChaveAPIUsuario(c *gin.Context) {
+    if id, ok := idUsuarioRota(c); ok {
+        criarChaveAPI(c, id)
+    }
+}
+
+func RevogarChaveAPIUsuario(c *gin.Context) {
+    if id, ok := idUsuarioRota(c); ok {
+        revogarChaveAPI(c, id, c.Param("chave"))
+    }
+}
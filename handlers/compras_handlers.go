@@ -0,0 +1,496 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/config"
+    "estoque-api/database"
+    "estoque-api/models"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var fornecedorCollection *mongo.Collection
+var pedidoCompraCollection *mongo.Collection
+
+// InitializeComprasHandlers inicializa as collections de fornecedores e pedidos de compra
+func InitializeComprasHandlers() {
+    fornecedorCollection = database.DB.Collection("fornecedores")
+    pedidoCompraCollection = database.DB.Collection("pedidos_compra")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    fornecedorCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys:    bson.M{"nome": 1},
+        Options: options.Index().SetUnique(true),
+    })
+}
+
+func GetFornecedores(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    cursor, err := fornecedorCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"nome": 1}))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    fornecedores := []models.Fornecedor{}
+    if err = cursor.All(ctx, &fornecedores); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, fornecedores)
+}
+
+func CreateFornecedor(c *gin.Context) {
+    var fornecedor models.Fornecedor
+    if err := c.ShouldBindJSON(&fornecedor); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if fornecedor.PrazoEntregaDias < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Prazo de entrega inválido"})
+        return
+    }
+
+    fornecedor.ID = primitive.NewObjectID()
+    fornecedor.DataCriacao = time.Now()
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if _, err := fornecedorCollection.InsertOne(ctx, fornecedor); err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Fornecedor já cadastrado"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusCreated, fornecedor)
+}
+
+func UpdateFornecedor(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    var fornecedor models.Fornecedor
+    if err := c.ShouldBindJSON(&fornecedor); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if fornecedor.PrazoEntregaDias < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Prazo de entrega inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    update := bson.M{"$set": bson.M{
+        "nome":               fornecedor.Nome,
+        "prazo_entrega_dias": fornecedor.PrazoEntregaDias,
+        "contato":            fornecedor.Contato,
+        "email":              fornecedor.Email,
+    }}
+    result, err := fornecedorCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Fornecedor não encontrado"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Fornecedor atualizado com sucesso"})
+}
+
+// GetPedidosCompra lista os pedidos de compra, opcionalmente filtrando por status
+func GetPedidosCompra(c *gin.Context) {
+    filtro := bson.M{}
+    if status := c.Query("status"); status != "" {
+        filtro["status"] = status
+    }
+    if fornecedor := c.Query("fornecedor"); fornecedor != "" {
+        filtro["fornecedor"] = fornecedor
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    cursor, err := pedidoCompraCollection.Find(ctx, filtro, options.Find().SetSort(bson.M{"data_criacao": -1}))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    pedidos := []models.PedidoCompra{}
+    if err = cursor.All(ctx, &pedidos); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, pedidos)
+}
+
+// CreatePedidoCompra registra um pedido a um fornecedor. Sem data_prevista,
+// a previsão de entrega usa o prazo cadastrado no fornecedor.
+func CreatePedidoCompra(c *gin.Context) {
+    var pedido models.PedidoCompra
+    if err := c.ShouldBindJSON(&pedido); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if len(pedido.Itens) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "O pedido deve ter ao menos um item"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    ids := make([]primitive.ObjectID, 0, len(pedido.Itens))
+    for i, item := range pedido.Itens {
+        if item.Quantidade <= 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Quantidade inválida", "item": i})
+            return
+        }
+        pedido.Itens[i].QuantidadeRecebida = 0
+        ids = append(ids, item.ProdutoID)
+    }
+
+    cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var produtos []models.Produto
+    if err := cursor.All(ctx, &produtos); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(produtos) != len(unicos(ids)) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Pedido contém produtos inexistentes"})
+        return
+    }
+
+    // Produtos com variantes são pedidos por variante
+    porID := make(map[primitive.ObjectID]models.Produto, len(produtos))
+    for _, p := range produtos {
+        porID[p.ID] = p
+    }
+    for i, item := range pedido.Itens {
+        produto := porID[item.ProdutoID]
+        if len(produto.Variantes) > 0 && varianteProduto(produto, item.VarianteSKU) == nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Informe uma variante_sku válida para o produto", "item": i})
+            return
+        }
+        if len(produto.Variantes) == 0 && item.VarianteSKU != "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "O produto não possui variantes", "item": i})
+            return
+        }
+
+        // Sem unidade, o item é pedido na unidade de compra do produto
+        unidade := item.Unidade
+        if unidade == "" {
+            unidade = produto.UnidadeCompra
+        }
+        if unidade == "" {
+            unidade = unidadeProduto(produto)
+        }
+        if _, err := converterQuantidade(produto, item.Quantidade, unidade); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "item": i})
+            return
+        }
+        fator, _ := fatorUnidade(produto, unidade)
+        pedido.Itens[i].Unidade = strings.ToLower(strings.TrimSpace(unidade))
+        pedido.Itens[i].Fator = fator
+    }
+
+    pedido.ID = primitive.NewObjectID()
+    pedido.Status = "aberto"
+    pedido.DataCriacao = time.Now()
+    pedido.DataRecebimento = time.Time{}
+    pedido.UsuarioID = usuarioAtual(c)
+    if pedido.DataPrevista.IsZero() {
+        pedido.DataPrevista = pedido.DataCriacao.AddDate(0, 0, prazoEntrega(ctx, pedido.Fornecedor))
+    }
+
+    if _, err := pedidoCompraCollection.InsertOne(ctx, pedido); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusCreated, pedido)
+}
+
+// ReceberPedidoCompra dá entrada no estoque dos itens de um pedido. O corpo é
+// opcional: sem itens, todo o saldo pendente do pedido é recebido. As
+// quantidades são informadas na unidade de cada item do pedido (por exemplo
+// caixas) e convertidas para a unidade do produto pelo fator do item.
+func ReceberPedidoCompra(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    var dados struct {
+        Itens []struct {
+            ProdutoID   primitive.ObjectID `json:"produto_id"`
+            VarianteSKU string             `json:"variante_sku"`
+            Quantidade  float64            `json:"quantidade"`
+        } `json:"itens"`
+    }
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&dados); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    var pedido models.PedidoCompra
+    if err := pedidoCompraCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&pedido); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Pedido não encontrado"})
+        return
+    }
+    if pedido.Status != "aberto" && pedido.Status != "parcial" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Pedido já " + pedido.Status})
+        return
+    }
+
+    // Itens são identificados pelo produto e, se houver, pela variante
+    type chaveItem struct {
+        ProdutoID   primitive.ObjectID
+        VarianteSKU string
+    }
+    receber := map[chaveItem]float64{}
+    if len(dados.Itens) == 0 {
+        for _, item := range pedido.Itens {
+            receber[chaveItem{item.ProdutoID, item.VarianteSKU}] += item.Quantidade - item.QuantidadeRecebida
+        }
+    } else {
+        for _, item := range dados.Itens {
+            if item.Quantidade <= 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Quantidade inválida"})
+                return
+            }
+            receber[chaveItem{item.ProdutoID, item.VarianteSKU}] += item.Quantidade
+        }
+    }
+
+    // Primeiro calcula o recebimento de cada item, sem tocar no estoque
+    type entradaItem struct {
+        Indice     int
+        Quantidade float64 // na unidade do item
+        Entrada    float64 // na unidade do produto
+    }
+    var entradas []entradaItem
+    statusAnterior := pedido.Status
+    filtro := bson.M{"_id": id, "status": bson.M{"$in": []string{"aberto", "parcial"}}}
+    completo := true
+    for i, item := range pedido.Itens {
+        // O pedido só é gravado se nenhum item mudou desde a leitura
+        filtro[fmt.Sprintf("itens.%d.quantidade_recebida", i)] = item.QuantidadeRecebida
+
+        pendente := item.Quantidade - item.QuantidadeRecebida
+        chave := chaveItem{item.ProdutoID, item.VarianteSKU}
+        quantidade := receber[chave]
+        if quantidade > pendente {
+            quantidade = pendente
+        }
+        receber[chave] -= quantidade
+        if quantidade > 0 && !unidadesMedida[item.Unidade] && !inteira(quantidade) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "A unidade " + item.Unidade + " não aceita quantidades fracionadas", "produto_id": item.ProdutoID.Hex()})
+            return
+        }
+
+        fator := item.Fator
+        if fator == 0 {
+            fator = 1
+        }
+        if quantidade > 0 {
+            entradas = append(entradas, entradaItem{i, quantidade, arredondarQuantidade(quantidade * fator)})
+            pedido.Itens[i].QuantidadeRecebida = arredondarQuantidade(item.QuantidadeRecebida + quantidade)
+        }
+        if pedido.Itens[i].QuantidadeRecebida < item.Quantidade {
+            completo = false
+        }
+    }
+
+    pedido.Status = "parcial"
+    if completo {
+        pedido.Status = "recebido"
+        pedido.DataRecebimento = time.Now()
+    }
+
+    // Grava o recebimento no pedido antes de movimentar o estoque: de dois
+    // recebimentos simultâneos só um encontra o pedido como foi lido
+    update := bson.M{"$set": bson.M{
+        "itens":            pedido.Itens,
+        "status":           pedido.Status,
+        "data_recebimento": pedido.DataRecebimento,
+    }}
+    result, err := pedidoCompraCollection.UpdateOne(ctx, filtro, update)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusConflict, gin.H{"error": "O pedido foi alterado por outra operação, tente novamente"})
+        return
+    }
+
+    usuarioID := usuarioAtual(c)
+    for n, e := range entradas {
+        item := pedido.Itens[e.Indice]
+        var produto models.Produto
+        var err error
+        if item.VarianteSKU != "" {
+            produto, err = movimentarVariante(ctx, item.ProdutoID, item.VarianteSKU, e.Entrada)
+        } else {
+            update := bson.M{
+                "$inc": bson.M{"estoque": e.Entrada},
+                "$set": bson.M{"ultima_atualizacao": time.Now()},
+            }
+            opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+            err = collection.FindOneAndUpdate(ctx, bson.M{"_id": item.ProdutoID}, update, opts).Decode(&produto)
+        }
+        if err != nil {
+            // Devolve ao pedido o saldo dos itens que não entraram no
+            // estoque, para que um novo recebimento os inclua
+            estorno := bson.M{}
+            for _, pendente := range entradas[n:] {
+                estorno[fmt.Sprintf("itens.%d.quantidade_recebida", pendente.Indice)] = -pendente.Quantidade
+            }
+            status := statusAnterior
+            if n > 0 {
+                status = "parcial"
+            }
+            if _, errEstorno := pedidoCompraCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+                "$inc":   estorno,
+                "$set":   bson.M{"status": status},
+                "$unset": bson.M{"data_recebimento": ""},
+            }); errEstorno != nil {
+                fmt.Printf("Erro ao estornar o recebimento do pedido %s: %v\n", id.Hex(), errEstorno)
+            }
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar estoque", "produto_id": item.ProdutoID.Hex()})
+            return
+        }
+        registrarMovimentacaoConvertida(ctx, produto, item.VarianteSKU, e.Entrada, e.Quantidade, item.Unidade, "compra", usuarioID)
+    }
+
+    c.JSON(http.StatusOK, pedido)
+}
+
+// CancelarPedidoCompra cancela o saldo ainda não recebido de um pedido
+func CancelarPedidoCompra(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    filtro := bson.M{"_id": id, "status": bson.M{"$in": []string{"aberto", "parcial"}}}
+    result, err := pedidoCompraCollection.UpdateOne(ctx, filtro, bson.M{"$set": bson.M{"status": "cancelado"}})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Pedido não encontrado ou já encerrado"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Pedido cancelado"})
+}
+
+// prazoEntrega retorna o prazo do fornecedor em dias, ou o prazo padrão
+// configurado em PRAZO_ENTREGA_PADRAO quando o fornecedor não está cadastrado
+func prazoEntrega(ctx context.Context, nome string) int {
+    var fornecedor models.Fornecedor
+    if err := fornecedorCollection.FindOne(ctx, bson.M{"nome": nome}).Decode(&fornecedor); err == nil && fornecedor.PrazoEntregaDias > 0 {
+        return fornecedor.PrazoEntregaDias
+    }
+    return prazoEntregaPadrao()
+}
+
+func prazoEntregaPadrao() int {
+    return config.GetInt("PRAZO_ENTREGA_PADRAO", 7)
+}
+
+// itemEstoque identifica o estoque de um produto ou, com SKU, de uma variante
+type itemEstoque struct {
+    ProdutoID primitive.ObjectID `bson:"produto"`
+    SKU       string             `bson:"sku"`
+}
+
+// estoqueEmPedido soma por produto e variante as quantidades pedidas e ainda
+// não recebidas, convertidas para a unidade do produto
+func estoqueEmPedido(ctx context.Context) (map[itemEstoque]float64, error) {
+    cursor, err := pedidoCompraCollection.Aggregate(ctx, []bson.M{
+        {"$match": bson.M{"status": bson.M{"$in": []string{"aberto", "parcial"}}}},
+        {"$unwind": "$itens"},
+        {"$group": bson.M{
+            "_id": bson.M{"produto": "$itens.produto_id", "sku": bson.M{"$ifNull": bson.A{"$itens.variante_sku", ""}}},
+            "quantidade": bson.M{"$sum": bson.M{"$multiply": []interface{}{
+                bson.M{"$subtract": []string{"$itens.quantidade", "$itens.quantidade_recebida"}},
+                bson.M{"$ifNull": []interface{}{"$itens.fator", 1}},
+            }}},
+        }},
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    var resultados []struct {
+        ID         itemEstoque `bson:"_id"`
+        Quantidade float64     `bson:"quantidade"`
+    }
+    if err := cursor.All(ctx, &resultados); err != nil {
+        return nil, err
+    }
+
+    emPedido := make(map[itemEstoque]float64, len(resultados))
+    for _, r := range resultados {
+        emPedido[r.ID] = r.Quantidade
+    }
+    return emPedido, nil
+}
+
+// unicos remove os IDs repetidos, mantendo a ordem. Retorna uma lista (e
+// não um mapa) para poder ser usada em filtros $in.
+func unicos(ids []primitive.ObjectID) []primitive.ObjectID {
+    vistos := make(map[primitive.ObjectID]bool, len(ids))
+    lista := make([]primitive.ObjectID, 0, len(ids))
+    for _, id := range ids {
+        if !vistos[id] {
+            vistos[id] = true
+            lista = append(lista, id)
+        }
+    }
+    return lista
+}
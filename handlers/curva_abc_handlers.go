@@ -0,0 +1,243 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/models"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// itemCurvaABC é a posição de um produto na curva ABC
+type itemCurvaABC struct {
+    ID                  string  `json:"id"`
+    CodigoBarras        string  `json:"codigo_barras"`
+    Nome                string  `json:"nome"`
+    Categoria           string  `json:"categoria"`
+    Quantidade          float64 `json:"quantidade"`
+    Unidade             string  `json:"unidade"`
+    Valor               float64 `json:"valor"`
+    Percentual          float64 `json:"percentual"`
+    PercentualAcumulado float64 `json:"percentual_acumulado"`
+    Classe              string  `json:"classe"`
+}
+
+// resumoClasseABC totaliza os produtos de uma classe
+type resumoClasseABC struct {
+    Produtos   int     `json:"produtos"`
+    Valor      float64 `json:"valor"`
+    Percentual float64 `json:"percentual"`
+}
+
+// parametrosCurvaABC lê os parâmetros comuns ao relatório e à gravação das
+// classes. Em caso de erro já responde e retorna false.
+func parametrosCurvaABC(c *gin.Context) (criterio string, corteA, corteB float64, inicio, fim time.Time, ok bool) {
+    criterio = c.DefaultQuery("criterio", "receita")
+    if criterio != "receita" && criterio != "consumo" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Critério inválido, use receita ou consumo"})
+        return
+    }
+
+    corteA, errA := strconv.ParseFloat(c.DefaultQuery("corte_a", "80"), 64)
+    corteB, errB := strconv.ParseFloat(c.DefaultQuery("corte_b", "95"), 64)
+    if errA != nil || errB != nil || corteA <= 0 || corteA >= corteB || corteB >= 100 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Cortes inválidos: use 0 < corte_a < corte_b < 100"})
+        return
+    }
+
+    inicio, fim, err := periodoRelatorio(c, 365)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    return criterio, corteA, corteB, inicio, fim, true
+}
+
+// RelatorioCurvaABC classifica os produtos em A, B e C pelo valor de saídas
+// no período. Parâmetros:
+//   - criterio: receita (apenas vendas, padrão) ou consumo (todas as saídas)
+//   - inicio, fim: período analisado (padrão: últimos 365 dias)
+//   - corte_a, corte_b: percentuais acumulados que limitam as classes A e B (padrão 80 e 95)
+//
+// A classe é gravada nos produtos por POST /relatorios/curva-abc/salvar.
+func RelatorioCurvaABC(c *gin.Context) {
+    criterio, corteA, corteB, inicio, fim, ok := parametrosCurvaABC(c)
+    if !ok {
+        return
+    }
+
+    itens, doCache, err := emCache(c, func(ctx context.Context) ([]itemCurvaABC, error) {
+        return calcularCurvaABC(ctx, filtroProdutos(c), criterio, inicio, fim, corteA, corteB)
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    meta := metaRelatorio(c, doCache, gin.H{
+        "criterio": criterio,
+        "periodo":  metaPeriodo(inicio, fim),
+        "cortes":   gin.H{"a": corteA, "b": corteB},
+    })
+    if formato := c.DefaultQuery("formato", "json"); formato != "json" {
+        linhas := make([]bson.M, len(itens))
+        for i, item := range itens {
+            linhas[i] = bson.M{
+                "id": item.ID, "codigo_barras": item.CodigoBarras, "nome": item.Nome,
+                "categoria": item.Categoria, "quantidade": item.Quantidade, "unidade": item.Unidade, "valor": item.Valor,
+                "percentual": item.Percentual, "percentual_acumulado": item.PercentualAcumulado,
+                "classe": item.Classe,
+            }
+        }
+        responderRelatorio(c, "curva_abc", []colunaRelatorio{
+            {"classe", "classe"},
+            {"id", "id"},
+            {"codigo_barras", "codigo_barras"},
+            {"nome", "nome"},
+            {"categoria", "categoria"},
+            {"quantidade", "quantidade"},
+            {"unidade", "unidade"},
+            {"valor", "valor"},
+            {"percentual", "percentual"},
+            {"percentual_acumulado", "percentual_acumulado"},
+        }, linhas, meta)
+        return
+    }
+
+    resumo := map[string]*resumoClasseABC{"A": {}, "B": {}, "C": {}}
+    for _, item := range itens {
+        r := resumo[item.Classe]
+        r.Produtos++
+        r.Valor += item.Valor
+        r.Percentual += item.Percentual
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "dados": gin.H{
+            "resumo":   resumo,
+            "produtos": itens,
+        },
+        "meta": meta,
+    })
+}
+
+// SalvarCurvaABC calcula a curva ABC com os mesmos parâmetros e filtros do
+// relatório e grava a classe em cada produto. O cache dos relatórios é
+// invalidado pelo middleware, pois a classe altera os filtros por classe_abc.
+func SalvarCurvaABC(c *gin.Context) {
+    criterio, corteA, corteB, inicio, fim, ok := parametrosCurvaABC(c)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    itens, err := calcularCurvaABC(ctx, filtroProdutos(c), criterio, inicio, fim, corteA, corteB)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if err := salvarClassesABC(ctx, itens); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gravar classes", "details": err.Error()})
+        return
+    }
+
+    resumo := map[string]int{"A": 0, "B": 0, "C": 0}
+    for _, item := range itens {
+        resumo[item.Classe]++
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "message":  "Classes gravadas",
+        "produtos": resumo,
+        "criterio": criterio,
+        "periodo":  metaPeriodo(inicio, fim),
+        "cortes":   gin.H{"a": corteA, "b": corteB},
+    })
+}
+
+// calcularCurvaABC soma o valor das saídas de cada produto no período e
+// atribui a classe pelo percentual acumulado, do maior para o menor valor.
+// Produtos sem saídas no período ficam na classe C.
+func calcularCurvaABC(ctx context.Context, filtro bson.M, criterio string, inicio, fim time.Time, corteA, corteB float64) ([]itemCurvaABC, error) {
+    var motivos []string
+    if criterio == "receita" {
+        motivos = []string{"venda"}
+    }
+
+    saidas, err := somarSaidas(ctx, inicio, fim, motivos...)
+    if err != nil {
+        return nil, err
+    }
+
+    cursor, err := collection.Find(ctx, filtro)
+    if err != nil {
+        return nil, err
+    }
+    var produtos []models.Produto
+    if err := cursor.All(ctx, &produtos); err != nil {
+        return nil, err
+    }
+
+    itens := make([]itemCurvaABC, 0, len(produtos))
+    total := 0.0
+    for _, p := range produtos {
+        item := itemCurvaABC{ID: p.ID.Hex(), CodigoBarras: p.CodigoBarras, Nome: p.Nome, Categoria: p.Categoria, Unidade: unidadeProduto(p)}
+        if s, ok := saidas[p.ID]; ok {
+            item.Quantidade = s.Quantidade
+            item.Valor = s.Valor
+        }
+        total += item.Valor
+        itens = append(itens, item)
+    }
+
+    sort.SliceStable(itens, func(i, j int) bool { return itens[i].Valor > itens[j].Valor })
+
+    acumulado := 0.0
+    for i := range itens {
+        if total > 0 {
+            itens[i].Percentual = itens[i].Valor / total * 100
+        }
+
+        // A classe é decidida pelo acumulado anterior ao item, para que um
+        // único produto que sozinho ultrapasse o corte ainda seja classe A
+        switch {
+        case itens[i].Valor > 0 && acumulado < corteA:
+            itens[i].Classe = "A"
+        case itens[i].Valor > 0 && acumulado < corteB:
+            itens[i].Classe = "B"
+        default:
+            itens[i].Classe = "C"
+        }
+
+        acumulado += itens[i].Percentual
+        itens[i].PercentualAcumulado = acumulado
+    }
+
+    return itens, nil
+}
+
+// salvarClassesABC grava a classe calculada em cada produto
+func salvarClassesABC(ctx context.Context, itens []itemCurvaABC) error {
+    if len(itens) == 0 {
+        return nil
+    }
+
+    modelos := make([]mongo.WriteModel, 0, len(itens))
+    for _, item := range itens {
+        id, _ := primitive.ObjectIDFromHex(item.ID)
+        modelos = append(modelos, mongo.NewUpdateOneModel().
+            SetFilter(bson.M{"_id": id}).
+            SetUpdate(bson.M{"$set": bson.M{"classe_abc": item.Classe}}))
+    }
+
+    _, err := collection.BulkWrite(ctx, modelos, options.BulkWrite().SetOrdered(false))
+    return err
+}
@@ -0,0 +1,581 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/auth"
+    "estoque-api/config"
+    "estoque-api/database"
+    "estoque-api/models"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Desafios do login em dois fatores, apagados pelo índice TTL ao expirar
+var desafioLoginCollection *mongo.Collection
+
+const (
+    validadeDesafioLogin         = 5 * time.Minute
+    tentativasDesafioLogin       = 5
+    codigosRecuperacaoPorUsuario = 10
+)
+
+func inicializarDoisFatores() {
+    desafioLoginCollection = database.DB.Collection("desafios_login")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    desafioLoginCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "hash", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {
+            Keys:    bson.D{{Key: "expira_em", Value: 1}},
+            Options: options.Index().SetExpireAfterSeconds(0),
+        },
+    })
+}
+
+// exigeDoisFatores informa se o perfil do usuário é obrigado a usar dois
+// fatores. DOIS_FATORES_ROLES lista os perfis (padrão admin,manager);
+// "nenhuma" torna os dois fatores opcionais para todos.
+func exigeDoisFatores(user models.User) bool {
+    for _, role := range strings.Split(config.Get("DOIS_FATORES_ROLES", "admin,manager"), ",") {
+        if strings.TrimSpace(role) == user.Role {
+            return true
+        }
+    }
+    return false
+}
+
+func doisFatoresAtivo(user models.User) bool {
+    return user.DoisFatores != nil && user.DoisFatores.Ativo
+}
+
+// novoSegredoPendente gera um segredo TOTP e o guarda como cadastro pendente
+// até que um código gerado com ele seja confirmado
+func novoSegredoPendente(ctx context.Context, user models.User) (gin.H, error) {
+    segredo, err := auth.GerarSegredoTOTP()
+    if err != nil {
+        return nil, err
+    }
+    _, err = userCollection.UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"dois_fatores.ativo": false, "dois_fatores.segredo_pendente": segredo}},
+    )
+    if err != nil {
+        return nil, err
+    }
+    return gin.H{
+        "segredo": segredo,
+        "uri":     auth.URITOTP(config.Get("DOIS_FATORES_EMISSOR", "Estoque API"), user.Email, segredo),
+    }, nil
+}
+
+// ativarDoisFatores confirma o cadastro pendente com um código válido e gera
+// os códigos de recuperação, retornados uma única vez
+func ativarDoisFatores(ctx context.Context, user models.User, codigo string) ([]string, bool, error) {
+    if user.DoisFatores == nil || user.DoisFatores.SegredoPendente == "" {
+        return nil, false, nil
+    }
+    segredo := user.DoisFatores.SegredoPendente
+    passo, ok := auth.VerificarTOTP(segredo, codigo, time.Now())
+    if !ok {
+        return nil, false, nil
+    }
+
+    codigos, hashes, err := auth.GerarCodigosRecuperacao(codigosRecuperacaoPorUsuario)
+    if err != nil {
+        return nil, false, err
+    }
+    agora := time.Now()
+    resultado, err := userCollection.UpdateOne(ctx,
+        bson.M{"_id": user.ID, "dois_fatores.segredo_pendente": segredo},
+        bson.M{"$set": bson.M{"dois_fatores": models.DoisFatores{
+            Ativo:              true,
+            Segredo:            segredo,
+            CodigosRecuperacao: hashes,
+            UltimoPasso:        passo,
+            DataAtivacao:       &agora,
+        }}},
+    )
+    if err != nil {
+        return nil, false, err
+    }
+    return codigos, resultado.ModifiedCount > 0, nil
+}
+
+// confirmarSegundoFator confere o código do autenticador ou, se não for um
+// código de 6 dígitos, um código de recuperação, que é consumido. O passo do
+// código aceito é gravado para que o mesmo código não seja aceito de novo.
+func confirmarSegundoFator(ctx context.Context, user models.User, codigo string) (bool, error) {
+    if !doisFatoresAtivo(user) {
+        return false, nil
+    }
+
+    if passo, ok := auth.VerificarTOTP(user.DoisFatores.Segredo, codigo, time.Now()); ok {
+        resultado, err := userCollection.UpdateOne(ctx,
+            bson.M{
+                "_id":                  user.ID,
+                "dois_fatores.segredo": user.DoisFatores.Segredo,
+                "$or": []bson.M{
+                    {"dois_fatores.ultimo_passo": bson.M{"$lt": passo}},
+                    {"dois_fatores.ultimo_passo": bson.M{"$exists": false}},
+                },
+            },
+            bson.M{"$set": bson.M{"dois_fatores.ultimo_passo": passo}},
+        )
+        if err != nil {
+            return false, err
+        }
+        return resultado.ModifiedCount > 0, nil
+    }
+
+    hash := auth.HashCodigoRecuperacao(codigo)
+    resultado, err := userCollection.UpdateOne(ctx,
+        bson.M{"_id": user.ID, "dois_fatores.codigos_recuperacao": hash},
+        bson.M{"$pull": bson.M{"dois_fatores.codigos_recuperacao": hash}},
+    )
+    if err != nil {
+        return false, err
+    }
+    if resultado.ModifiedCount > 0 {
+        fmt.Printf("Código de recuperação usado pelo usuário %s\n", user.ID.Hex())
+        return true, nil
+    }
+    return false, nil
+}
+
+// iniciarDesafioLogin responde ao login com senha correta de quem usa dois
+// fatores (tipo totp) ou precisa cadastrá-los (tipo cadastro), em vez de
+// emitir os tokens
+func iniciarDesafioLogin(ctx context.Context, c *gin.Context, user models.User) {
+    token, hash, err := auth.GenerateOpaqueToken()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
+        return
+    }
+
+    tipo := "totp"
+    mensagem := "Informe o código do aplicativo autenticador em POST /login/2fa"
+    if !doisFatoresAtivo(user) {
+        tipo = "cadastro"
+        mensagem = "O seu perfil exige autenticação em dois fatores: cadastre o autenticador em POST /login/2fa/cadastro e confirme o código em POST /login/2fa"
+    }
+
+    agora := time.Now()
+    desafio := models.DesafioLogin{
+        ID:          primitive.NewObjectID(),
+        UserID:      user.ID,
+        Hash:        hash,
+        Tipo:        tipo,
+        DataCriacao: agora,
+        ExpiraEm:    agora.Add(validadeDesafioLogin),
+    }
+    if _, err := desafioLoginCollection.InsertOne(ctx, desafio); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "desafio":   token,
+        "tipo":      tipo,
+        "expira_em": desafio.ExpiraEm,
+        "message":   mensagem,
+    })
+}
+
+// buscarDesafioLogin carrega o desafio válido e o usuário dele
+func buscarDesafioLogin(ctx context.Context, c *gin.Context, token string) (models.DesafioLogin, models.User, bool) {
+    var desafio models.DesafioLogin
+    var user models.User
+    err := desafioLoginCollection.FindOne(ctx, bson.M{
+        "hash":      auth.HashOpaqueToken(token),
+        "expira_em": bson.M{"$gt": time.Now()},
+    }).Decode(&desafio)
+    if err == nil {
+        err = userCollection.FindOne(ctx, bson.M{"_id": desafio.UserID, "ativo": true}).Decode(&user)
+    }
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Desafio inválido ou expirado, faça login novamente"})
+        return desafio, user, false
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return desafio, user, false
+    }
+    return desafio, user, true
+}
+
+// CadastroLoginDoisFatores gera o segredo do autenticador durante um desafio
+// do tipo cadastro. O QR code é gerado pelo cliente a partir da uri.
+func CadastroLoginDoisFatores(c *gin.Context) {
+    var dados struct {
+        Desafio string `json:"desafio" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o desafio"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    desafio, user, ok := buscarDesafioLogin(ctx, c, dados.Desafio)
+    if !ok {
+        return
+    }
+    if desafio.Tipo != "cadastro" {
+        c.JSON(http.StatusConflict, gin.H{"error": "A autenticação em dois fatores já está cadastrada"})
+        return
+    }
+
+    provisionamento, err := novoSegredoPendente(ctx, user)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, provisionamento)
+}
+
+// LoginDoisFatores conclui o login trocando o desafio e o código do
+// autenticador (ou um código de recuperação) pelos tokens da sessão. Nos
+// desafios de cadastro o código confirma o autenticador e a resposta traz
+// também os códigos de recuperação.
+func LoginDoisFatores(c *gin.Context) {
+    var dados struct {
+        Desafio string `json:"desafio" binding:"required"`
+        Codigo  string `json:"codigo" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o desafio e o codigo"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    desafio, user, ok := buscarDesafioLogin(ctx, c, dados.Desafio)
+    if !ok {
+        return
+    }
+
+    // O bloqueio da conta ou do IP vale também para o segundo fator
+    ip := c.ClientIP()
+    conta := chaveConta(user.Email)
+    bloqueadoAte, err := bloqueioLogin(ctx, conta, chaveIP(ip))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if !bloqueadoAte.IsZero() {
+        responderBloqueioLogin(c, bloqueadoAte)
+        return
+    }
+
+    // Cada verificação consome uma tentativa antes de conferir o código, para
+    // que requisições simultâneas não passem do limite
+    err = desafioLoginCollection.FindOneAndUpdate(ctx,
+        bson.M{"_id": desafio.ID, "tentativas": bson.M{"$lt": tentativasDesafioLogin}},
+        bson.M{"$inc": bson.M{"tentativas": 1}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&desafio)
+    if err == mongo.ErrNoDocuments {
+        desafioLoginCollection.DeleteOne(ctx, bson.M{"_id": desafio.ID})
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Desafio inválido ou expirado, faça login novamente"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    var codigos []string
+    if desafio.Tipo == "cadastro" {
+        codigos, ok, err = ativarDoisFatores(ctx, user, dados.Codigo)
+    } else {
+        ok, err = confirmarSegundoFator(ctx, user, dados.Codigo)
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if !ok {
+        // Códigos errados contam como falhas de login da conta e do IP; o
+        // desafio é descartado ao esgotar as tentativas
+        if desafio.Tentativas >= tentativasDesafioLogin {
+            desafioLoginCollection.DeleteOne(ctx, bson.M{"_id": desafio.ID})
+        }
+        falhasConta, errConta := registrarFalhaLogin(ctx, conta, maximoFalhasConta(), user.Email, ip)
+        falhasIP, errIP := registrarFalhaLogin(ctx, chaveIP(ip), maximoFalhasIP(), user.Email, ip)
+        if errConta != nil || errIP != nil {
+            fmt.Printf("Erro ao registrar falha de login: %v %v\n", errConta, errIP)
+        }
+        time.Sleep(atrasoFalhaLogin(max(falhasConta, falhasIP)))
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Código inválido"})
+        return
+    }
+
+    // O desafio vale uma única vez
+    resultado, err := desafioLoginCollection.DeleteOne(ctx, bson.M{"_id": desafio.ID})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if resultado.DeletedCount == 0 {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Desafio inválido ou expirado, faça login novamente"})
+        return
+    }
+
+    sessao, err := emitirSessao(ctx, user, primitive.NewObjectID())
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
+        return
+    }
+    userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"ultimo_acesso": time.Now()}})
+
+    if codigos != nil {
+        sessao["codigos_recuperacao"] = codigos
+    }
+    sessao["user"] = gin.H{
+        "id":    user.ID,
+        "nome":  user.Nome,
+        "email": user.Email,
+        "role":  user.Role,
+    }
+    c.JSON(http.StatusOK, sessao)
+}
+
+// usuarioAutenticado carrega o usuário do token da requisição
+func usuarioAutenticado(ctx context.Context, c *gin.Context) (models.User, bool) {
+    id, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+        return models.User{}, false
+    }
+    return buscarUsuario(ctx, c, id)
+}
+
+// GetDoisFatoresMe informa a situação dos dois fatores do próprio usuário
+func GetDoisFatoresMe(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    user, ok := usuarioAutenticado(ctx, c)
+    if !ok {
+        return
+    }
+    resposta := gin.H{
+        "ativo":       doisFatoresAtivo(user),
+        "obrigatorio": exigeDoisFatores(user),
+    }
+    if doisFatoresAtivo(user) {
+        resposta["data_ativacao"] = user.DoisFatores.DataAtivacao
+        resposta["codigos_recuperacao_restantes"] = len(user.DoisFatores.CodigosRecuperacao)
+    }
+    c.JSON(http.StatusOK, resposta)
+}
+
+// IniciarDoisFatores começa o cadastro do autenticador do próprio usuário
+func IniciarDoisFatores(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    user, ok := usuarioAutenticado(ctx, c)
+    if !ok {
+        return
+    }
+    if doisFatoresAtivo(user) {
+        c.JSON(http.StatusConflict, gin.H{"error": "A autenticação em dois fatores já está ativa"})
+        return
+    }
+
+    provisionamento, err := novoSegredoPendente(ctx, user)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, provisionamento)
+}
+
+// AtivarDoisFatores confirma o cadastro com um código do autenticador
+func AtivarDoisFatores(c *gin.Context) {
+    var dados struct {
+        Codigo string `json:"codigo" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o codigo"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    user, ok := usuarioAutenticado(ctx, c)
+    if !ok {
+        return
+    }
+    if doisFatoresAtivo(user) {
+        c.JSON(http.StatusConflict, gin.H{"error": "A autenticação em dois fatores já está ativa"})
+        return
+    }
+    if user.DoisFatores == nil || user.DoisFatores.SegredoPendente == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Inicie o cadastro em POST /me/2fa/iniciar"})
+        return
+    }
+    if reautenticacaoBloqueada(ctx, c, user) {
+        return
+    }
+
+    codigos, ok, err := ativarDoisFatores(ctx, user, dados.Codigo)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if !ok {
+        registrarFalhaReautenticacao(ctx, c, user)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Código inválido"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "message":             "Autenticação em dois fatores ativada. Guarde os códigos de recuperação: eles não serão mostrados de novo",
+        "codigos_recuperacao": codigos,
+    })
+}
+
+// DesativarDoisFatores remove os dois fatores do próprio usuário, pedindo a
+// senha e um código. Perfis que exigem dois fatores não podem desativá-los.
+func DesativarDoisFatores(c *gin.Context) {
+    var dados struct {
+        Senha  string `json:"senha" binding:"required"`
+        Codigo string `json:"codigo" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe a senha e o codigo"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    user, ok := usuarioAutenticado(ctx, c)
+    if !ok {
+        return
+    }
+    if exigeDoisFatores(user) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "A autenticação em dois fatores é obrigatória para o seu perfil"})
+        return
+    }
+    if !doisFatoresAtivo(user) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "A autenticação em dois fatores não está ativa"})
+        return
+    }
+    if !conferirSenhaAtual(ctx, c, user, dados.Senha, "Senha incorreta") {
+        return
+    }
+    confirmado, err := confirmarSegundoFator(ctx, user, dados.Codigo)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if !confirmado {
+        registrarFalhaReautenticacao(ctx, c, user)
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Código inválido"})
+        return
+    }
+
+    if _, err := userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"dois_fatores": ""}}); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Autenticação em dois fatores desativada"})
+}
+
+// RegerarCodigosRecuperacao substitui os códigos de recuperação, mediante um
+// código do autenticador. Os códigos anteriores deixam de valer.
+func RegerarCodigosRecuperacao(c *gin.Context) {
+    var dados struct {
+        Codigo string `json:"codigo" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o codigo"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    user, ok := usuarioAutenticado(ctx, c)
+    if !ok {
+        return
+    }
+    if !doisFatoresAtivo(user) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "A autenticação em dois fatores não está ativa"})
+        return
+    }
+    if reautenticacaoBloqueada(ctx, c, user) {
+        return
+    }
+    confirmado, err := confirmarSegundoFator(ctx, user, dados.Codigo)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if !confirmado {
+        registrarFalhaReautenticacao(ctx, c, user)
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Código inválido"})
+        return
+    }
+
+    codigos, hashes, err := auth.GerarCodigosRecuperacao(codigosRecuperacaoPorUsuario)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if _, err := userCollection.UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"dois_fatores.codigos_recuperacao": hashes}},
+    ); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"codigos_recuperacao": codigos})
+}
+
+// RedefinirDoisFatoresUsuario remove os dois fatores de um usuário que
+// perdeu o autenticador e os códigos de recuperação, encerrando as sessões
+// dele. Se o perfil exigir, o cadastro é pedido no próximo login.
+func RedefinirDoisFatoresUsuario(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    resultado, err := userCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"dois_fatores": ""}})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if resultado.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+        return
+    }
+    if err := encerrarSessoesUsuario(ctx, id, "2fa redefinida"); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Autenticação em dois fatores do usuário redefinida"})
+}
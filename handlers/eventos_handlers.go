@@ -0,0 +1,200 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/models"
+    "io"
+    "net/http"
+    "time"
+
+    "github.com/gin-contrib/sse"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Intervalo entre comentários de keep-alive enviados quando não há eventos
+const intervaloHeartbeat = 30 * time.Second
+
+// mudancaProduto representa um documento do change stream da coleção de produtos
+type mudancaProduto struct {
+    ID            bson.Raw        `bson:"_id"`
+    OperationType string          `bson:"operationType"`
+    FullDocument  *models.Produto `bson:"fullDocument"`
+    DocumentKey   struct {
+        ID primitive.ObjectID `bson:"_id"`
+    } `bson:"documentKey"`
+    UpdateDescription struct {
+        UpdatedFields bson.M   `bson:"updatedFields"`
+        RemovedFields []string `bson:"removedFields"`
+    } `bson:"updateDescription"`
+}
+
+// eventoProduto é o payload enviado ao cliente em cada evento SSE
+type eventoProduto struct {
+    Operacao        string          `json:"operacao"`
+    ProdutoID       string          `json:"produto_id"`
+    Produto         *models.Produto `json:"produto,omitempty"`
+    CamposAlterados bson.M          `json:"campos_alterados,omitempty"`
+    CamposRemovidos []string        `json:"campos_removidos,omitempty"`
+    Data            time.Time       `json:"data"`
+}
+
+// GetEventos transmite via Server-Sent Events as alterações em produtos e estoque.
+// O cliente pode retomar a partir do último evento recebido enviando o header
+// Last-Event-ID (ou o parâmetro ultimo_evento) com o id do evento.
+func GetEventos(c *gin.Context) {
+    role, _ := c.Get("role")
+    roleStr, _ := role.(string)
+
+    var categoria bson.M
+    if ref := c.Query("categoria"); ref != "" {
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        var err error
+        categoria, err = filtroCategoriaEventos(ctx, ref, c.Query("incluir_subcategorias") == "true")
+        cancel()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    pipeline := eventosPipeline(roleStr, categoria)
+    opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+
+    ultimoEvento := c.GetHeader("Last-Event-ID")
+    if ultimoEvento == "" {
+        ultimoEvento = c.Query("ultimo_evento")
+    }
+    if ultimoEvento != "" {
+        opts.SetResumeAfter(bson.M{"_data": ultimoEvento})
+    }
+
+    ctx := c.Request.Context()
+    stream, err := collection.Watch(ctx, pipeline, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao abrir fluxo de eventos", "details": err.Error()})
+        return
+    }
+    defer stream.Close(context.Background())
+
+    c.Header("Content-Type", "text/event-stream")
+    c.Header("Cache-Control", "no-cache")
+    c.Header("Connection", "keep-alive")
+    c.Header("X-Accel-Buffering", "no")
+
+    eventos := make(chan sse.Event)
+    go func() {
+        defer close(eventos)
+        for stream.Next(ctx) {
+            var mudanca mudancaProduto
+            if err := stream.Decode(&mudanca); err != nil {
+                continue
+            }
+
+            id, _ := mudanca.ID.Lookup("_data").StringValueOK()
+            evento := sse.Event{
+                Id:    id,
+                Event: tipoEvento(mudanca),
+                Data: eventoProduto{
+                    Operacao:        mudanca.OperationType,
+                    ProdutoID:       mudanca.DocumentKey.ID.Hex(),
+                    Produto:         mudanca.FullDocument,
+                    CamposAlterados: mudanca.UpdateDescription.UpdatedFields,
+                    CamposRemovidos: mudanca.UpdateDescription.RemovedFields,
+                    Data:            time.Now(),
+                },
+            }
+
+            select {
+            case eventos <- evento:
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+
+    heartbeat := time.NewTicker(intervaloHeartbeat)
+    defer heartbeat.Stop()
+
+    c.Stream(func(w io.Writer) bool {
+        select {
+        case evento, ok := <-eventos:
+            if !ok {
+                return false
+            }
+            c.Render(-1, evento)
+            return true
+        case <-heartbeat.C:
+            io.WriteString(w, ": ping\n\n")
+            return true
+        case <-ctx.Done():
+            return false
+        }
+    })
+}
+
+// filtroCategoriaEventos filtra os eventos pela categoria informada por ID,
+// slug ou nome, comparando o categoria_id do produto. Produtos ainda não
+// migrados são comparados pelo nome, e sem categoria cadastrada vale a
+// comparação exata com o nome livre, como em GetProdutosPorCategoria.
+func filtroCategoriaEventos(ctx context.Context, ref string, incluirSubcategorias bool) (bson.M, error) {
+    categoria, err := buscarCategoria(ctx, ref)
+    if err == errCategoriaNaoEncontrada {
+        return bson.M{"fullDocument.categoria": ref}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    categorias := []models.Categoria{categoria}
+    if incluirSubcategorias {
+        if categorias, err = descendentesCategoria(ctx, categoria); err != nil {
+            return nil, err
+        }
+    }
+    ids := make([]primitive.ObjectID, len(categorias))
+    nomes := make([]string, len(categorias))
+    for i, cat := range categorias {
+        ids[i], nomes[i] = cat.ID, cat.Nome
+    }
+    return bson.M{"$or": []bson.M{
+        {"fullDocument.categoria_id": bson.M{"$in": ids}},
+        {"fullDocument.categoria_id": bson.M{"$exists": false}, "fullDocument.categoria": bson.M{"$in": nomes}},
+    }}, nil
+}
+
+// eventosPipeline monta o filtro do change stream de acordo com a role do usuário
+// e o filtro de categoria. Usuários comuns não recebem eventos de produtos inativos.
+func eventosPipeline(role string, categoria bson.M) []bson.M {
+    filtros := []bson.M{
+        {"operationType": bson.M{"$in": []string{"insert", "update", "replace", "delete"}}},
+    }
+
+    if role != "admin" && role != "manager" {
+        filtros = append(filtros, bson.M{"$or": []bson.M{
+            {"operationType": "delete"},
+            {"fullDocument.status": bson.M{"$ne": "inativo"}},
+        }})
+    }
+
+    if categoria != nil {
+        filtros = append(filtros, bson.M{"$or": []bson.M{
+            {"operationType": "delete"},
+            categoria,
+        }})
+    }
+
+    return []bson.M{{"$match": bson.M{"$and": filtros}}}
+}
+
+// tipoEvento diferencia alterações de estoque das demais alterações do produto
+func tipoEvento(mudanca mudancaProduto) string {
+    if mudanca.OperationType == "update" {
+        if _, ok := mudanca.UpdateDescription.UpdatedFields["estoque"]; ok {
+            return "estoque"
+        }
+    }
+    return "produto"
+}
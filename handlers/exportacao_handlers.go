@@ -0,0 +1,164 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/models"
+    "estoque-api/planilhas"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Timeout da exportação completa, maior que o das consultas comuns pois o
+// catálogo inteiro é transmitido ao cliente
+const timeoutExportacao = 10 * time.Minute
+
+// Colunas exportadas para cada produto
+var colunasExportacaoProdutos = []string{
+    "id", "codigo_barras", "nome", "descricao", "categoria", "fornecedor", "deposito",
+    "preco", "preco_promocional", "estoque", "unidade", "status", "tags",
+    "data_criacao", "ultima_atualizacao",
+}
+
+func linhaExportacaoProduto(p models.Produto) []interface{} {
+    return []interface{}{
+        p.ID.Hex(), p.CodigoBarras, p.Nome, p.Descricao, p.Categoria, p.Fornecedor, p.Deposito,
+        p.Preco, p.PrecoPromocional, p.Estoque, unidadeProduto(p), p.Status, p.Tags,
+        p.DataCriacao, p.UltimaAtualizacao,
+    }
+}
+
+// ExportarProdutos transmite o catálogo no formato solicitado (csv, xlsx ou
+// jsonl), aplicando os mesmos filtros da listagem de produtos. Os documentos
+// são lidos do cursor e escritos um a um, sem carregar tudo em memória.
+func ExportarProdutos(c *gin.Context) {
+    formato := c.DefaultQuery("formato", "csv")
+    if !planilhas.FormatoSuportado(formato) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Formato não suportado, use csv, xlsx ou jsonl"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutExportacao)
+    defer cancel()
+
+    cursor, err := collection.Find(ctx, filtroProdutos(c))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    prepararDownload(c, "produtos", formato)
+    escritor, err := planilhas.NovoEscritor(formato, c.Writer, colunasExportacaoProdutos)
+    if err != nil {
+        c.AbortWithStatus(http.StatusInternalServerError)
+        return
+    }
+
+    for cursor.Next(ctx) {
+        var produto models.Produto
+        if err := cursor.Decode(&produto); err != nil {
+            // Pular o produto geraria um arquivo aparentemente completo sem ele
+            interromperDownload(c, fmt.Errorf("produto %v não pôde ser lido: %w", cursor.Current.Lookup("_id"), err))
+            return
+        }
+        if err := escritor.EscreverLinha(linhaExportacaoProduto(produto)); err != nil {
+            // O cliente desconectou; não há mais como reportar o erro
+            return
+        }
+    }
+    if err := cursor.Err(); err != nil {
+        interromperDownload(c, err)
+        return
+    }
+    escritor.Fechar()
+}
+
+// interromperDownload encerra a conexão sem finalizar o arquivo nem a
+// resposta. O status 200 já foi enviado, então essa é a única forma de o
+// cliente perceber que o download falhou: sem o bloco final da resposta
+// (e, no XLSX, sem o diretório do zip) o arquivo parcial é recusado.
+func interromperDownload(c *gin.Context, err error) {
+    fmt.Printf("Download interrompido em %s: %v\n", c.Request.URL.Path, err)
+    c.Abort()
+    if conexao, _, errHijack := c.Writer.Hijack(); errHijack == nil {
+        conexao.Close()
+    }
+}
+
+// prepararDownload define os headers de um arquivo para download
+func prepararDownload(c *gin.Context, nome, formato string) {
+    arquivo := fmt.Sprintf("%s_%s.%s", nome, time.Now().Format("20060102_150405"), formato)
+    c.Header("Content-Type", planilhas.ContentType(formato))
+    c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, arquivo))
+    c.Status(http.StatusOK)
+}
+
+// colunaRelatorio associa o título exibido na exportação ao campo do resultado
+type colunaRelatorio struct {
+    Titulo string
+    Campo  string
+}
+
+// responderRelatorio envia o resultado de um relatório em JSON (padrão), no
+// envelope {"dados": ..., "meta": ...}, ou no formato pedido pelo parâmetro
+// formato=csv|xlsx|jsonl (o PDF é tratado separadamente em relatorios_pdf.go)
+func responderRelatorio(c *gin.Context, nome string, colunas []colunaRelatorio, resultados []bson.M, meta gin.H) {
+    formato := c.DefaultQuery("formato", "json")
+    if formato == "json" {
+        if resultados == nil {
+            resultados = []bson.M{}
+        }
+        meta["total_registros"] = len(resultados)
+        c.JSON(http.StatusOK, gin.H{"dados": resultados, "meta": meta})
+        return
+    }
+    if !planilhas.FormatoSuportado(formato) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Formato não suportado, use json, csv, xlsx, jsonl ou pdf"})
+        return
+    }
+
+    titulos := make([]string, len(colunas))
+    for i, col := range colunas {
+        titulos[i] = col.Titulo
+    }
+
+    prepararDownload(c, nome, formato)
+    escritor, err := planilhas.NovoEscritor(formato, c.Writer, titulos)
+    if err != nil {
+        c.AbortWithStatus(http.StatusInternalServerError)
+        return
+    }
+
+    for _, r := range resultados {
+        linha := make([]interface{}, len(colunas))
+        for i, col := range colunas {
+            linha[i] = valorExportacao(r[col.Campo])
+        }
+        if err := escritor.EscreverLinha(linha); err != nil {
+            return
+        }
+    }
+    escritor.Fechar()
+}
+
+// valorExportacao converte tipos do driver do MongoDB em valores simples
+func valorExportacao(v interface{}) interface{} {
+    switch valor := v.(type) {
+    case primitive.ObjectID:
+        return valor.Hex()
+    case primitive.DateTime:
+        return valor.Time()
+    case primitive.A:
+        partes := make([]string, len(valor))
+        for i, p := range valor {
+            partes[i] = fmt.Sprint(valorExportacao(p))
+        }
+        return partes
+    }
+    return v
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+    "errors"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestInterromperDownload(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.GET("/completo", func(c *gin.Context) {
+        prepararDownload(c, "produtos", "csv")
+        c.Writer.WriteString("id,nome\n1,a\n")
+    })
+    r.GET("/interrompido", func(c *gin.Context) {
+        prepararDownload(c, "produtos", "csv")
+        c.Writer.WriteString("id,nome\n1,a\n")
+        c.Writer.Flush()
+        interromperDownload(c, errors.New("cursor expirou"))
+    })
+    servidor := httptest.NewServer(r)
+    defer servidor.Close()
+
+    resposta, err := http.Get(servidor.URL + "/completo")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := io.ReadAll(resposta.Body); err != nil {
+        t.Errorf("download completo falhou: %v", err)
+    }
+    resposta.Body.Close()
+
+    resposta, err = http.Get(servidor.URL + "/interrompido")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resposta.Body.Close()
+    if resposta.StatusCode != http.StatusOK {
+        t.Fatalf("status = %d", resposta.StatusCode)
+    }
+    if _, err := io.ReadAll(resposta.Body); err == nil {
+        t.Error("o cliente leu o download interrompido como completo")
+    }
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/models"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// indicadoresGiro reúne os indicadores de giro de um produto ou categoria.
+// Os ponteiros ficam nulos quando o indicador não pode ser calculado (por
+// exemplo, dias de cobertura sem nenhuma saída no período).
+type indicadoresGiro struct {
+    EstoqueInicial float64  `json:"estoque_inicial"`
+    EstoqueFinal   float64  `json:"estoque_final"`
+    EstoqueMedio   float64  `json:"estoque_medio"`
+    Saidas         float64  `json:"saidas"`
+    ValorSaidas    float64  `json:"valor_saidas"`
+    ConsumoDiario  float64  `json:"consumo_diario"`
+    Giro           *float64 `json:"giro"`
+    DiasEstoque    *float64 `json:"dias_estoque"`
+    DiasCobertura  *float64 `json:"dias_cobertura"`
+}
+
+// calcular preenche os indicadores derivados a partir dos saldos e saídas
+func (g *indicadoresGiro) calcular(dias float64) {
+    g.EstoqueMedio = (g.EstoqueInicial + g.EstoqueFinal) / 2
+    g.ConsumoDiario = g.Saidas / dias
+    g.Giro, g.DiasEstoque, g.DiasCobertura = nil, nil, nil
+
+    if g.EstoqueMedio > 0 {
+        giro := g.Saidas / g.EstoqueMedio
+        g.Giro = &giro
+    }
+    if g.Saidas > 0 {
+        diasEstoque := g.EstoqueMedio / g.ConsumoDiario
+        diasCobertura := g.EstoqueFinal / g.ConsumoDiario
+        g.DiasEstoque = &diasEstoque
+        g.DiasCobertura = &diasCobertura
+    }
+}
+
+type giroProduto struct {
+    ID           string `json:"id"`
+    CodigoBarras string `json:"codigo_barras"`
+    Nome         string `json:"nome"`
+    Categoria    string `json:"categoria"`
+    Unidade      string `json:"unidade"`
+    indicadoresGiro
+}
+
+type giroCategoria struct {
+    Categoria string `json:"categoria"`
+    Produtos  int    `json:"produtos"`
+    indicadoresGiro
+}
+
+// RelatorioGiroEstoque calcula giro, dias de estoque e dias de cobertura por
+// produto e por categoria no período (parâmetros inicio e fim, padrão de 90
+// dias). O estoque médio é a média entre os saldos do início e do fim do
+// período; a cobertura usa o saldo final e o consumo médio diário.
+func RelatorioGiroEstoque(c *gin.Context) {
+    inicio, fim, err := periodoRelatorio(c, 90)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    dias := fim.Sub(inicio).Hours() / 24
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    iniciais, err := saldosNaData(ctx, filtroProdutos(c), inicio)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    finais, err := saldosNaData(ctx, filtroProdutos(c), fim)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    saidas, err := somarSaidas(ctx, inicio, fim)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    saldoInicial := make(map[primitive.ObjectID]float64, len(iniciais))
+    for _, p := range iniciais {
+        saldoInicial[p.ID] = p.Estoque
+    }
+
+    // Produtos excluídos durante o período terminam com saldo zero, mas as
+    // saídas até a exclusão continuam no relatório
+    existentes := make(map[primitive.ObjectID]bool, len(finais))
+    for _, p := range finais {
+        existentes[p.ID] = true
+    }
+    for _, p := range iniciais {
+        if !existentes[p.ID] {
+            p.Estoque = 0
+            finais = append(finais, p)
+        }
+    }
+
+    produtos := make([]giroProduto, 0, len(finais))
+    porCategoria := map[string]*giroCategoria{}
+    for _, p := range finais {
+        g := giroProduto{ID: p.ID.Hex(), CodigoBarras: p.CodigoBarras, Nome: p.Nome, Categoria: p.Categoria, Unidade: unidadeProduto(p)}
+        g.EstoqueInicial = saldoInicial[p.ID]
+        g.EstoqueFinal = p.Estoque
+        g.Saidas = saidas[p.ID].Quantidade
+        g.ValorSaidas = saidas[p.ID].Valor
+        g.calcular(dias)
+        produtos = append(produtos, g)
+
+        cat, ok := porCategoria[p.Categoria]
+        if !ok {
+            cat = &giroCategoria{Categoria: p.Categoria}
+            porCategoria[p.Categoria] = cat
+        }
+        cat.Produtos++
+        cat.EstoqueInicial += g.EstoqueInicial
+        cat.EstoqueFinal += g.EstoqueFinal
+        cat.Saidas += g.Saidas
+        cat.ValorSaidas += g.ValorSaidas
+    }
+
+    categorias := make([]giroCategoria, 0, len(porCategoria))
+    for _, cat := range porCategoria {
+        cat.calcular(dias)
+        categorias = append(categorias, *cat)
+    }
+    sort.Slice(categorias, func(i, j int) bool { return categorias[i].Categoria < categorias[j].Categoria })
+
+    meta := metaRelatorio(c, false, gin.H{"periodo": metaPeriodo(inicio, fim), "dias": dias})
+    if formato := c.DefaultQuery("formato", "json"); formato != "json" {
+        linhas := make([]bson.M, len(produtos))
+        for i, g := range produtos {
+            linhas[i] = bson.M{
+                "id": g.ID, "codigo_barras": g.CodigoBarras, "nome": g.Nome, "categoria": g.Categoria,
+                "unidade": g.Unidade, "estoque_inicial": g.EstoqueInicial, "estoque_final": g.EstoqueFinal,
+                "estoque_medio": g.EstoqueMedio, "saidas": g.Saidas, "valor_saidas": g.ValorSaidas,
+                "giro": valorOpcional(g.Giro), "dias_estoque": valorOpcional(g.DiasEstoque),
+                "dias_cobertura": valorOpcional(g.DiasCobertura),
+            }
+        }
+        responderRelatorio(c, "giro_estoque", []colunaRelatorio{
+            {"id", "id"},
+            {"codigo_barras", "codigo_barras"},
+            {"nome", "nome"},
+            {"categoria", "categoria"},
+            {"unidade", "unidade"},
+            {"estoque_inicial", "estoque_inicial"},
+            {"estoque_final", "estoque_final"},
+            {"estoque_medio", "estoque_medio"},
+            {"saidas", "saidas"},
+            {"valor_saidas", "valor_saidas"},
+            {"giro", "giro"},
+            {"dias_estoque", "dias_estoque"},
+            {"dias_cobertura", "dias_cobertura"},
+        }, linhas, meta)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "dados": gin.H{
+            "produtos":   produtos,
+            "categorias": categorias,
+        },
+        "meta": meta,
+    })
+}
+
+// valorOpcional converte um indicador opcional para exportação
+func valorOpcional(v *float64) interface{} {
+    if v == nil {
+        return nil
+    }
+    return *v
+}
+
+// RelatorioEstoqueParado lista os produtos com saldo positivo e nenhuma saída
+// nos últimos N dias (parâmetro dias, padrão 90), ordenados pelo valor parado.
+// Produtos cadastrados dentro do período não são considerados parados.
+func RelatorioEstoqueParado(c *gin.Context) {
+    dias, err := strconv.Atoi(c.DefaultQuery("dias", "90"))
+    if err != nil || dias <= 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parâmetro dias inválido"})
+        return
+    }
+    limite := time.Now().AddDate(0, 0, -dias)
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    cursor, err := movimentacaoCollection.Aggregate(ctx, []bson.M{
+        {"$match": bson.M{"tipo": "saida", "motivo": bson.M{"$nin": motivosInternos}}},
+        {"$group": bson.M{"_id": "$produto_id", "ultima_saida": bson.M{"$max": "$data"}}},
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var ultimas []struct {
+        ID          primitive.ObjectID `bson:"_id"`
+        UltimaSaida time.Time          `bson:"ultima_saida"`
+    }
+    if err := cursor.All(ctx, &ultimas); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    ultimaSaida := make(map[primitive.ObjectID]time.Time, len(ultimas))
+    for _, u := range ultimas {
+        ultimaSaida[u.ID] = u.UltimaSaida
+    }
+
+    filtro := filtroProdutos(c)
+    filtro["estoque"] = bson.M{"$gt": 0}
+    cursor, err = collection.Find(ctx, filtro)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var produtos []models.Produto
+    if err := cursor.All(ctx, &produtos); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    linhas := []bson.M{}
+    valorTotal := 0.0
+    for _, p := range produtos {
+        ultima, vendeu := ultimaSaida[p.ID]
+        if vendeu && ultima.After(limite) {
+            continue
+        }
+        if !vendeu && p.DataCriacao.After(limite) {
+            continue
+        }
+
+        linha := bson.M{
+            "id": p.ID.Hex(), "codigo_barras": p.CodigoBarras, "nome": p.Nome, "categoria": p.Categoria,
+            "estoque": p.Estoque, "unidade": unidadeProduto(p), "preco": p.Preco, "valor": valorEstoque(p),
+            "ultima_saida": nil, "dias_sem_saida": nil,
+        }
+        if vendeu {
+            linha["ultima_saida"] = ultima
+            linha["dias_sem_saida"] = int(time.Since(ultima).Hours() / 24)
+        }
+        valorTotal += valorEstoque(p)
+        linhas = append(linhas, linha)
+    }
+    sort.SliceStable(linhas, func(i, j int) bool { return linhas[i]["valor"].(float64) > linhas[j]["valor"].(float64) })
+
+    meta := metaRelatorio(c, false, gin.H{"dias": dias, "valor_total": valorTotal})
+    if formato := c.DefaultQuery("formato", "json"); formato != "json" {
+        responderRelatorio(c, "estoque_parado", []colunaRelatorio{
+            {"id", "id"},
+            {"codigo_barras", "codigo_barras"},
+            {"nome", "nome"},
+            {"categoria", "categoria"},
+            {"estoque", "estoque"},
+            {"unidade", "unidade"},
+            {"preco", "preco"},
+            {"valor", "valor"},
+            {"ultima_saida", "ultima_saida"},
+            {"dias_sem_saida", "dias_sem_saida"},
+        }, linhas, meta)
+        return
+    }
+
+    meta["total_registros"] = len(linhas)
+    c.JSON(http.StatusOK, gin.H{"dados": linhas, "meta": meta})
+}
@@ -4,8 +4,9 @@ import (
     "context"
     "estoque-api/database"
     "estoque-api/models"
+    "fmt"
     "net/http"
-    "path/filepath"
+    "regexp"
     "strconv"
     "time"
 
@@ -13,13 +14,63 @@ import (
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var collection *mongo.Collection
 
+// Cópia dos produtos excluídos no estado da exclusão, usada para reconstruir
+// saldos de datas anteriores a ela
+var produtosExcluidosCollection *mongo.Collection
+
 // InitializeHandlers deve ser chamada após a conexão com o banco
 func InitializeHandlers() {
     collection = database.DB.Collection("produtos")
+    produtosExcluidosCollection = database.DB.Collection("produtos_excluidos")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    criarIndicesVariantes(ctx)
+    produtosExcluidosCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys: bson.D{{Key: "data_exclusao", Value: 1}},
+    })
+}
+
+// Campos de produto que podem ser filtrados por igualdade nas listagens
+var camposFiltroProdutos = []string{"categoria", "fornecedor", "status", "deposito", "classe_abc"}
+
+// filtroProdutos monta o filtro das listagens a partir dos parâmetros
+// opcionais categoria, fornecedor, status, deposito, classe_abc, q (busca
+// textual) e das especificações (esp[chave], esp_min[chave], esp_max[chave])
+func filtroProdutos(c *gin.Context) bson.M {
+    filtro := bson.M{}
+    for _, campo := range camposFiltroProdutos {
+        if v := c.Query(campo); v != "" {
+            filtro[campo] = v
+        }
+    }
+
+    if q := c.Query("q"); q != "" {
+        filtro["$or"] = condicoesBusca(q)
+    }
+    filtrarEspecificacoes(c, filtro)
+
+    return filtro
+}
+
+// condicoesBusca procura o texto, sem diferenciar maiúsculas, no nome,
+// descrição, tags e SKUs, e o código de barras exato. O texto é escapado:
+// a busca é por trecho, não por expressão regular.
+func condicoesBusca(q string) []bson.M {
+    padrao := regexp.QuoteMeta(q)
+    return []bson.M{
+        {"nome": bson.M{"$regex": padrao, "$options": "i"}},
+        {"descricao": bson.M{"$regex": padrao, "$options": "i"}},
+        {"tags": bson.M{"$regex": padrao, "$options": "i"}},
+        {"variantes.sku": bson.M{"$regex": padrao, "$options": "i"}},
+        {"variantes.codigo_barras": q},
+    }
 }
 
 func GetProdutos(c *gin.Context) {
@@ -27,7 +78,7 @@ func GetProdutos(c *gin.Context) {
     defer cancel()
 
     var produtos []models.Produto
-    cursor, err := collection.Find(ctx, bson.M{})
+    cursor, err := collection.Find(ctx, filtroProdutos(c))
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -39,6 +90,7 @@ func GetProdutos(c *gin.Context) {
         cursor.Decode(&produto)
         produtos = append(produtos, produto)
     }
+    prepararProdutos(ctx, produtos)
 
     c.JSON(http.StatusOK, produtos)
 }
@@ -54,6 +106,9 @@ func GetProduto(c *gin.Context) {
         c.JSON(http.StatusNotFound, gin.H{"error": "Produto não encontrado"})
         return
     }
+    lista := []models.Produto{produto}
+    prepararProdutos(ctx, lista)
+    produto = lista[0]
 
     c.JSON(http.StatusOK, produto)
 }
@@ -65,16 +120,68 @@ func CreateProduto(c *gin.Context) {
         return
     }
 
+    if err := validarVariantes(&produto); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err := validarUnidades(&produto); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
     produto.ID = primitive.NewObjectID()
+    produto.DataCriacao = time.Now()
+    produto.UltimaAtualizacao = produto.DataCriacao
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    _, err := collection.InsertOne(ctx, produto)
+    if err := validarComponentes(ctx, &produto); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    var err error
+    produto.Categoria, produto.CategoriaID, err = resolverCategoria(ctx, produto.Categoria, produto.CategoriaID)
+    if err == errCategoriaNaoEncontrada {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Categoria não encontrada"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    esquema, err := esquemaProduto(ctx, produto.CategoriaID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if produto.Especificacoes, err = validarEspecificacoes(esquema, produto.Especificacoes); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    _, err = collection.InsertOne(ctx, produto)
     if err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "SKU ou código de barras de variante já utilizado por outro produto"})
+            return
+        }
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
 
+    // O estoque inicial entra no histórico para que os saldos passados fiquem corretos
+    if len(produto.Variantes) == 0 {
+        registrarMovimentacao(ctx, produto, produto.Estoque, "cadastro", usuarioAtual(c))
+    }
+    saldo := produto
+    saldo.Estoque = 0
+    for _, v := range produto.Variantes {
+        saldo.Estoque += v.Estoque
+        registrarMovimentacaoVariante(ctx, saldo, v.SKU, v.Estoque, "cadastro", usuarioAtual(c))
+    }
+
     c.JSON(http.StatusCreated, produto)
 }
 
@@ -89,13 +196,105 @@ func UpdateProduto(c *gin.Context) {
         return
     }
 
-    update := bson.M{"$set": bson.M{"nome": produto.Nome, "preco": produto.Preco, "estoque": produto.Estoque}}
-    _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
-    if err != nil {
+    update := bson.M{"$set": bson.M{
+        "nome": produto.Nome,
+        "preco": produto.Preco,
+        "estoque": produto.Estoque,
+        "ultima_atualizacao": time.Now(),
+    }}
+    var existente models.Produto
+    collection.FindOne(ctx, bson.M{"_id": id}).Decode(&existente)
+
+    // Em produtos com variantes o estoque é a soma das variantes e só muda
+    // pelas movimentações de cada variante. Em kits só muda pela montagem,
+    // desmontagem e baixa, que movimentam os componentes.
+    estoqueMovimentado := len(existente.Variantes) > 0 || len(existente.Componentes) > 0
+    if estoqueMovimentado {
+        delete(update["$set"].(bson.M), "estoque")
+    }
+
+    // Unidade e conversões só são alteradas quando informadas, mas o estoque
+    // é sempre conferido contra a unidade resultante
+    unidades := existente
+    if produto.Unidade != "" {
+        unidades.Unidade = produto.Unidade
+    }
+    if produto.Conversoes != nil {
+        unidades.Conversoes = produto.Conversoes
+    }
+    if produto.UnidadeCompra != "" {
+        unidades.UnidadeCompra = produto.UnidadeCompra
+    }
+    if produto.UnidadeVenda != "" {
+        unidades.UnidadeVenda = produto.UnidadeVenda
+    }
+    if !estoqueMovimentado {
+        unidades.Estoque = produto.Estoque
+    }
+    if err := validarUnidades(&unidades); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    update["$set"].(bson.M)["unidade"] = unidades.Unidade
+    update["$set"].(bson.M)["conversoes"] = unidades.Conversoes
+    update["$set"].(bson.M)["unidade_compra"] = unidades.UnidadeCompra
+    update["$set"].(bson.M)["unidade_venda"] = unidades.UnidadeVenda
+
+    // A categoria só é alterada quando informada
+    categoriaID := existente.CategoriaID
+    alterarCategoria := produto.Categoria != "" || produto.CategoriaID != nil
+    if alterarCategoria {
+        var nome string
+        var err error
+        nome, categoriaID, err = resolverCategoria(ctx, produto.Categoria, produto.CategoriaID)
+        if err == errCategoriaNaoEncontrada {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Categoria não encontrada"})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        update["$set"].(bson.M)["categoria"] = nome
+        if categoriaID != nil {
+            update["$set"].(bson.M)["categoria_id"] = categoriaID
+        } else {
+            update["$unset"] = bson.M{"categoria_id": ""}
+        }
+    }
+
+    // As especificações são conferidas contra o esquema da categoria
+    // resultante sempre que elas ou a categoria forem informadas
+    if produto.Especificacoes != nil || alterarCategoria {
+        especificacoes := produto.Especificacoes
+        if especificacoes == nil {
+            especificacoes = existente.Especificacoes
+        }
+        esquema, err := esquemaProduto(ctx, categoriaID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if especificacoes, err = validarEspecificacoes(esquema, especificacoes); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        update["$set"].(bson.M)["especificacoes"] = especificacoes
+    }
+
+    var anterior models.Produto
+    err := collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update).Decode(&anterior)
+    if err != nil && err != mongo.ErrNoDocuments {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
 
+    if err == nil && !estoqueMovimentado && anterior.Estoque != produto.Estoque {
+        atual := anterior
+        atual.Nome, atual.Preco, atual.Estoque = produto.Nome, produto.Preco, produto.Estoque
+        registrarMovimentacao(ctx, atual, arredondarQuantidade(produto.Estoque-anterior.Estoque), "ajuste", usuarioAtual(c))
+    }
+
     c.JSON(http.StatusOK, gin.H{"message": "Produto atualizado com sucesso"})
 }
 
@@ -104,22 +303,66 @@ func DeleteProduto(c *gin.Context) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    _, err := collection.DeleteOne(ctx, bson.M{"_id": id})
-    if err != nil {
+    if recusarComponenteEmUso(ctx, c, id, "") {
+        return
+    }
+
+    var produto models.Produto
+    err := collection.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&produto)
+    if err != nil && err != mongo.ErrNoDocuments {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
+    if err == nil {
+        // Os relatórios de datas passadas ainda precisam do produto
+        agora := time.Now()
+        produto.DataExclusao = &agora
+        if _, err := produtosExcluidosCollection.InsertOne(ctx, produto); err != nil {
+            fmt.Printf("Erro ao guardar o produto excluído %s: %v\n", id.Hex(), err)
+        }
+    }
+    removerArquivosImagens(produto.Imagens...)
 
     c.JSON(http.StatusOK, gin.H{"message": "Produto removido com sucesso"})
 }
 
+// GetProdutosPorCategoria aceita o ID, o slug ou o nome da categoria. Com
+// incluir_subcategorias=true, traz também os produtos das subcategorias.
 func GetProdutosPorCategoria(c *gin.Context) {
-    categoria := c.Param("categoria")
+    ref := c.Param("categoria")
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
+    // Sem categoria cadastrada, mantém a comparação exata com o nome livre
+    filtro := bson.M{"categoria": ref}
+    categoria, err := buscarCategoria(ctx, ref)
+    if err != nil && err != errCategoriaNaoEncontrada {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if err == nil {
+        categorias := []models.Categoria{categoria}
+        if incluir, _ := strconv.ParseBool(c.Query("incluir_subcategorias")); incluir {
+            if categorias, err = descendentesCategoria(ctx, categoria); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+        }
+
+        ids := make([]primitive.ObjectID, len(categorias))
+        nomes := make([]string, len(categorias))
+        for i, cat := range categorias {
+            ids[i], nomes[i] = cat.ID, cat.Nome
+        }
+        // Produtos ainda não migrados são encontrados pelo nome
+        filtro = bson.M{"$or": []bson.M{
+            {"categoria_id": bson.M{"$in": ids}},
+            {"categoria_id": bson.M{"$exists": false}, "categoria": bson.M{"$in": nomes}},
+        }}
+    }
+
     var produtos []models.Produto
-    cursor, err := collection.Find(ctx, bson.M{"categoria": categoria})
+    cursor, err := collection.Find(ctx, filtro)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -131,19 +374,15 @@ func GetProdutosPorCategoria(c *gin.Context) {
         cursor.Decode(&produto)
         produtos = append(produtos, produto)
     }
+    prepararProdutos(ctx, produtos)
 
     c.JSON(http.StatusOK, produtos)
 }
 
 func BuscarProdutos(c *gin.Context) {
     query := c.Query("q")
-    filter := bson.M{
-        "$or": []bson.M{
-            {"nome": bson.M{"$regex": query, "$options": "i"}},
-            {"descricao": bson.M{"$regex": query, "$options": "i"}},
-            {"tags": bson.M{"$regex": query, "$options": "i"}},
-        },
-    }
+    filter := bson.M{"$or": condicoesBusca(query)}
+    filtrarEspecificacoes(c, filter)
 
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
@@ -161,6 +400,7 @@ func BuscarProdutos(c *gin.Context) {
         cursor.Decode(&produto)
         produtos = append(produtos, produto)
     }
+    prepararProdutos(ctx, produtos)
 
     c.JSON(http.StatusOK, produtos)
 }
@@ -168,8 +408,10 @@ func BuscarProdutos(c *gin.Context) {
 func AtualizarEstoque(c *gin.Context) {
     id, _ := primitive.ObjectIDFromHex(c.Param("id"))
     var dados struct {
-        Quantidade int    `json:"quantidade"`
-        Operacao   string `json:"operacao"` // "adicionar" ou "remover"
+        Quantidade float64 `json:"quantidade"`
+        Unidade    string  `json:"unidade"`  // padrão: unidade do produto
+        Operacao   string  `json:"operacao"` // "adicionar" ou "remover"
+        Motivo     string  `json:"motivo"`   // compra, venda, devolucao, ajuste, perda
     }
 
     if err := c.ShouldBindJSON(&dados); err != nil {
@@ -177,27 +419,67 @@ func AtualizarEstoque(c *gin.Context) {
         return
     }
 
+    if dados.Motivo == "" {
+        dados.Motivo = "ajuste"
+    }
+    if !motivosMovimentacao[dados.Motivo] {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Motivo inválido"})
+        return
+    }
+
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    var updateQuery bson.M
-    if dados.Operacao == "adicionar" {
-        updateQuery = bson.M{"$inc": bson.M{"estoque": dados.Quantidade}}
-    } else {
-        updateQuery = bson.M{"$inc": bson.M{"estoque": -dados.Quantidade}}
+    var produto models.Produto
+    if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&produto); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Produto não encontrado"})
+        return
+    }
+    if len(produto.Variantes) > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Produto com variantes: movimente o estoque de cada variante"})
+        return
+    }
+
+    delta, err := converterQuantidade(produto, dados.Quantidade, dados.Unidade)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if dados.Operacao != "adicionar" {
+        delta = -delta
+    }
+
+    if len(produto.Componentes) > 0 {
+        atualizarEstoqueKit(ctx, c, produto, delta, dados.Motivo)
+        return
+    }
+
+    updateQuery := bson.M{
+        "$inc": bson.M{"estoque": delta},
+        "$set": bson.M{"ultima_atualizacao": time.Now()},
     }
 
-    result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, updateQuery)
+    // As condições evitam movimentar um produto que passou a ter variantes
+    // ou componentes desde a leitura acima
+    opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+    filtro := bson.M{"_id": id, "variantes.0": bson.M{"$exists": false}, "componentes.0": bson.M{"$exists": false}}
+    err = collection.FindOneAndUpdate(ctx, filtro, updateQuery, opts).Decode(&produto)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusConflict, gin.H{"error": "O produto foi alterado, tente novamente"})
+        return
+    }
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{"message": "Estoque atualizado", "modificados": result.ModifiedCount})
+    registrarMovimentacaoConvertida(ctx, produto, "", delta, dados.Quantidade, dados.Unidade, dados.Motivo, usuarioAtual(c))
+
+    c.JSON(http.StatusOK, gin.H{"message": "Estoque atualizado", "modificados": 1, "estoque": produto.Estoque, "unidade": unidadeProduto(produto)})
 }
 
 func GetProdutosBaixoEstoque(c *gin.Context) {
-    limite, _ := strconv.Atoi(c.DefaultQuery("limite", "5"))
+    limite, _ := strconv.ParseFloat(c.DefaultQuery("limite", "5"), 64)
     
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
@@ -216,6 +498,16 @@ func GetProdutosBaixoEstoque(c *gin.Context) {
         produtos = append(produtos, produto)
     }
 
+    // Kits com poucos montados mas componentes suficientes não estão em falta
+    prepararProdutos(ctx, produtos)
+    emFalta := produtos[:0]
+    for _, produto := range produtos {
+        if produto.EstoqueDisponivel == nil || *produto.EstoqueDisponivel < limite {
+            emFalta = append(emFalta, produto)
+        }
+    }
+    produtos = emFalta
+
     c.JSON(http.StatusOK, produtos)
 }
 
@@ -251,145 +543,187 @@ func AtualizarPreco(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"message": "Preço atualizado", "modificados": result.ModifiedCount})
 }
 
-func UploadImagemProduto(c *gin.Context) {
-    id, _ := primitive.ObjectIDFromHex(c.Param("id"))
-    
-    // Recebe o arquivo
-    file, err := c.FormFile("imagem")
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo não encontrado"})
-        return
-    }
+// Parâmetros comuns a todos os relatórios: categoria, fornecedor, status,
+// deposito, classe_abc e q filtram os produtos; inicio e fim (YYYY-MM-DD)
+// delimitam o período dos relatórios baseados em movimentações; formato
+// escolhe entre json (padrão), csv, xlsx, jsonl e pdf. As respostas JSON
+// seguem o envelope {"dados": ..., "meta": ...} e os resultados ficam em
+// cache até a próxima alteração de produtos ou estoque.
 
-    // Gera um nome único para o arquivo
-    filename := id.Hex() + "_" + time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-    
-    // Salva o arquivo
-    if err := c.SaveUploadedFile(file, "uploads/"+filename); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
+func RelatorioEstoque(c *gin.Context) {
+    if data := c.Query("data"); data != "" {
+        relatorioEstoqueNaData(c, data)
         return
     }
 
-    // Atualiza o produto com a URL da imagem
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
-
-    update := bson.M{
-        "$set": bson.M{
-            "imagem_url": "/uploads/" + filename,
-            "ultima_atualizacao": time.Now(),
-        },
-    }
-
-    _, err = collection.UpdateOne(ctx, bson.M{"_id": id}, update)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if c.Query("formato") == "pdf" {
+        relatorioEstoqueAtualPDF(c)
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{"message": "Imagem atualizada", "url": "/uploads/" + filename})
-}
-
-func RelatorioEstoque(c *gin.Context) {
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
-
-    pipeline := []bson.M{
-        {
-            "$group": bson.M{
-                "_id": "$categoria",
-                "total_produtos": bson.M{"$sum": 1},
-                "total_estoque": bson.M{"$sum": "$estoque"},
-                "valor_total": bson.M{"$sum": bson.M{"$multiply": []interface{}{"$preco", "$estoque"}}},
+    resultados, doCache, err := emCache(c, func(ctx context.Context) ([]bson.M, error) {
+        pipeline := []bson.M{
+            {"$match": filtroProdutos(c)},
+            {
+                "$group": bson.M{
+                    "_id": "$categoria",
+                    "total_produtos": bson.M{"$sum": 1},
+                    "total_estoque": bson.M{"$sum": "$estoque"},
+                    "valor_total": bson.M{"$sum": valorEstoqueExpr},
+                },
             },
-        },
-    }
-
-    cursor, err := collection.Aggregate(ctx, pipeline)
+            {"$sort": bson.M{"_id": 1}},
+        }
+
+        cursor, err := collection.Aggregate(ctx, pipeline)
+        if err != nil {
+            return nil, err
+        }
+        defer cursor.Close(ctx)
+
+        var resultados []bson.M
+        err = cursor.All(ctx, &resultados)
+        return resultados, err
+    })
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
-    defer cursor.Close(ctx)
 
-    var resultados []bson.M
-    if err = cursor.All(ctx, &resultados); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-
-    c.JSON(http.StatusOK, resultados)
+    responderRelatorio(c, "relatorio_estoque", []colunaRelatorio{
+        {"categoria", "_id"},
+        {"total_produtos", "total_produtos"},
+        {"total_estoque", "total_estoque"},
+        {"valor_total", "valor_total"},
+    }, resultados, metaRelatorio(c, doCache, nil))
 }
 
+// RelatorioProdutosMaisVendidos ordena os produtos pela quantidade vendida
+// (movimentações de saída com motivo venda) no período, padrão de 30 dias
 func RelatorioProdutosMaisVendidos(c *gin.Context) {
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
-
     limite, _ := strconv.Atoi(c.DefaultQuery("limite", "10"))
+    if limite <= 0 {
+        limite = 10
+    }
 
-    // Aqui você precisaria ter uma coleção de vendas para fazer essa análise
-    // Este é um exemplo simplificado
-    pipeline := []bson.M{
-        {
-            "$sort": bson.M{"vendas_totais": -1},
-        },
-        {
-            "$limit": limite,
-        },
+    inicio, fim, err := periodoRelatorio(c, 30)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
     }
 
-    cursor, err := collection.Aggregate(ctx, pipeline)
+    resultados, doCache, err := emCache(c, func(ctx context.Context) ([]bson.M, error) {
+        pipeline := []bson.M{
+            {"$match": bson.M{"tipo": "saida", "motivo": "venda", "data": bson.M{"$gte": inicio, "$lt": fim}}},
+            {
+                "$group": bson.M{
+                    "_id": "$produto_id",
+                    "vendas_totais": bson.M{"$sum": bson.M{"$abs": "$quantidade"}},
+                    "receita": bson.M{"$sum": bson.M{"$multiply": []interface{}{bson.M{"$abs": "$quantidade"}, "$preco_unitario"}}},
+                },
+            },
+            {"$lookup": bson.M{"from": collection.Name(), "localField": "_id", "foreignField": "_id", "as": "produto"}},
+            {"$unwind": "$produto"},
+            {"$match": prefixarFiltro(filtroProdutos(c), "produto")},
+            {"$sort": bson.M{"vendas_totais": -1}},
+            {"$limit": limite},
+            {
+                "$project": bson.M{
+                    "vendas_totais": 1,
+                    "receita": 1,
+                    "codigo_barras": "$produto.codigo_barras",
+                    "nome": "$produto.nome",
+                    "categoria": "$produto.categoria",
+                    "estoque": "$produto.estoque",
+                    "preco": "$produto.preco",
+                },
+            },
+        }
+
+        cursor, err := movimentacaoCollection.Aggregate(ctx, pipeline)
+        if err != nil {
+            return nil, err
+        }
+        defer cursor.Close(ctx)
+
+        var resultados []bson.M
+        err = cursor.All(ctx, &resultados)
+        return resultados, err
+    })
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
-    defer cursor.Close(ctx)
 
-    var resultados []bson.M
-    if err = cursor.All(ctx, &resultados); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if c.Query("formato") == "pdf" {
+        relatorioMaisVendidosPDF(c, resultados)
         return
     }
 
-    c.JSON(http.StatusOK, resultados)
+    responderRelatorio(c, "produtos_mais_vendidos", []colunaRelatorio{
+        {"id", "_id"},
+        {"codigo_barras", "codigo_barras"},
+        {"nome", "nome"},
+        {"categoria", "categoria"},
+        {"vendas_totais", "vendas_totais"},
+        {"receita", "receita"},
+        {"estoque", "estoque"},
+        {"preco", "preco"},
+    }, resultados, metaRelatorio(c, doCache, gin.H{"periodo": metaPeriodo(inicio, fim), "limite": limite}))
 }
 
 func RelatorioValorTotalEstoque(c *gin.Context) {
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
-
-    pipeline := []bson.M{
-        {
-            "$group": bson.M{
-                "_id": nil,
-                "valor_total": bson.M{"$sum": bson.M{"$multiply": []interface{}{"$preco", "$estoque"}}},
-                "total_itens": bson.M{"$sum": "$estoque"},
-                "total_produtos": bson.M{"$sum": 1},
-            },
-        },
-    }
-
-    cursor, err := collection.Aggregate(ctx, pipeline)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if c.Query("formato") == "pdf" {
+        relatorioValorTotalPDF(c)
         return
     }
-    defer cursor.Close(ctx)
 
-    var resultado []bson.M
-    if err = cursor.All(ctx, &resultado); err != nil {
+    resultado, doCache, err := emCache(c, func(ctx context.Context) ([]bson.M, error) {
+        pipeline := []bson.M{
+            {"$match": filtroProdutos(c)},
+            {
+                "$group": bson.M{
+                    "_id": nil,
+                    "valor_total": bson.M{"$sum": valorEstoqueExpr},
+                    "total_itens": bson.M{"$sum": "$estoque"},
+                    "total_produtos": bson.M{"$sum": 1},
+                },
+            },
+            {"$project": bson.M{"_id": 0}},
+        }
+
+        cursor, err := collection.Aggregate(ctx, pipeline)
+        if err != nil {
+            return nil, err
+        }
+        defer cursor.Close(ctx)
+
+        var resultado []bson.M
+        err = cursor.All(ctx, &resultado)
+        return resultado, err
+    })
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
 
     if len(resultado) == 0 {
-        c.JSON(http.StatusOK, gin.H{
+        resultado = []bson.M{{
             "valor_total": 0,
             "total_itens": 0,
             "total_produtos": 0,
-        })
+        }}
+    }
+
+    meta := metaRelatorio(c, doCache, nil)
+    if formato := c.DefaultQuery("formato", "json"); formato != "json" {
+        responderRelatorio(c, "valor_total_estoque", []colunaRelatorio{
+            {"valor_total", "valor_total"},
+            {"total_itens", "total_itens"},
+            {"total_produtos", "total_produtos"},
+        }, resultado, meta)
         return
     }
 
-    c.JSON(http.StatusOK, resultado[0])
+    c.JSON(http.StatusOK, gin.H{"dados": resultado[0], "meta": meta})
 }
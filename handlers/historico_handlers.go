@@ -0,0 +1,241 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/models"
+    "net/http"
+    "sort"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// saldoCategoria totaliza os saldos históricos de uma categoria
+type saldoCategoria struct {
+    Categoria     string  `json:"categoria"`
+    TotalProdutos int     `json:"total_produtos"`
+    TotalEstoque  float64 `json:"total_estoque"`
+    ValorTotal    float64 `json:"valor_total"`
+}
+
+// saldoProduto é o saldo de um produto em uma data passada
+type saldoProduto struct {
+    ID           string  `json:"id"`
+    CodigoBarras string  `json:"codigo_barras"`
+    Nome         string  `json:"nome"`
+    Categoria    string  `json:"categoria"`
+    Estoque      float64 `json:"estoque"`
+    Unidade      string  `json:"unidade"`
+    Preco        float64 `json:"preco"`
+    Valor        float64 `json:"valor"`
+}
+
+// saldosNaData reconstrói o estoque dos produtos ao final do dia informado.
+// O saldo é calculado de trás para frente: estoque atual menos a soma das
+// movimentações posteriores à data. Assim produtos cadastrados antes da
+// existência do histórico também são atendidos. O preço usado na valorização
+// é o da última movimentação até a data, ou o preço atual se não houver; com
+// variantes, saldo e preço são reconstruídos para cada variante. Produtos
+// excluídos depois da data entram com o estoque que tinham na exclusão.
+func saldosNaData(ctx context.Context, filtro bson.M, fim time.Time) ([]models.Produto, error) {
+    // $not também inclui documentos antigos sem data_criacao
+    filtro["data_criacao"] = bson.M{"$not": bson.M{"$gte": fim}}
+
+    cursor, err := collection.Find(ctx, filtro)
+    if err != nil {
+        return nil, err
+    }
+    var produtos []models.Produto
+    if err := cursor.All(ctx, &produtos); err != nil {
+        return nil, err
+    }
+
+    filtro["data_exclusao"] = bson.M{"$gte": fim}
+    cursor, err = produtosExcluidosCollection.Find(ctx, filtro)
+    delete(filtro, "data_exclusao")
+    if err != nil {
+        return nil, err
+    }
+    var excluidos []models.Produto
+    if err := cursor.All(ctx, &excluidos); err != nil {
+        return nil, err
+    }
+    produtos = append(produtos, excluidos...)
+    sort.SliceStable(produtos, func(i, j int) bool {
+        if produtos[i].Categoria != produtos[j].Categoria {
+            return produtos[i].Categoria < produtos[j].Categoria
+        }
+        return produtos[i].Nome < produtos[j].Nome
+    })
+
+    // Somas e preços são separados por variante (SKU vazio para o produto
+    // sem variantes), para que cada variante tenha o próprio saldo e preço
+    type chaveSaldo struct {
+        ProdutoID primitive.ObjectID `bson:"produto_id"`
+        SKU       string             `bson:"sku"`
+    }
+    chaveGrupo := bson.M{"produto_id": "$produto_id", "sku": bson.M{"$ifNull": bson.A{"$variante_sku", ""}}}
+
+    posteriores := map[primitive.ObjectID]float64{}
+    posterioresVariante := map[chaveSaldo]float64{}
+    cursor, err = movimentacaoCollection.Aggregate(ctx, []bson.M{
+        {"$match": bson.M{"data": bson.M{"$gte": fim}}},
+        {"$group": bson.M{"_id": chaveGrupo, "quantidade": bson.M{"$sum": "$quantidade"}}},
+    })
+    if err != nil {
+        return nil, err
+    }
+    var somas []struct {
+        ID         chaveSaldo `bson:"_id"`
+        Quantidade float64    `bson:"quantidade"`
+    }
+    if err := cursor.All(ctx, &somas); err != nil {
+        return nil, err
+    }
+    for _, s := range somas {
+        posteriores[s.ID.ProdutoID] += s.Quantidade
+        posterioresVariante[s.ID] += s.Quantidade
+    }
+
+    precos := map[chaveSaldo]float64{}
+    cursor, err = movimentacaoCollection.Aggregate(ctx, []bson.M{
+        {"$match": bson.M{"data": bson.M{"$lt": fim}}},
+        {"$sort": bson.M{"data": -1}},
+        {"$group": bson.M{"_id": chaveGrupo, "preco": bson.M{"$first": "$preco_unitario"}}},
+    })
+    if err != nil {
+        return nil, err
+    }
+    var ultimos []struct {
+        ID    chaveSaldo `bson:"_id"`
+        Preco float64    `bson:"preco"`
+    }
+    if err := cursor.All(ctx, &ultimos); err != nil {
+        return nil, err
+    }
+    for _, u := range ultimos {
+        precos[u.ID] = u.Preco
+    }
+
+    for i := range produtos {
+        p := &produtos[i]
+        p.Estoque = arredondarQuantidade(p.Estoque - posteriores[p.ID])
+        if preco, ok := precos[chaveSaldo{p.ID, ""}]; ok {
+            p.Preco = preco
+        }
+        for j := range p.Variantes {
+            v := &p.Variantes[j]
+            chave := chaveSaldo{p.ID, v.SKU}
+            v.Estoque = arredondarQuantidade(v.Estoque - posterioresVariante[chave])
+            if preco, ok := precos[chave]; ok {
+                v.Preco = &preco
+            }
+        }
+    }
+
+    return produtos, nil
+}
+
+// relatorioEstoqueNaData responde /relatorios/estoque?data=YYYY-MM-DD com os
+// saldos e a valorização por produto e por categoria ao final daquele dia
+func relatorioEstoqueNaData(c *gin.Context, data string) {
+    dia, err := time.ParseInLocation("2006-01-02", data, time.Local)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Data inválida, use o formato YYYY-MM-DD"})
+        return
+    }
+    fim := dia.AddDate(0, 0, 1)
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    produtos, err := saldosNaData(ctx, filtroProdutos(c), fim)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    formato := c.DefaultQuery("formato", "json")
+    if formato == "pdf" {
+        i := 0
+        relatorioEstoquePDF(c, "Relatório de Estoque em "+dia.Format("02/01/2006"), func() (models.Produto, bool) {
+            if i >= len(produtos) {
+                return models.Produto{}, false
+            }
+            i++
+            return produtos[i-1], true
+        })
+        return
+    }
+
+    saldos := make([]saldoProduto, 0, len(produtos))
+    porCategoria := map[string]*saldoCategoria{}
+    total := saldoCategoria{Categoria: "total"}
+    for _, p := range produtos {
+        s := saldoProduto{
+            ID:           p.ID.Hex(),
+            CodigoBarras: p.CodigoBarras,
+            Nome:         p.Nome,
+            Categoria:    p.Categoria,
+            Estoque:      p.Estoque,
+            Unidade:      unidadeProduto(p),
+            Preco:        p.Preco,
+            Valor:        valorEstoque(p),
+        }
+        saldos = append(saldos, s)
+
+        cat, ok := porCategoria[p.Categoria]
+        if !ok {
+            cat = &saldoCategoria{Categoria: p.Categoria}
+            porCategoria[p.Categoria] = cat
+        }
+        for _, t := range []*saldoCategoria{cat, &total} {
+            t.TotalProdutos++
+            t.TotalEstoque += s.Estoque
+            t.ValorTotal += s.Valor
+        }
+    }
+
+    categorias := make([]saldoCategoria, 0, len(porCategoria))
+    for _, cat := range porCategoria {
+        categorias = append(categorias, *cat)
+    }
+    sort.Slice(categorias, func(i, j int) bool { return categorias[i].Categoria < categorias[j].Categoria })
+
+    meta := metaRelatorio(c, false, gin.H{"data": dia.Format("2006-01-02")})
+    if formato != "json" {
+        linhas := make([]bson.M, len(saldos))
+        for i, s := range saldos {
+            linhas[i] = bson.M{
+                "id": s.ID, "codigo_barras": s.CodigoBarras, "nome": s.Nome, "categoria": s.Categoria,
+                "estoque": s.Estoque, "unidade": s.Unidade, "preco": s.Preco, "valor": s.Valor,
+            }
+        }
+        responderRelatorio(c, "relatorio_estoque_"+dia.Format("20060102"), []colunaRelatorio{
+            {"id", "id"},
+            {"codigo_barras", "codigo_barras"},
+            {"nome", "nome"},
+            {"categoria", "categoria"},
+            {"estoque", "estoque"},
+            {"unidade", "unidade"},
+            {"preco", "preco"},
+            {"valor", "valor"},
+        }, linhas, meta)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "dados": gin.H{
+            "produtos":   saldos,
+            "categorias": categorias,
+            "total": gin.H{
+                "total_produtos": total.TotalProdutos,
+                "total_estoque":  total.TotalEstoque,
+                "valor_total":    total.ValorTotal,
+            },
+        },
+        "meta": meta,
+    })
+}
@@ -0,0 +1,611 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "estoque-api/armazenamento"
+    "estoque-api/config"
+    "estoque-api/imagens"
+    "estoque-api/models"
+    "fmt"
+    "io"
+    "log"
+    "mime"
+    "mime/multipart"
+    "net/http"
+    "os"
+    "path"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Miniaturas geradas para cada imagem, pelo lado máximo em pixels
+var tamanhosMiniatura = []struct {
+    Nome string
+    Lado int
+}{
+    {"pequena", 150},
+    {"media", 400},
+    {"grande", 800},
+}
+
+// Arquivos sem referência só são removidos depois deste prazo, para não
+// apagar uploads em andamento
+const carenciaArquivosOrfaos = time.Hour
+
+// Nome dos arquivos gravados pelo upload antigo, de imagem única
+var arquivoImagemAntigo = regexp.MustCompile(`^[0-9a-f]{24}_\d{14}\.[A-Za-z0-9]+$`)
+
+// tamanhoMaximoImagem é o limite de cada arquivo enviado, em bytes
+func tamanhoMaximoImagem() int64 {
+    return int64(config.GetInt("IMAGEM_TAMANHO_MAXIMO", 5<<20))
+}
+
+func dimensaoMaximaImagem() int {
+    return config.GetInt("IMAGEM_DIMENSAO_MAXIMA", 8000)
+}
+
+func maximoImagensProduto() int {
+    return config.GetInt("IMAGENS_POR_PRODUTO", 10)
+}
+
+// Backend onde ficam os arquivos das imagens (ARMAZENAMENTO: local ou s3)
+var armazenamentoImagens armazenamento.Armazenamento
+
+// InitializeImagemHandlers configura o armazenamento das imagens
+func InitializeImagemHandlers() {
+    var err error
+    armazenamentoImagens, err = armazenamento.Novo(config.Get("ARMAZENAMENTO", "local"))
+    if err != nil {
+        log.Fatal(err)
+    }
+}
+
+// enderecoUpload é o endereço gravado em imagem_url. Ele identifica o
+// arquivo independentemente do backend; a URL de download, assinada, é
+// montada a cada resposta por urlUpload.
+func enderecoUpload(chave string) string {
+    return "/uploads/" + chave
+}
+
+// urlUpload retorna a URL de download assinada do arquivo
+func urlUpload(chave string) string {
+    return armazenamentoImagens.URL(chave, armazenamento.ValidadeURL())
+}
+
+// tipoArquivo deduz o tipo de conteúdo pela extensão da chave
+func tipoArquivo(chave string) string {
+    return mime.TypeByExtension(path.Ext(chave))
+}
+
+func gravarUpload(ctx context.Context, chave string, dados []byte, tipoConteudo string) error {
+    return armazenamentoImagens.Gravar(ctx, chave, dados, tipoConteudo)
+}
+
+// arquivosImagem lista o arquivo original e as miniaturas da imagem
+func arquivosImagem(imagem models.ImagemProduto) []string {
+    arquivos := []string{imagem.Arquivo}
+    for _, chave := range imagem.Miniaturas {
+        arquivos = append(arquivos, chave)
+    }
+    return arquivos
+}
+
+// removerArquivosImagens apaga os arquivos das imagens. Falhas são apenas
+// registradas: o arquivo que sobrar é removido pela limpeza de órfãos.
+func removerArquivosImagens(lista ...models.ImagemProduto) {
+    for _, imagem := range lista {
+        for _, chave := range arquivosImagem(imagem) {
+            ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+            err := armazenamentoImagens.Remover(ctx, chave)
+            cancel()
+            if err != nil {
+                fmt.Printf("Erro ao remover o arquivo %s: %v\n", chave, err)
+            }
+        }
+    }
+}
+
+// preencherURLsImagens monta as URLs das imagens dos produtos da resposta
+func preencherURLsImagens(produtos []models.Produto) {
+    for i := range produtos {
+        for j := range produtos[i].Imagens {
+            imagem := &produtos[i].Imagens[j]
+            imagem.URL = urlUpload(imagem.Arquivo)
+            imagem.URLsMiniaturas = make(map[string]string, len(imagem.Miniaturas))
+            for tamanho, chave := range imagem.Miniaturas {
+                imagem.URLsMiniaturas[tamanho] = urlUpload(chave)
+            }
+            if imagem.Principal {
+                produtos[i].ImagemURL = imagem.URL
+            }
+        }
+        // Produtos com a imagem do upload antigo, fora da galeria
+        if len(produtos[i].Imagens) == 0 && strings.HasPrefix(produtos[i].ImagemURL, "/uploads/") {
+            produtos[i].ImagemURL = urlUpload(strings.TrimPrefix(produtos[i].ImagemURL, "/uploads/"))
+        }
+    }
+}
+
+// prepararProdutos completa os campos calculados dos produtos da resposta:
+// a disponibilidade dos kits e as URLs das imagens
+func prepararProdutos(ctx context.Context, produtos []models.Produto) {
+    preencherDisponibilidadeKits(ctx, produtos)
+    preencherURLsImagens(produtos)
+}
+
+// lerImagem lê o arquivo enviado respeitando o limite de tamanho e valida o
+// conteúdo. Retorna o status HTTP adequado em caso de erro.
+func lerImagem(arquivo *multipart.FileHeader) ([]byte, *imagens.Imagem, int, error) {
+    maximo := tamanhoMaximoImagem()
+    if arquivo.Size > maximo {
+        return nil, nil, http.StatusRequestEntityTooLarge, fmt.Errorf("%s: excede o limite de %d bytes", arquivo.Filename, maximo)
+    }
+
+    f, err := arquivo.Open()
+    if err != nil {
+        return nil, nil, http.StatusBadRequest, fmt.Errorf("%s: %v", arquivo.Filename, err)
+    }
+    defer f.Close()
+
+    dados, err := io.ReadAll(io.LimitReader(f, maximo+1))
+    if err != nil {
+        return nil, nil, http.StatusBadRequest, fmt.Errorf("%s: %v", arquivo.Filename, err)
+    }
+    if int64(len(dados)) > maximo {
+        return nil, nil, http.StatusRequestEntityTooLarge, fmt.Errorf("%s: excede o limite de %d bytes", arquivo.Filename, maximo)
+    }
+
+    img, err := imagens.Decodificar(dados, dimensaoMaximaImagem())
+    if err != nil {
+        return nil, nil, http.StatusBadRequest, fmt.Errorf("%s: %v", arquivo.Filename, err)
+    }
+    return dados, img, 0, nil
+}
+
+// gravarImagem grava o original e as miniaturas de uma imagem do produto
+func gravarImagem(ctx context.Context, produtoID primitive.ObjectID, dados []byte, img *imagens.Imagem) (models.ImagemProduto, error) {
+    id := primitive.NewObjectID().Hex()
+    base := "produtos/" + produtoID.Hex() + "/" + id
+    imagem := models.ImagemProduto{
+        ID:           id,
+        Arquivo:      base + img.Extensao,
+        Miniaturas:   map[string]string{},
+        TipoConteudo: img.Tipo,
+        Tamanho:      int64(len(dados)),
+        Largura:      img.Largura,
+        Altura:       img.Altura,
+        DataEnvio:    time.Now(),
+    }
+    if err := gravarUpload(ctx, imagem.Arquivo, dados, img.Tipo); err != nil {
+        return imagem, err
+    }
+
+    for _, t := range tamanhosMiniatura {
+        miniatura, extensao, err := img.Miniatura(t.Lado)
+        if err == nil {
+            chave := base + "_" + t.Nome + extensao
+            if err = gravarUpload(ctx, chave, miniatura, tipoArquivo(chave)); err == nil {
+                imagem.Miniaturas[t.Nome] = chave
+                continue
+            }
+        }
+        removerArquivosImagens(imagem)
+        return imagem, err
+    }
+    return imagem, nil
+}
+
+// ajustarPrincipal garante que a galeria tenha exatamente uma imagem
+// principal: a primeira marcada ou, sem nenhuma, a primeira da lista
+func ajustarPrincipal(lista []models.ImagemProduto) {
+    principal := -1
+    for i := range lista {
+        if lista[i].Principal && principal < 0 {
+            principal = i
+        }
+        lista[i].Principal = false
+    }
+    if principal < 0 && len(lista) > 0 {
+        principal = 0
+    }
+    if principal >= 0 {
+        lista[principal].Principal = true
+    }
+}
+
+func idsImagens(lista []models.ImagemProduto) []string {
+    ids := make([]string, len(lista))
+    for i, imagem := range lista {
+        ids[i] = imagem.ID
+    }
+    return ids
+}
+
+// gravarGaleria substitui a galeria do produto e a URL da imagem principal.
+// A gravação só ocorre se a galeria ainda tiver as mesmas imagens lidas em
+// produto; caso contrário retorna false, para que imagens incluídas ou
+// removidas ao mesmo tempo não se percam.
+func gravarGaleria(ctx context.Context, produto models.Produto, lista []models.ImagemProduto) (bool, error) {
+    filtro := bson.M{"_id": produto.ID}
+    if len(produto.Imagens) == 0 {
+        filtro["imagens.0"] = bson.M{"$exists": false}
+    } else {
+        filtro["imagens"] = bson.M{"$size": len(produto.Imagens)}
+        filtro["imagens.id"] = bson.M{"$all": idsImagens(produto.Imagens)}
+    }
+
+    set := bson.M{"ultima_atualizacao": time.Now()}
+    unset := bson.M{}
+    if len(lista) > 0 {
+        set["imagens"] = lista
+    } else {
+        unset["imagens"] = ""
+    }
+    unset["imagem_url"] = ""
+    for _, imagem := range lista {
+        if imagem.Principal {
+            set["imagem_url"] = enderecoUpload(imagem.Arquivo)
+            delete(unset, "imagem_url")
+        }
+    }
+
+    update := bson.M{"$set": set}
+    if len(unset) > 0 {
+        update["$unset"] = unset
+    }
+    result, err := collection.UpdateOne(ctx, filtro, update)
+    if err != nil {
+        return false, err
+    }
+    return result.MatchedCount > 0, nil
+}
+
+// responderGaleria devolve a galeria com as URLs preenchidas
+func responderGaleria(c *gin.Context, status int, produto models.Produto, extra gin.H) {
+    lista := []models.Produto{produto}
+    preencherURLsImagens(lista)
+    galeria := lista[0].Imagens
+    if galeria == nil {
+        galeria = []models.ImagemProduto{}
+    }
+    resposta := gin.H{"imagens": galeria, "imagem_url": lista[0].ImagemURL}
+    for k, v := range extra {
+        resposta[k] = v
+    }
+    c.JSON(status, resposta)
+}
+
+// receberImagens valida, grava e acrescenta à galeria as imagens enviadas.
+// Com principal, a primeira imagem enviada passa a ser a principal.
+func receberImagens(c *gin.Context, campos []string, principal bool) {
+    limite := maximoImagensProduto()
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, tamanhoMaximoImagem()*int64(limite)+1<<20)
+
+    form, err := c.MultipartForm()
+    if err != nil {
+        var excedido *http.MaxBytesError
+        if errors.As(err, &excedido) {
+            c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Envio excede o tamanho máximo"})
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Envie as imagens como multipart/form-data"})
+        return
+    }
+    var arquivos []*multipart.FileHeader
+    for _, campo := range campos {
+        arquivos = append(arquivos, form.File[campo]...)
+    }
+    if len(arquivos) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo não encontrado"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+    if len(produto.Imagens)+len(arquivos) > limite {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("O produto pode ter no máximo %d imagens", limite)})
+        return
+    }
+
+    type imagemLida struct {
+        dados []byte
+        img   *imagens.Imagem
+    }
+    lidas := make([]imagemLida, 0, len(arquivos))
+    for _, arquivo := range arquivos {
+        dados, img, status, err := lerImagem(arquivo)
+        if err != nil {
+            c.JSON(status, gin.H{"error": err.Error()})
+            return
+        }
+        lidas = append(lidas, imagemLida{dados, img})
+    }
+
+    novas := make([]models.ImagemProduto, 0, len(lidas))
+    for _, l := range lidas {
+        imagem, err := gravarImagem(ctx, produto.ID, l.dados, l.img)
+        if err != nil {
+            removerArquivosImagens(novas...)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo", "details": err.Error()})
+            return
+        }
+        novas = append(novas, imagem)
+    }
+
+    lista := append(append([]models.ImagemProduto{}, produto.Imagens...), novas...)
+    if principal {
+        for i := range lista {
+            lista[i].Principal = false
+        }
+        lista[len(produto.Imagens)].Principal = true
+    }
+    ajustarPrincipal(lista)
+
+    gravada, err := gravarGaleria(ctx, produto, lista)
+    if err != nil || !gravada {
+        removerArquivosImagens(novas...)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusConflict, gin.H{"error": "As imagens do produto foram alteradas, tente novamente"})
+        return
+    }
+
+    produto.Imagens = lista
+    responderGaleria(c, http.StatusCreated, produto, gin.H{
+        "message": "Imagens adicionadas",
+        "url":     urlUpload(novas[0].Arquivo),
+    })
+}
+
+// UploadImagemProduto recebe uma imagem no campo "imagem" e a torna a
+// imagem principal do produto, mantendo as demais na galeria
+func UploadImagemProduto(c *gin.Context) {
+    receberImagens(c, []string{"imagem"}, true)
+}
+
+// AdicionarImagensProduto acrescenta à galeria as imagens enviadas nos campos
+// "imagens" (um ou mais arquivos) ou "imagem". Com principal=true, a primeira
+// enviada passa a ser a principal.
+func AdicionarImagensProduto(c *gin.Context) {
+    principal, _ := strconv.ParseBool(c.Query("principal"))
+    receberImagens(c, []string{"imagens", "imagem"}, principal)
+}
+
+// GetImagensProduto lista a galeria do produto na ordem de exibição
+func GetImagensProduto(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+    responderGaleria(c, http.StatusOK, produto, nil)
+}
+
+// OrdenarImagensProduto define a ordem de exibição da galeria. O corpo deve
+// trazer todos os IDs das imagens do produto, na nova ordem.
+func OrdenarImagensProduto(c *gin.Context) {
+    var dados struct {
+        IDs []string `json:"ids" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+
+    porID := make(map[string]models.ImagemProduto, len(produto.Imagens))
+    for _, imagem := range produto.Imagens {
+        porID[imagem.ID] = imagem
+    }
+    if len(dados.IDs) != len(produto.Imagens) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe os IDs de todas as imagens do produto"})
+        return
+    }
+    lista := make([]models.ImagemProduto, 0, len(dados.IDs))
+    for _, id := range dados.IDs {
+        imagem, ok := porID[id]
+        if !ok {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Imagem não encontrada ou repetida: " + id})
+            return
+        }
+        delete(porID, id)
+        lista = append(lista, imagem)
+    }
+
+    atualizarGaleria(ctx, c, produto, lista, nil)
+}
+
+// atualizarGaleria grava a galeria alterada e responde com ela. Os arquivos
+// das imagens removidas só são apagados depois da gravação.
+func atualizarGaleria(ctx context.Context, c *gin.Context, produto models.Produto, lista []models.ImagemProduto, removidas []models.ImagemProduto) {
+    ajustarPrincipal(lista)
+    gravada, err := gravarGaleria(ctx, produto, lista)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if !gravada {
+        c.JSON(http.StatusConflict, gin.H{"error": "As imagens do produto foram alteradas, tente novamente"})
+        return
+    }
+    removerArquivosImagens(removidas...)
+
+    produto.Imagens = lista
+    produto.ImagemURL = ""
+    responderGaleria(c, http.StatusOK, produto, gin.H{"message": "Imagens atualizadas"})
+}
+
+// imagemRota localiza na galeria a imagem indicada na rota
+func imagemRota(c *gin.Context, produto models.Produto) (int, bool) {
+    for i, imagem := range produto.Imagens {
+        if imagem.ID == c.Param("imagem") {
+            return i, true
+        }
+    }
+    c.JSON(http.StatusNotFound, gin.H{"error": "Imagem não encontrada"})
+    return -1, false
+}
+
+// DefinirImagemPrincipal torna principal a imagem indicada
+func DefinirImagemPrincipal(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+    i, ok := imagemRota(c, produto)
+    if !ok {
+        return
+    }
+
+    lista := append([]models.ImagemProduto{}, produto.Imagens...)
+    for j := range lista {
+        lista[j].Principal = j == i
+    }
+    atualizarGaleria(ctx, c, produto, lista, nil)
+}
+
+// RemoverImagemProduto retira a imagem da galeria e apaga seus arquivos. Se
+// ela era a principal, a primeira imagem restante assume o lugar.
+func RemoverImagemProduto(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+    i, ok := imagemRota(c, produto)
+    if !ok {
+        return
+    }
+
+    lista := append(append([]models.ImagemProduto{}, produto.Imagens[:i]...), produto.Imagens[i+1:]...)
+    atualizarGaleria(ctx, c, produto, lista, []models.ImagemProduto{produto.Imagens[i]})
+}
+
+// LimparImagensOrfas remove do armazenamento os arquivos de imagem que
+// nenhum produto referencia mais, como os de produtos excluídos ou os que
+// sobraram de falhas. Com simular=true apenas lista os arquivos.
+func LimparImagensOrfas(c *gin.Context) {
+    simular, _ := strconv.ParseBool(c.Query("simular"))
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    filtro := bson.M{"$or": []bson.M{
+        {"imagens.0": bson.M{"$exists": true}},
+        {"imagem_url": bson.M{"$exists": true}},
+    }}
+    opts := options.Find().SetProjection(bson.M{"imagens": 1, "imagem_url": 1})
+    cursor, err := collection.Find(ctx, filtro, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    referenciados := map[string]bool{}
+    for cursor.Next(ctx) {
+        var produto models.Produto
+        if err := cursor.Decode(&produto); err != nil {
+            continue
+        }
+        for _, imagem := range produto.Imagens {
+            for _, chave := range arquivosImagem(imagem) {
+                referenciados[chave] = true
+            }
+        }
+        referenciados[strings.TrimPrefix(produto.ImagemURL, "/uploads/")] = true
+    }
+    if err := cursor.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    limite := time.Now().Add(-carenciaArquivosOrfaos)
+    removidos := []string{}
+    var bytesLiberados int64
+    err = armazenamentoImagens.Listar(ctx, "", func(obj armazenamento.Objeto) error {
+        if referenciados[obj.Chave] || !strings.HasPrefix(obj.Chave, "produtos/") && !arquivoImagemAntigo.MatchString(obj.Chave) {
+            return nil
+        }
+        if obj.Modificado.After(limite) {
+            return nil
+        }
+
+        if !simular {
+            if err := armazenamentoImagens.Remover(ctx, obj.Chave); err != nil {
+                return err
+            }
+        }
+        removidos = append(removidos, obj.Chave)
+        bytesLiberados += obj.Tamanho
+        return nil
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "removidos": removidos})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "simulacao":       simular,
+        "arquivos":        removidos,
+        "total":           len(removidos),
+        "bytes_liberados": bytesLiberados,
+    })
+}
+
+// ServirUpload entrega os arquivos do armazenamento local, conferindo a
+// assinatura e a validade da URL. Os nomes são únicos por envio, então o
+// conteúdo pode ficar em cache até a URL expirar. Com outros backends os
+// arquivos são baixados direto do serviço e a rota não encontra nada.
+func ServirUpload(c *gin.Context) {
+    local, ok := armazenamentoImagens.(*armazenamento.Local)
+    chave := strings.TrimPrefix(path.Clean("/"+c.Param("arquivo")), "/")
+    if !ok || strings.HasSuffix(chave, ".tmp") {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+        return
+    }
+    if !local.Verificar(chave, c.Query("expira"), c.Query("assinatura")) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "URL inválida ou expirada"})
+        return
+    }
+
+    caminho := local.Caminho(chave)
+    info, err := os.Stat(caminho)
+    if err != nil || info.IsDir() {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+        return
+    }
+
+    c.Header("X-Content-Type-Options", "nosniff")
+    c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(armazenamento.ValidadeURL().Seconds())))
+    c.File(caminho)
+}
@@ -0,0 +1,487 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "estoque-api/cache"
+    "estoque-api/database"
+    "estoque-api/models"
+    "estoque-api/planilhas"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "path/filepath"
+    "runtime/debug"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+    // Tamanho máximo aceito para arquivos de importação (20 MB)
+    tamanhoMaximoImportacao = 20 << 20
+    // Quantidade máxima de erros guardados no job para não estourar o documento
+    maximoErrosImportacao = 1000
+    // Frequência com que o progresso do job é gravado no banco
+    intervaloProgressoImportacao = 100
+)
+
+// Campos de models.Produto que podem ser preenchidos pela importação
+var camposImportacao = []string{
+    "codigo_barras", "nome", "descricao", "preco", "preco_promocional",
+    "estoque", "unidade", "categoria", "fornecedor", "deposito", "status", "tags",
+}
+
+var importacaoCollection *mongo.Collection
+
+// InitializeImportacaoHandlers inicializa a collection de jobs de importação
+func InitializeImportacaoHandlers() {
+    importacaoCollection = database.DB.Collection("importacoes")
+}
+
+// ImportarProdutos recebe um arquivo CSV ou XLSX e cria um job assíncrono que
+// faz o upsert dos produtos pelo codigo_barras.
+//
+// Campos do formulário multipart:
+//   - arquivo: o arquivo a importar
+//   - formato: csv ou xlsx (opcional, deduzido pela extensão)
+//   - mapeamento: JSON {"campo": "Coluna do arquivo"} (opcional, por padrão o
+//     cabeçalho deve ter o mesmo nome dos campos)
+//   - dry_run: "true" para apenas validar, sem gravar
+func ImportarProdutos(c *gin.Context) {
+    header, err := c.FormFile("arquivo")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo não encontrado"})
+        return
+    }
+    if header.Size > tamanhoMaximoImportacao {
+        c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Arquivo excede o tamanho máximo de 20 MB"})
+        return
+    }
+
+    formato := strings.ToLower(c.PostForm("formato"))
+    if formato == "" {
+        formato = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+    }
+    if formato != "csv" && formato != "xlsx" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Formato não suportado, use csv ou xlsx"})
+        return
+    }
+
+    mapeamento := map[string]string{}
+    if m := c.PostForm("mapeamento"); m != "" {
+        if err := json.Unmarshal([]byte(m), &mapeamento); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Mapeamento inválido", "details": err.Error()})
+            return
+        }
+    }
+    dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+
+    file, err := header.Open()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao abrir arquivo"})
+        return
+    }
+    defer file.Close()
+
+    conteudo, err := io.ReadAll(file)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler arquivo"})
+        return
+    }
+
+    var linhas [][]string
+    if formato == "csv" {
+        linhas, err = planilhas.LerCSV(bytes.NewReader(conteudo))
+    } else {
+        linhas, err = planilhas.LerXLSX(bytes.NewReader(conteudo), int64(len(conteudo)))
+    }
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler arquivo", "details": err.Error()})
+        return
+    }
+    if len(linhas) < 2 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo sem linhas de dados"})
+        return
+    }
+
+    colunas, err := resolverColunas(linhas[0], mapeamento)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    importacao := models.Importacao{
+        ID:          primitive.NewObjectID(),
+        Arquivo:     header.Filename,
+        Formato:     formato,
+        DryRun:      dryRun,
+        Status:      "pendente",
+        TotalLinhas: len(linhas) - 1,
+        Erros:       []models.ErroImportacao{},
+        UsuarioID:   usuarioAtual(c),
+        DataCriacao: time.Now(),
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if _, err := importacaoCollection.InsertOne(ctx, importacao); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    go processarImportacao(importacao, linhas[1:], colunas)
+
+    c.JSON(http.StatusAccepted, importacao)
+}
+
+// GetImportacao retorna o status e o relatório de erros de um job de importação
+func GetImportacao(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var importacao models.Importacao
+    if err := importacaoCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&importacao); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Importação não encontrada"})
+        return
+    }
+
+    c.JSON(http.StatusOK, importacao)
+}
+
+// resolverColunas associa cada campo do produto ao índice da coluna no arquivo
+func resolverColunas(cabecalho []string, mapeamento map[string]string) (map[string]int, error) {
+    indices := make(map[string]int, len(cabecalho))
+    for i, nome := range cabecalho {
+        indices[strings.ToLower(strings.TrimSpace(nome))] = i
+    }
+
+    colunas := map[string]int{}
+    for _, campo := range camposImportacao {
+        nomeColuna := campo
+        if m, ok := mapeamento[campo]; ok {
+            nomeColuna = m
+        }
+        if i, ok := indices[strings.ToLower(strings.TrimSpace(nomeColuna))]; ok {
+            colunas[campo] = i
+        } else if _, ok := mapeamento[campo]; ok {
+            return nil, fmt.Errorf("coluna %q mapeada para %s não existe no arquivo", nomeColuna, campo)
+        }
+    }
+
+    for campo := range mapeamento {
+        if _, ok := colunas[campo]; !ok {
+            return nil, fmt.Errorf("campo %q não pode ser importado", campo)
+        }
+    }
+
+    if _, ok := colunas["codigo_barras"]; !ok {
+        return nil, errors.New("a coluna codigo_barras é obrigatória")
+    }
+
+    return colunas, nil
+}
+
+// processarImportacao valida e grava cada linha, atualizando o progresso do
+// job. Um erro inesperado encerra o job com status falhou.
+func processarImportacao(importacao models.Importacao, linhas [][]string, colunas map[string]int) {
+    salvarProgresso := func(extra bson.M) {
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+
+        campos := bson.M{
+            "processadas": importacao.Processadas,
+            "criados":     importacao.Criados,
+            "atualizados": importacao.Atualizados,
+            "falhas":      importacao.Falhas,
+            "erros":       importacao.Erros,
+        }
+        for k, v := range extra {
+            campos[k] = v
+        }
+        importacaoCollection.UpdateOne(ctx, bson.M{"_id": importacao.ID}, bson.M{"$set": campos})
+    }
+
+    defer func() {
+        if r := recover(); r != nil {
+            fmt.Printf("Erro inesperado na importação %s: %v\n%s\n", importacao.ID.Hex(), r, debug.Stack())
+            importacao.Erros = append(importacao.Erros, models.ErroImportacao{
+                Linha:    importacao.Processadas + 2,
+                Mensagem: "erro inesperado, importação interrompida",
+            })
+            if !importacao.DryRun {
+                cache.Invalidar()
+            }
+            salvarProgresso(bson.M{"status": "falhou", "data_conclusao": time.Now()})
+        }
+    }()
+
+    salvarProgresso(bson.M{"status": "processando"})
+
+    for i, linha := range linhas {
+        // +2: a linha 1 é o cabeçalho e a numeração do arquivo começa em 1
+        numero := i + 2
+
+        criado, erros := importarLinha(linha, colunas, importacao.DryRun, importacao.UsuarioID)
+        importacao.Processadas++
+        if len(erros) > 0 {
+            importacao.Falhas++
+            for _, e := range erros {
+                if len(importacao.Erros) >= maximoErrosImportacao {
+                    break
+                }
+                e.Linha = numero
+                importacao.Erros = append(importacao.Erros, e)
+            }
+        } else if criado {
+            importacao.Criados++
+        } else {
+            importacao.Atualizados++
+        }
+
+        if importacao.Processadas%intervaloProgressoImportacao == 0 {
+            salvarProgresso(nil)
+        }
+    }
+
+    if !importacao.DryRun {
+        cache.Invalidar()
+    }
+    salvarProgresso(bson.M{"status": "concluida", "data_conclusao": time.Now()})
+}
+
+// importarLinha converte uma linha do arquivo e faz o upsert pelo codigo_barras.
+// Retorna se o produto foi (ou seria, em dry-run) criado.
+func importarLinha(linha []string, colunas map[string]int, dryRun bool, usuarioID string) (bool, []models.ErroImportacao) {
+    campos, erros := converterLinha(linha, colunas)
+    if len(erros) > 0 {
+        return false, erros
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    codigo, ok := campos["codigo_barras"].(string)
+    if !ok || codigo == "" {
+        return false, []models.ErroImportacao{{Campo: "codigo_barras", Mensagem: "obrigatório"}}
+    }
+    filtro := bson.M{"codigo_barras": codigo}
+    var anterior models.Produto
+    err := collection.FindOne(ctx, filtro).Decode(&anterior)
+    if err != nil && err != mongo.ErrNoDocuments {
+        return false, []models.ErroImportacao{{Mensagem: err.Error()}}
+    }
+    criado := err == mongo.ErrNoDocuments
+
+    if criado {
+        if _, ok := campos["nome"]; !ok {
+            return false, []models.ErroImportacao{{Campo: "nome", Mensagem: "obrigatório para novos produtos"}}
+        }
+    }
+
+    if _, ok := campos["estoque"]; ok && len(anterior.Variantes) > 0 {
+        return false, []models.ErroImportacao{{Campo: "estoque", Mensagem: "produto com variantes: o estoque é movimentado por variante"}}
+    }
+    if _, ok := campos["estoque"]; ok && len(anterior.Componentes) > 0 {
+        return false, []models.ErroImportacao{{Campo: "estoque", Mensagem: "kit: o estoque é movimentado pela montagem dos componentes"}}
+    }
+
+    // As mesmas regras de unidade do cadastro valem para o produto resultante
+    resultado := anterior
+    if unidade, ok := campos["unidade"].(string); ok {
+        resultado.Unidade = unidade
+    }
+    if estoque, ok := campos["estoque"].(float64); ok {
+        resultado.Estoque = estoque
+    }
+    if err := validarUnidades(&resultado); err != nil {
+        campo := "unidade"
+        if _, ok := campos["estoque"]; ok {
+            campo = "estoque"
+        }
+        return false, []models.ErroImportacao{{Campo: campo, Mensagem: err.Error()}}
+    }
+    if criado {
+        campos["unidade"] = resultado.Unidade
+    }
+
+    categoriaID := anterior.CategoriaID
+    _, alterarCategoria := campos["categoria"].(string)
+    if alterarCategoria {
+        var nome string
+        var err error
+        nome, categoriaID, err = resolverCategoria(ctx, campos["categoria"].(string), nil)
+        if err != nil {
+            return false, []models.ErroImportacao{{Campo: "categoria", Mensagem: err.Error()}}
+        }
+        campos["categoria"] = nome
+        campos["categoria_id"] = categoriaID
+    }
+
+    // Produtos novos e trocas de categoria conferem as especificações contra
+    // o esquema da categoria, como no cadastro
+    if criado || alterarCategoria {
+        esquema, err := esquemaProduto(ctx, categoriaID)
+        if err != nil {
+            return false, []models.ErroImportacao{{Campo: "categoria", Mensagem: err.Error()}}
+        }
+        especificacoes, err := validarEspecificacoes(esquema, anterior.Especificacoes)
+        if err != nil {
+            return false, []models.ErroImportacao{{Campo: "categoria", Mensagem: err.Error()}}
+        }
+        campos["especificacoes"] = especificacoes
+    }
+
+    if dryRun {
+        return criado, nil
+    }
+
+    agora := time.Now()
+    campos["ultima_atualizacao"] = agora
+    naInsercao := bson.M{"data_criacao": agora}
+    if _, ok := campos["status"]; !ok {
+        naInsercao["status"] = "ativo"
+    }
+
+    update := bson.M{"$set": campos, "$setOnInsert": naInsercao}
+    // Categoria em texto livre desfaz o vínculo com uma categoria cadastrada
+    if id, ok := campos["categoria_id"]; ok && id.(*primitive.ObjectID) == nil {
+        delete(campos, "categoria_id")
+        update["$unset"] = bson.M{"categoria_id": ""}
+    }
+    opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+    var produto models.Produto
+    if err := collection.FindOneAndUpdate(ctx, filtro, update, opts).Decode(&produto); err != nil {
+        return false, []models.ErroImportacao{{Mensagem: err.Error()}}
+    }
+
+    if _, ok := campos["estoque"]; ok {
+        registrarMovimentacao(ctx, produto, arredondarQuantidade(produto.Estoque-anterior.Estoque), "importacao", usuarioID)
+    }
+
+    return criado, nil
+}
+
+// converterLinha valida os valores da linha e monta os campos a gravar
+func converterLinha(linha []string, colunas map[string]int) (bson.M, []models.ErroImportacao) {
+    campos := bson.M{}
+    var erros []models.ErroImportacao
+
+    valor := func(campo string) (string, bool) {
+        i, ok := colunas[campo]
+        if !ok || i >= len(linha) {
+            return "", false
+        }
+        return strings.TrimSpace(linha[i]), true
+    }
+
+    for _, campo := range camposImportacao {
+        // Células vazias no fim da linha não chegam do arquivo (XLSX e CSV
+        // irregulares): para o codigo_barras, a ausência é um erro da linha
+        v, ok := valor(campo)
+        if !ok && campo != "codigo_barras" {
+            continue
+        }
+
+        switch campo {
+        case "codigo_barras":
+            if v == "" {
+                erros = append(erros, models.ErroImportacao{Campo: campo, Mensagem: "obrigatório"})
+                continue
+            }
+            campos[campo] = v
+        case "preco", "preco_promocional":
+            if v == "" {
+                continue
+            }
+            n, err := converterDecimal(v)
+            if err != nil || n < 0 {
+                erros = append(erros, models.ErroImportacao{Campo: campo, Mensagem: fmt.Sprintf("valor inválido: %q", v)})
+                continue
+            }
+            campos[campo] = n
+        case "estoque":
+            if v == "" {
+                continue
+            }
+            n, err := converterDecimal(v)
+            if err != nil || n < 0 {
+                erros = append(erros, models.ErroImportacao{Campo: campo, Mensagem: fmt.Sprintf("quantidade inválida: %q", v)})
+                continue
+            }
+            campos[campo] = arredondarQuantidade(n)
+        case "unidade":
+            if v == "" {
+                continue
+            }
+            v = strings.ToLower(v)
+            if _, ok := unidadesMedida[v]; !ok {
+                erros = append(erros, models.ErroImportacao{Campo: campo, Mensagem: fmt.Sprintf("unidade desconhecida: %q", v)})
+                continue
+            }
+            campos[campo] = v
+        case "status":
+            if v == "" {
+                continue
+            }
+            if v != "ativo" && v != "inativo" && v != "em_promocao" {
+                erros = append(erros, models.ErroImportacao{Campo: campo, Mensagem: fmt.Sprintf("status inválido: %q", v)})
+                continue
+            }
+            campos[campo] = v
+        case "tags":
+            var tags []string
+            for _, t := range strings.FieldsFunc(v, func(r rune) bool { return r == '|' || r == ',' }) {
+                if t = strings.TrimSpace(t); t != "" {
+                    tags = append(tags, t)
+                }
+            }
+            campos[campo] = tags
+        case "nome":
+            if v == "" {
+                erros = append(erros, models.ErroImportacao{Campo: campo, Mensagem: "não pode ser vazio"})
+                continue
+            }
+            campos[campo] = v
+        default:
+            campos[campo] = v
+        }
+    }
+
+    return campos, erros
+}
+
+// converterDecimal aceita tanto "1234.56" quanto o formato brasileiro
+// "1.234,56". NaN e infinitos (inclusive por estouro, como 1e309) são
+// recusados: não podem ser gravados como preço ou estoque nem codificados
+// em JSON.
+func converterDecimal(v string) (float64, error) {
+    if strings.Contains(v, ",") {
+        v = strings.ReplaceAll(v, ".", "")
+        v = strings.Replace(v, ",", ".", 1)
+    }
+    n, err := strconv.ParseFloat(v, 64)
+    if err != nil {
+        return 0, err
+    }
+    if math.IsNaN(n) || math.IsInf(n, 0) {
+        return 0, fmt.Errorf("número inválido: %q", v)
+    }
+    return n, nil
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import "testing"
+
+func TestConverterDecimal(t *testing.T) {
+    validos := map[string]float64{
+        "1234.56":  1234.56,
+        "1.234,56": 1234.56,
+        "0,5":      0.5,
+        "10":       10,
+        "-3":       -3,
+        "1e3":      1000,
+    }
+    for texto, esperado := range validos {
+        if n, err := converterDecimal(texto); err != nil || n != esperado {
+            t.Errorf("converterDecimal(%q) = %v, %v; esperado %v", texto, n, err, esperado)
+        }
+    }
+
+    for _, texto := range []string{"", "abc", "1,2,3", "NaN", "nan", "Inf", "-Inf", "+infinity", "1e309", "-1e309"} {
+        if n, err := converterDecimal(texto); err == nil {
+            t.Errorf("converterDecimal(%q) = %v, esperado erro", texto, n)
+        }
+    }
+}
@@ -0,0 +1,503 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "estoque-api/models"
+    "fmt"
+    "math"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errEstoqueInsuficiente = errors.New("estoque insuficiente")
+
+// movimentarEstoque aplica delta ao estoque do produto ou, com sku, da
+// variante (e ao total do produto). Saídas só são aplicadas se houver saldo;
+// caso contrário retorna errEstoqueInsuficiente.
+func movimentarEstoque(ctx context.Context, produtoID primitive.ObjectID, sku string, delta float64) (models.Produto, error) {
+    filtro := bson.M{"_id": produtoID}
+    inc := bson.M{"estoque": delta}
+    if sku != "" {
+        variante := bson.M{"sku": sku}
+        if delta < 0 {
+            variante["estoque"] = bson.M{"$gte": -delta}
+        }
+        filtro["variantes"] = bson.M{"$elemMatch": variante}
+        inc["variantes.$.estoque"] = delta
+    } else if delta < 0 {
+        filtro["estoque"] = bson.M{"$gte": -delta}
+    }
+
+    var produto models.Produto
+    update := bson.M{"$inc": inc, "$set": bson.M{"ultima_atualizacao": time.Now()}}
+    opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+    err := collection.FindOneAndUpdate(ctx, filtro, update, opts).Decode(&produto)
+    if err == mongo.ErrNoDocuments {
+        return produto, errEstoqueInsuficiente
+    }
+    return produto, err
+}
+
+// saldoComponente retorna o estoque do produto ou da variante indicada
+func saldoComponente(produto models.Produto, sku string) float64 {
+    if sku == "" {
+        return produto.Estoque
+    }
+    if v := varianteProduto(produto, sku); v != nil {
+        return v.Estoque
+    }
+    return 0
+}
+
+// kitsMontaveis calcula quantos kits podem ser montados com o saldo atual
+// dos componentes
+func kitsMontaveis(kit models.Produto, componentes map[primitive.ObjectID]models.Produto) float64 {
+    montaveis := -1.0
+    for _, comp := range kit.Componentes {
+        produto, ok := componentes[comp.ProdutoID]
+        if !ok {
+            return 0
+        }
+        n := math.Floor(saldoComponente(produto, comp.VarianteSKU) / comp.Quantidade)
+        if n < 0 {
+            n = 0
+        }
+        if montaveis < 0 || n < montaveis {
+            montaveis = n
+        }
+    }
+    if montaveis < 0 {
+        return 0
+    }
+    return montaveis
+}
+
+// filtroComponentes monta o filtro dos produtos usados pelos kits, ou nil
+// se nenhum deles tiver componentes
+func filtroComponentes(kits ...models.Produto) bson.M {
+    var ids []primitive.ObjectID
+    for _, kit := range kits {
+        for _, comp := range kit.Componentes {
+            ids = append(ids, comp.ProdutoID)
+        }
+    }
+    if len(ids) == 0 {
+        return nil
+    }
+    return bson.M{"_id": bson.M{"$in": unicos(ids)}}
+}
+
+// carregarComponentes busca os produtos usados pelos kits informados
+func carregarComponentes(ctx context.Context, kits ...models.Produto) (map[primitive.ObjectID]models.Produto, error) {
+    componentes := map[primitive.ObjectID]models.Produto{}
+    filtro := filtroComponentes(kits...)
+    if filtro == nil {
+        return componentes, nil
+    }
+
+    cursor, err := collection.Find(ctx, filtro)
+    if err != nil {
+        return nil, err
+    }
+    var produtos []models.Produto
+    if err := cursor.All(ctx, &produtos); err != nil {
+        return nil, err
+    }
+    for _, p := range produtos {
+        componentes[p.ID] = p
+    }
+    return componentes, nil
+}
+
+// kitsComComponente conta os kits que usam o produto como componente ou,
+// com sku, a variante indicada
+func kitsComComponente(ctx context.Context, produtoID primitive.ObjectID, sku string) (int64, error) {
+    componente := bson.M{"produto_id": produtoID}
+    if sku != "" {
+        componente["variante_sku"] = sku
+    }
+    return collection.CountDocuments(ctx, bson.M{"componentes": bson.M{"$elemMatch": componente}})
+}
+
+// recusarComponenteEmUso responde 409 se algum kit ainda usar o produto ou a
+// variante, que não pode ser removido sem deixar o kit inutilizável
+func recusarComponenteEmUso(ctx context.Context, c *gin.Context, produtoID primitive.ObjectID, sku string) bool {
+    kits, err := kitsComComponente(ctx, produtoID, sku)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return true
+    }
+    if kits > 0 {
+        c.JSON(http.StatusConflict, gin.H{"error": "Item usado como componente de kits; altere a composição dos kits antes de removê-lo", "kits": kits})
+        return true
+    }
+    return false
+}
+
+// preencherDisponibilidadeKits calcula o estoque disponível dos kits da
+// lista: os kits já montados mais os que podem ser montados com os componentes
+func preencherDisponibilidadeKits(ctx context.Context, produtos []models.Produto) error {
+    var kits []models.Produto
+    for _, p := range produtos {
+        if len(p.Componentes) > 0 {
+            kits = append(kits, p)
+        }
+    }
+    if len(kits) == 0 {
+        return nil
+    }
+
+    componentes, err := carregarComponentes(ctx, kits...)
+    if err != nil {
+        return err
+    }
+    for i := range produtos {
+        if len(produtos[i].Componentes) == 0 {
+            continue
+        }
+        disponivel := produtos[i].Estoque + kitsMontaveis(produtos[i], componentes)
+        produtos[i].EstoqueDisponivel = &disponivel
+    }
+    return nil
+}
+
+// validarComponentes confere a composição de um kit: quantidades positivas,
+// componentes existentes e sem repetição, variante informada para produtos
+// com variantes e nenhum componente que seja outro kit
+func validarComponentes(ctx context.Context, kit *models.Produto) error {
+    if len(kit.Componentes) == 0 {
+        return nil
+    }
+    if len(kit.Variantes) > 0 {
+        return errors.New("um kit não pode ter variantes")
+    }
+
+    componentes, err := carregarComponentes(ctx, *kit)
+    if err != nil {
+        return err
+    }
+
+    vistos := map[string]bool{}
+    for i, comp := range kit.Componentes {
+        if comp.Quantidade <= 0 {
+            return fmt.Errorf("componente %d: quantidade inválida", i+1)
+        }
+        if comp.ProdutoID == kit.ID {
+            return errors.New("um kit não pode conter a si mesmo")
+        }
+        produto, ok := componentes[comp.ProdutoID]
+        if !ok {
+            return fmt.Errorf("componente %d: produto não encontrado", i+1)
+        }
+        if len(produto.Componentes) > 0 {
+            return fmt.Errorf("componente %d: %s é um kit", i+1, produto.Nome)
+        }
+        if len(produto.Variantes) > 0 && varianteProduto(produto, comp.VarianteSKU) == nil {
+            return fmt.Errorf("componente %d: informe uma variante_sku válida de %s", i+1, produto.Nome)
+        }
+        if len(produto.Variantes) == 0 && comp.VarianteSKU != "" {
+            return fmt.Errorf("componente %d: %s não possui variantes", i+1, produto.Nome)
+        }
+
+        chave := comp.ProdutoID.Hex() + "/" + comp.VarianteSKU
+        if vistos[chave] {
+            return fmt.Errorf("componente %d: repetido", i+1)
+        }
+        vistos[chave] = true
+    }
+    return nil
+}
+
+// movimentarComponentes aplica a cada componente a sua quantidade vezes n
+// (negativo para retirar). Se algum componente não tiver saldo, as
+// alterações já feitas são desfeitas. Retorna os componentes atualizados,
+// na ordem da composição.
+func movimentarComponentes(ctx context.Context, kit models.Produto, n float64) ([]models.Produto, error) {
+    atualizados := make([]models.Produto, 0, len(kit.Componentes))
+    for _, comp := range kit.Componentes {
+        produto, err := movimentarEstoque(ctx, comp.ProdutoID, comp.VarianteSKU, arredondarQuantidade(comp.Quantidade*n))
+        if err != nil {
+            for j, feito := range atualizados {
+                c := kit.Componentes[j]
+                if _, errDesfazer := movimentarEstoque(ctx, feito.ID, c.VarianteSKU, -arredondarQuantidade(c.Quantidade*n)); errDesfazer != nil {
+                    fmt.Printf("Erro ao desfazer movimentação do componente %s do kit %s: %v\n", feito.ID.Hex(), kit.ID.Hex(), errDesfazer)
+                }
+            }
+            if err == errEstoqueInsuficiente {
+                return nil, fmt.Errorf("estoque insuficiente do componente %s", comp.ProdutoID.Hex())
+            }
+            return nil, err
+        }
+        atualizados = append(atualizados, produto)
+    }
+    return atualizados, nil
+}
+
+// registrarMovimentacoesComponentes grava no histórico as alterações dos
+// componentes, vinculadas ao kit
+func registrarMovimentacoesComponentes(ctx context.Context, kit models.Produto, atualizados []models.Produto, n float64, motivo, usuarioID string) {
+    for i, produto := range atualizados {
+        comp := kit.Componentes[i]
+        movimentacao := novaMovimentacao(produto, comp.VarianteSKU, arredondarQuantidade(comp.Quantidade*n), motivo, usuarioID)
+        movimentacao.KitID = &kit.ID
+        gravarMovimentacao(ctx, movimentacao)
+    }
+}
+
+// baixarKit retira quantidade kits do estoque, usando primeiro os kits já
+// montados e, para o restante, os componentes. Cada retirada é registrada
+// no histórico com o motivo informado (por exemplo venda).
+func baixarKit(ctx context.Context, kit models.Produto, quantidade float64, motivo, usuarioID string) (models.Produto, float64, error) {
+    montados := quantidade
+    if montados > kit.Estoque {
+        montados = kit.Estoque
+    }
+    if montados < 0 {
+        montados = 0
+    }
+
+    atualizado := kit
+    if montados > 0 {
+        var err error
+        if atualizado, err = movimentarEstoque(ctx, kit.ID, "", -montados); err != nil {
+            return kit, 0, err
+        }
+    }
+
+    restante := quantidade - montados
+    var componentes []models.Produto
+    if restante > 0 {
+        var err error
+        if componentes, err = movimentarComponentes(ctx, kit, -restante); err != nil {
+            if montados > 0 {
+                movimentarEstoque(ctx, kit.ID, "", montados)
+            }
+            return kit, 0, err
+        }
+    }
+
+    registrarMovimentacao(ctx, atualizado, -montados, motivo, usuarioID)
+    registrarMovimentacoesComponentes(ctx, kit, componentes, -restante, motivo, usuarioID)
+    return atualizado, montados, nil
+}
+
+// buscarKit carrega o kit da rota
+func buscarKit(ctx context.Context, c *gin.Context) (models.Produto, bool) {
+    produto, ok := buscarProdutoRota(ctx, c)
+    if ok && len(produto.Componentes) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "O produto não é um kit"})
+        return produto, false
+    }
+    return produto, ok
+}
+
+// GetKit detalha a composição de um kit com o saldo de cada componente
+func GetKit(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    kit, ok := buscarKit(ctx, c)
+    if !ok {
+        return
+    }
+    componentes, err := carregarComponentes(ctx, kit)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    itens := make([]gin.H, 0, len(kit.Componentes))
+    for _, comp := range kit.Componentes {
+        produto := componentes[comp.ProdutoID]
+        saldo := saldoComponente(produto, comp.VarianteSKU)
+        itens = append(itens, gin.H{
+            "produto_id":   comp.ProdutoID,
+            "variante_sku": comp.VarianteSKU,
+            "nome":         produto.Nome,
+            "quantidade":   comp.Quantidade,
+            "estoque":      saldo,
+            "kits":         math.Floor(saldo / comp.Quantidade),
+        })
+    }
+
+    montaveis := kitsMontaveis(kit, componentes)
+    c.JSON(http.StatusOK, gin.H{
+        "id":                 kit.ID,
+        "nome":               kit.Nome,
+        "componentes":        itens,
+        "montados":           kit.Estoque,
+        "montaveis":          montaveis,
+        "estoque_disponivel": kit.Estoque + montaveis,
+    })
+}
+
+// DefinirComponentesKit define (ou, com a lista vazia, remove) a composição
+// de um kit. Com kits montados em estoque a composição não pode mudar, pois
+// a desmontagem devolveria componentes diferentes dos usados.
+func DefinirComponentesKit(c *gin.Context) {
+    var dados struct {
+        Componentes []models.ComponenteKit `json:"componentes"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+    if produto.Estoque != 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Zere o estoque (ou desmonte os kits montados) antes de alterar a composição"})
+        return
+    }
+
+    produto.Componentes = dados.Componentes
+    if err := validarComponentes(ctx, &produto); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    update := bson.M{"$set": bson.M{"componentes": produto.Componentes, "ultima_atualizacao": time.Now()}}
+    if len(produto.Componentes) == 0 {
+        update = bson.M{"$unset": bson.M{"componentes": ""}, "$set": bson.M{"ultima_atualizacao": time.Now()}}
+    }
+    result, err := collection.UpdateOne(ctx, bson.M{"_id": produto.ID, "estoque": 0}, update)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusConflict, gin.H{"error": "O produto foi alterado, tente novamente"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Composição do kit atualizada"})
+}
+
+// quantidadeKit lê a quantidade de kits do corpo da montagem e desmontagem
+func quantidadeKit(c *gin.Context) (float64, bool) {
+    var dados struct {
+        Quantidade float64 `json:"quantidade"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return 0, false
+    }
+    if dados.Quantidade <= 0 || !inteira(dados.Quantidade) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Quantidade inválida, informe um número inteiro de kits"})
+        return 0, false
+    }
+    return dados.Quantidade, true
+}
+
+// MontarKit converte componentes em kits montados: retira os componentes e
+// soma a quantidade ao estoque do kit
+func MontarKit(c *gin.Context) {
+    quantidade, ok := quantidadeKit(c)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    kit, ok := buscarKit(ctx, c)
+    if !ok {
+        return
+    }
+
+    componentes, err := movimentarComponentes(ctx, kit, -quantidade)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    atualizado, err := movimentarEstoque(ctx, kit.ID, "", quantidade)
+    if err != nil {
+        movimentarComponentes(ctx, kit, quantidade)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    usuarioID := usuarioAtual(c)
+    registrarMovimentacoesComponentes(ctx, kit, componentes, -quantidade, "montagem", usuarioID)
+    registrarMovimentacao(ctx, atualizado, quantidade, "montagem", usuarioID)
+
+    c.JSON(http.StatusOK, gin.H{"message": "Kits montados", "montados": atualizado.Estoque})
+}
+
+// DesmontarKit desfaz kits montados, devolvendo os componentes ao estoque
+func DesmontarKit(c *gin.Context) {
+    quantidade, ok := quantidadeKit(c)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    kit, ok := buscarKit(ctx, c)
+    if !ok {
+        return
+    }
+
+    atualizado, err := movimentarEstoque(ctx, kit.ID, "", -quantidade)
+    if err == errEstoqueInsuficiente {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Não há kits montados suficientes"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    componentes, err := movimentarComponentes(ctx, kit, quantidade)
+    if err != nil {
+        movimentarEstoque(ctx, kit.ID, "", quantidade)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    usuarioID := usuarioAtual(c)
+    registrarMovimentacao(ctx, atualizado, -quantidade, "desmontagem", usuarioID)
+    registrarMovimentacoesComponentes(ctx, kit, componentes, quantidade, "desmontagem", usuarioID)
+
+    c.JSON(http.StatusOK, gin.H{"message": "Kits desmontados", "montados": atualizado.Estoque})
+}
+
+// atualizarEstoqueKit trata as movimentações manuais de um kit. Saídas
+// (como vendas) baixam os kits montados e depois os componentes; entradas
+// devem ser feitas pela montagem.
+func atualizarEstoqueKit(ctx context.Context, c *gin.Context, kit models.Produto, delta float64, motivo string) {
+    if delta >= 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Kit: use a montagem para dar entrada no estoque"})
+        return
+    }
+    if !inteira(delta) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Kit: a quantidade deve ser inteira"})
+        return
+    }
+
+    atualizado, montados, err := baixarKit(ctx, kit, -delta, motivo, usuarioAtual(c))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":                 "Estoque atualizado",
+        "modificados":             1,
+        "estoque":                 atualizado.Estoque,
+        "baixados_montados":       montados,
+        "baixados_de_componentes": -delta - montados,
+    })
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+    "estoque-api/models"
+    "testing"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/bsontype"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUnicos(t *testing.T) {
+    a, b := primitive.NewObjectID(), primitive.NewObjectID()
+    lista := unicos([]primitive.ObjectID{a, b, a, a, b})
+    if len(lista) != 2 || lista[0] != a || lista[1] != b {
+        t.Errorf("unicos = %v, esperado [%v %v]", lista, a, b)
+    }
+    if lista := unicos(nil); len(lista) != 0 {
+        t.Errorf("unicos(nil) = %v", lista)
+    }
+}
+
+func TestFiltroComponentes(t *testing.T) {
+    if filtro := filtroComponentes(models.Produto{Nome: "avulso"}); filtro != nil {
+        t.Errorf("produto sem componentes gerou filtro %v", filtro)
+    }
+
+    a, b := primitive.NewObjectID(), primitive.NewObjectID()
+    kits := []models.Produto{
+        {Componentes: []models.ComponenteKit{{ProdutoID: a, Quantidade: 1}, {ProdutoID: b, VarianteSKU: "P", Quantidade: 2}}},
+        {Componentes: []models.ComponenteKit{{ProdutoID: b, VarianteSKU: "M", Quantidade: 1}}},
+    }
+    dados, err := bson.Marshal(filtroComponentes(kits...))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // O MongoDB só aceita $in com uma lista; um mapa viraria subdocumento
+    valor, err := bson.Raw(dados).LookupErr("_id", "$in")
+    if err != nil {
+        t.Fatalf("filtro sem _id.$in: %v", bson.Raw(dados))
+    }
+    if valor.Type != bsontype.Array {
+        t.Fatalf("$in codificado como %v, esperado lista: %v", valor.Type, bson.Raw(dados))
+    }
+    elementos, err := valor.Array().Values()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(elementos) != 2 || elementos[0].ObjectID() != a || elementos[1].ObjectID() != b {
+        t.Errorf("$in = %v, esperado [%v %v]", elementos, a, b)
+    }
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/database"
+    "estoque-api/models"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Motivos aceitos ao movimentar o estoque manualmente
+var motivosMovimentacao = map[string]bool{
+    "compra":    true,
+    "venda":     true,
+    "devolucao": true,
+    "ajuste":    true,
+    "perda":     true,
+}
+
+// Motivos de transferências internas entre componentes e kits montados.
+// Essas saídas não são consumo e ficam fora dos indicadores de demanda.
+var motivosInternos = []string{"montagem", "desmontagem"}
+
+var movimentacaoCollection *mongo.Collection
+
+// InitializeMovimentacaoHandlers inicializa a collection do histórico de estoque
+func InitializeMovimentacaoHandlers() {
+    movimentacaoCollection = database.DB.Collection("movimentacoes")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    movimentacaoCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {Keys: bson.D{{Key: "produto_id", Value: 1}, {Key: "data", Value: -1}}},
+        {Keys: bson.D{{Key: "data", Value: -1}}},
+    })
+}
+
+// usuarioAtual retorna o ID do usuário autenticado
+func usuarioAtual(c *gin.Context) string {
+    if userID, exists := c.Get("userID"); exists {
+        return fmt.Sprint(userID)
+    }
+    return ""
+}
+
+// registrarMovimentacao grava no histórico uma alteração de estoque já
+// aplicada ao produto. O produto deve refletir o estado após a alteração.
+func registrarMovimentacao(ctx context.Context, produto models.Produto, delta float64, motivo, usuarioID string) error {
+    return registrarMovimentacaoVariante(ctx, produto, "", delta, motivo, usuarioID)
+}
+
+// registrarMovimentacaoVariante grava a alteração de estoque de uma variante.
+// Os saldos registrados continuam sendo os do produto (soma das variantes),
+// para que a reconstrução de saldos passados não dependa das variantes.
+func registrarMovimentacaoVariante(ctx context.Context, produto models.Produto, sku string, delta float64, motivo, usuarioID string) error {
+    if delta == 0 {
+        return nil
+    }
+    return gravarMovimentacao(ctx, novaMovimentacao(produto, sku, delta, motivo, usuarioID))
+}
+
+// novaMovimentacao monta o registro de uma alteração já aplicada ao produto
+func novaMovimentacao(produto models.Produto, sku string, delta float64, motivo, usuarioID string) models.MovimentacaoEstoque {
+    tipo := "entrada"
+    if delta < 0 {
+        tipo = "saida"
+    }
+
+    preco := produto.Preco
+    if v := varianteProduto(produto, sku); v != nil && v.Preco != nil {
+        preco = *v.Preco
+    }
+
+    return models.MovimentacaoEstoque{
+        ID:             primitive.NewObjectID(),
+        ProdutoID:      produto.ID,
+        VarianteSKU:    sku,
+        Tipo:           tipo,
+        Motivo:         motivo,
+        Quantidade:     delta,
+        Unidade:        unidadeProduto(produto),
+        SaldoAnterior:  arredondarQuantidade(produto.Estoque - delta),
+        SaldoPosterior: produto.Estoque,
+        PrecoUnitario:  preco,
+        Categoria:      produto.Categoria,
+        UsuarioID:      usuarioID,
+        Data:           time.Now(),
+    }
+}
+
+func gravarMovimentacao(ctx context.Context, movimentacao models.MovimentacaoEstoque) error {
+    _, err := movimentacaoCollection.InsertOne(ctx, movimentacao)
+    if err != nil {
+        fmt.Printf("Erro ao registrar movimentação do produto %s: %v\n", movimentacao.ProdutoID.Hex(), err)
+    }
+    return err
+}
+
+// totalSaidas acumula as saídas de um produto em um período
+type totalSaidas struct {
+    Quantidade float64
+    Valor      float64
+}
+
+// somarSaidas totaliza por produto as saídas do período [inicio, fim).
+// Se motivos for informado, apenas as saídas com esses motivos são somadas;
+// caso contrário, todas menos as transferências internas de kits.
+func somarSaidas(ctx context.Context, inicio, fim time.Time, motivos ...string) (map[primitive.ObjectID]totalSaidas, error) {
+    match := bson.M{"tipo": "saida", "data": bson.M{"$gte": inicio, "$lt": fim}, "motivo": bson.M{"$nin": motivosInternos}}
+    if len(motivos) > 0 {
+        match["motivo"] = bson.M{"$in": motivos}
+    }
+
+    cursor, err := movimentacaoCollection.Aggregate(ctx, []bson.M{
+        {"$match": match},
+        {"$group": bson.M{
+            "_id":        "$produto_id",
+            "quantidade": bson.M{"$sum": bson.M{"$abs": "$quantidade"}},
+            "valor":      bson.M{"$sum": bson.M{"$multiply": []interface{}{bson.M{"$abs": "$quantidade"}, "$preco_unitario"}}},
+        }},
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    var resultados []struct {
+        ID         primitive.ObjectID `bson:"_id"`
+        Quantidade float64            `bson:"quantidade"`
+        Valor      float64            `bson:"valor"`
+    }
+    if err := cursor.All(ctx, &resultados); err != nil {
+        return nil, err
+    }
+
+    saidas := make(map[primitive.ObjectID]totalSaidas, len(resultados))
+    for _, r := range resultados {
+        saidas[r.ID] = totalSaidas{Quantidade: r.Quantidade, Valor: r.Valor}
+    }
+    return saidas, nil
+}
+
+// GetMovimentacoesProduto lista o histórico de movimentações de um produto,
+// do mais recente para o mais antigo
+func GetMovimentacoesProduto(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    limite, _ := strconv.Atoi(c.DefaultQuery("limite", "100"))
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    opts := options.Find().SetSort(bson.M{"data": -1}).SetLimit(int64(limite))
+    cursor, err := movimentacaoCollection.Find(ctx, bson.M{"produto_id": id}, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    movimentacoes := []models.MovimentacaoEstoque{}
+    if err = cursor.All(ctx, &movimentacoes); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, movimentacoes)
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/config"
+    "estoque-api/database"
+    "estoque-api/models"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// Contadores de falhas de login, um por conta (conta:<email>) e um por IP
+// (ip:<endereço>). Expiram pelo índice TTL quando não há falhas recentes.
+var tentativasLoginCollection *mongo.Collection
+
+// Eventos de segurança (bloqueios) consultados pelos admins
+var eventosSegurancaCollection *mongo.Collection
+
+// Hash comparado quando o email não existe, para que a resposta leve o mesmo
+// tempo de um email cadastrado com a senha errada
+var hashFicticio []byte
+
+func maximoFalhasConta() int {
+    return config.GetInt("LOGIN_MAX_FALHAS_CONTA", 5)
+}
+
+func maximoFalhasIP() int {
+    return config.GetInt("LOGIN_MAX_FALHAS_IP", 20)
+}
+
+// janelaFalhasLogin é o intervalo sem falhas após o qual o contador recomeça
+func janelaFalhasLogin() time.Duration {
+    return config.GetDuration("LOGIN_JANELA_FALHAS", 15*time.Minute)
+}
+
+func duracaoBloqueioLogin() time.Duration {
+    return config.GetDuration("LOGIN_BLOQUEIO", 15*time.Minute)
+}
+
+func inicializarProtecaoLogin() {
+    tentativasLoginCollection = database.DB.Collection("tentativas_login")
+    eventosSegurancaCollection = database.DB.Collection("eventos_seguranca")
+
+    hashFicticio, _ = bcrypt.GenerateFromPassword([]byte(primitive.NewObjectID().Hex()), bcrypt.DefaultCost)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    tentativasLoginCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys:    bson.D{{Key: "expira_em", Value: 1}},
+        Options: options.Index().SetExpireAfterSeconds(0),
+    })
+    eventosSegurancaCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {Keys: bson.D{{Key: "data", Value: -1}}},
+        {Keys: bson.D{{Key: "email", Value: 1}, {Key: "data", Value: -1}}},
+    })
+}
+
+// chaveConta identifica o contador de uma conta pelo email normalizado. O
+// contador existe mesmo para emails não cadastrados, então o bloqueio não
+// revela quais contas existem.
+func chaveConta(email string) string {
+    return "conta:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func chaveIP(ip string) string {
+    return "ip:" + ip
+}
+
+// bloqueioLogin retorna até quando o login está bloqueado para alguma das
+// chaves (zero se não estiver)
+func bloqueioLogin(ctx context.Context, chaves ...string) (time.Time, error) {
+    cursor, err := tentativasLoginCollection.Find(ctx, bson.M{
+        "_id":           bson.M{"$in": chaves},
+        "bloqueado_ate": bson.M{"$gt": time.Now()},
+    })
+    if err != nil {
+        return time.Time{}, err
+    }
+    var contadores []models.TentativasLogin
+    if err := cursor.All(ctx, &contadores); err != nil {
+        return time.Time{}, err
+    }
+
+    var ate time.Time
+    for _, t := range contadores {
+        if t.BloqueadoAte != nil && t.BloqueadoAte.After(ate) {
+            ate = *t.BloqueadoAte
+        }
+    }
+    return ate, nil
+}
+
+// registrarFalhaLogin incrementa o contador da chave, recomeçando a contagem
+// se a última falha saiu da janela, e bloqueia a chave ao atingir o máximo.
+// O bloqueio é registrado como evento de segurança. Retorna o número de
+// falhas na janela.
+func registrarFalhaLogin(ctx context.Context, chave string, maximo int, email, ip string) (int, error) {
+    agora := time.Now()
+    janela := janelaFalhasLogin()
+    bloqueio := duracaoBloqueioLogin()
+
+    var contador models.TentativasLogin
+    err := tentativasLoginCollection.FindOneAndUpdate(ctx,
+        bson.M{"_id": chave},
+        mongo.Pipeline{{{Key: "$set", Value: bson.M{
+            "falhas": bson.M{"$cond": bson.A{
+                bson.M{"$gt": bson.A{"$ultima_falha", agora.Add(-janela)}},
+                bson.M{"$add": bson.A{"$falhas", 1}},
+                1,
+            }},
+            "ultima_falha": agora,
+            "expira_em":    agora.Add(janela + bloqueio),
+        }}}},
+        options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+    ).Decode(&contador)
+    if err != nil {
+        return 0, err
+    }
+    if contador.Falhas < maximo {
+        return contador.Falhas, nil
+    }
+
+    // Só quem efetivamente bloqueia registra o evento
+    ate := agora.Add(bloqueio)
+    resultado, err := tentativasLoginCollection.UpdateOne(ctx,
+        bson.M{"_id": chave, "bloqueado_ate": bson.M{"$not": bson.M{"$gt": agora}}},
+        bson.M{"$set": bson.M{"bloqueado_ate": ate}},
+    )
+    if err != nil {
+        return contador.Falhas, err
+    }
+    if resultado.ModifiedCount > 0 {
+        tipo := "bloqueio_conta"
+        if strings.HasPrefix(chave, "ip:") {
+            tipo = "bloqueio_ip"
+        }
+        evento := models.EventoSeguranca{
+            ID:           primitive.NewObjectID(),
+            Tipo:         tipo,
+            Email:        strings.ToLower(strings.TrimSpace(email)),
+            IP:           ip,
+            Falhas:       contador.Falhas,
+            BloqueadoAte: &ate,
+            Data:         agora,
+        }
+        if _, err := eventosSegurancaCollection.InsertOne(ctx, evento); err != nil {
+            fmt.Printf("Erro ao registrar o evento de bloqueio de %s: %v\n", chave, err)
+        }
+        fmt.Printf("Login bloqueado para %s até %s após %d falhas\n", chave, ate.Format(time.RFC3339), contador.Falhas)
+    }
+    return contador.Falhas, nil
+}
+
+// atrasoFalhaLogin é a espera antes de responder a uma falha, dobrando a
+// cada falha seguida a partir da segunda (0,5s, 1s, 2s...) até 8s
+func atrasoFalhaLogin(falhas int) time.Duration {
+    if falhas < 2 {
+        return 0
+    }
+    atraso := time.Duration(math.Pow(2, float64(falhas-2))) * 500 * time.Millisecond
+    if atraso > 8*time.Second || atraso <= 0 {
+        atraso = 8 * time.Second
+    }
+    return atraso
+}
+
+// responderBloqueioLogin informa que há tentativas demais, sem dizer se o
+// bloqueio é da conta ou do IP
+func responderBloqueioLogin(c *gin.Context, ate time.Time) {
+    segundos := int(math.Ceil(time.Until(ate).Seconds()))
+    c.Header("Retry-After", strconv.Itoa(max(segundos, 1)))
+    c.JSON(http.StatusTooManyRequests, gin.H{"error": "Muitas tentativas de login, tente novamente mais tarde"})
+}
+
+// reautenticacaoBloqueada confere, antes de pedir a senha ou um código a um
+// usuário já autenticado, se a conta ou o IP estão bloqueados. Se estiverem,
+// responde e retorna true.
+func reautenticacaoBloqueada(ctx context.Context, c *gin.Context, user models.User) bool {
+    bloqueadoAte, err := bloqueioLogin(ctx, chaveConta(user.Email), chaveIP(c.ClientIP()))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return true
+    }
+    if !bloqueadoAte.IsZero() {
+        responderBloqueioLogin(c, bloqueadoAte)
+        return true
+    }
+    return false
+}
+
+// registrarFalhaReautenticacao conta uma senha ou código errado como falha
+// de login da conta e do IP, para que um token roubado não permita testar
+// senhas e códigos à vontade, e aplica o atraso correspondente
+func registrarFalhaReautenticacao(ctx context.Context, c *gin.Context, user models.User) {
+    ip := c.ClientIP()
+    falhasConta, errConta := registrarFalhaLogin(ctx, chaveConta(user.Email), maximoFalhasConta(), user.Email, ip)
+    falhasIP, errIP := registrarFalhaLogin(ctx, chaveIP(ip), maximoFalhasIP(), user.Email, ip)
+    if errConta != nil || errIP != nil {
+        fmt.Printf("Erro ao registrar falha de login: %v %v\n", errConta, errIP)
+    }
+    time.Sleep(atrasoFalhaLogin(max(falhasConta, falhasIP)))
+}
+
+// conferirSenhaAtual confere a senha do usuário autenticado com as mesmas
+// proteções do login. Se estiver errada ou a conta bloqueada, responde e
+// retorna false.
+func conferirSenhaAtual(ctx context.Context, c *gin.Context, user models.User, senha, mensagem string) bool {
+    if reautenticacaoBloqueada(ctx, c, user) {
+        return false
+    }
+    if bcrypt.CompareHashAndPassword([]byte(user.Senha), []byte(senha)) != nil {
+        registrarFalhaReautenticacao(ctx, c, user)
+        c.JSON(http.StatusUnauthorized, gin.H{"error": mensagem})
+        return false
+    }
+    return true
+}
+
+// GetEventosSeguranca lista os eventos de segurança mais recentes, com
+// filtros opcionais por tipo e email
+func GetEventosSeguranca(c *gin.Context) {
+    filtro := bson.M{}
+    if tipo := c.Query("tipo"); tipo != "" {
+        filtro["tipo"] = tipo
+    }
+    if email := c.Query("email"); email != "" {
+        filtro["email"] = strings.ToLower(strings.TrimSpace(email))
+    }
+    limite, _ := strconv.Atoi(c.DefaultQuery("limite", "50"))
+    if limite <= 0 || limite > 500 {
+        limite = 50
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    opts := options.Find().SetSort(bson.M{"data": -1}).SetLimit(int64(limite))
+    cursor, err := eventosSegurancaCollection.Find(ctx, filtro, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    eventos := []models.EventoSeguranca{}
+    if err := cursor.All(ctx, &eventos); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, eventos)
+}
+
+// DesbloquearUsuario zera o contador de falhas da conta, encerrando um
+// bloqueio antes do prazo
+func DesbloquearUsuario(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    user, ok := buscarUsuario(ctx, c, id)
+    if !ok {
+        return
+    }
+    if _, err := tentativasLoginCollection.DeleteOne(ctx, bson.M{"_id": chaveConta(user.Email)}); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    eventosSegurancaCollection.InsertOne(ctx, models.EventoSeguranca{
+        ID:          primitive.NewObjectID(),
+        Tipo:        "desbloqueio_conta",
+        Email:       strings.ToLower(strings.TrimSpace(user.Email)),
+        Responsavel: c.GetString("userID"),
+        Data:        time.Now(),
+    })
+    c.JSON(http.StatusOK, gin.H{"message": "Usuário desbloqueado"})
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "estoque-api/cache"
+    "estoque-api/config"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+// timeoutRelatorio é o tempo máximo das consultas de relatórios,
+// configurável em RELATORIO_TIMEOUT (padrão 60s)
+func timeoutRelatorio() time.Duration {
+    return config.GetDuration("RELATORIO_TIMEOUT", 60*time.Second)
+}
+
+// ttlCacheRelatorio é o tempo que um resultado de relatório fica em cache,
+// configurável em RELATORIO_CACHE_TTL (padrão 5m; "0s" desativa o cache)
+func ttlCacheRelatorio() time.Duration {
+    return config.GetDuration("RELATORIO_CACHE_TTL", 5*time.Minute)
+}
+
+// chaveCache identifica o resultado pela rota e pelos parâmetros da consulta.
+// O formato não entra na chave, pois só muda a forma de apresentação.
+func chaveCache(c *gin.Context) string {
+    parametros := url.Values{}
+    for k, v := range c.Request.URL.Query() {
+        if k != "formato" {
+            parametros[k] = v
+        }
+    }
+    // Encode ordena as chaves, então a mesma consulta sempre gera a mesma chave
+    return c.FullPath() + "?" + parametros.Encode()
+}
+
+// emCache retorna o resultado guardado para a consulta ou executa calcular
+// e guarda o resultado. O segundo retorno indica se veio do cache.
+func emCache[T any](c *gin.Context, calcular func(ctx context.Context) (T, error)) (T, bool, error) {
+    chave := chaveCache(c)
+    if valor, ok := cache.Get(chave); ok {
+        if resultado, ok := valor.(T); ok {
+            return resultado, true, nil
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    resultado, err := calcular(ctx)
+    if err != nil {
+        return resultado, false, err
+    }
+
+    if ttl := ttlCacheRelatorio(); ttl > 0 {
+        cache.Set(chave, resultado, ttl)
+    }
+    return resultado, false, nil
+}
+
+// metaRelatorio monta os metadados comuns da resposta dos relatórios:
+// momento da geração, filtros aplicados e se o resultado veio do cache
+func metaRelatorio(c *gin.Context, doCache bool, extra gin.H) gin.H {
+    filtros := gin.H{}
+    for _, campo := range append(camposFiltroProdutos, "q") {
+        if v := c.Query(campo); v != "" {
+            filtros[campo] = v
+        }
+    }
+
+    meta := gin.H{
+        "gerado_em": time.Now(),
+        "filtros":   filtros,
+        "cache":     doCache,
+    }
+    for k, v := range extra {
+        meta[k] = v
+    }
+    return meta
+}
+
+// metaPeriodo descreve o período [inicio, fim) de um relatório
+func metaPeriodo(inicio, fim time.Time) gin.H {
+    return gin.H{
+        "inicio": inicio.Format("2006-01-02"),
+        "fim":    fim.AddDate(0, 0, -1).Format("2006-01-02"),
+    }
+}
+
+// periodoRelatorio lê os parâmetros inicio e fim (YYYY-MM-DD). Sem inicio, o
+// período começa padraoDias antes do fim; sem fim, termina hoje. O fim
+// retornado é exclusivo (início do dia seguinte).
+func periodoRelatorio(c *gin.Context, padraoDias int) (time.Time, time.Time, error) {
+    hoje := time.Now()
+    fim := time.Date(hoje.Year(), hoje.Month(), hoje.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+    if v := c.Query("fim"); v != "" {
+        dia, err := time.ParseInLocation("2006-01-02", v, time.Local)
+        if err != nil {
+            return time.Time{}, time.Time{}, errors.New("data fim inválida, use o formato YYYY-MM-DD")
+        }
+        fim = dia.AddDate(0, 0, 1)
+    }
+
+    inicio := fim.AddDate(0, 0, -padraoDias)
+    if v := c.Query("inicio"); v != "" {
+        dia, err := time.ParseInLocation("2006-01-02", v, time.Local)
+        if err != nil {
+            return time.Time{}, time.Time{}, errors.New("data inicio inválida, use o formato YYYY-MM-DD")
+        }
+        inicio = dia
+    }
+
+    if !inicio.Before(fim) {
+        return time.Time{}, time.Time{}, errors.New("a data inicio deve ser anterior à data fim")
+    }
+    return inicio, fim, nil
+}
+
+// prefixarFiltro adapta um filtro de produtos para ser aplicado sobre um
+// subdocumento, como o resultado de um $lookup
+func prefixarFiltro(filtro bson.M, prefixo string) bson.M {
+    prefixado := bson.M{}
+    for k, v := range filtro {
+        if strings.HasPrefix(k, "$") {
+            if condicoes, ok := v.([]bson.M); ok {
+                novas := make([]bson.M, len(condicoes))
+                for i, cond := range condicoes {
+                    novas[i] = prefixarFiltro(cond, prefixo)
+                }
+                prefixado[k] = novas
+                continue
+            }
+            prefixado[k] = v
+            continue
+        }
+        prefixado[prefixo+"."+k] = v
+    }
+    return prefixado
+}
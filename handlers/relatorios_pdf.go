@@ -0,0 +1,236 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/config"
+    "estoque-api/models"
+    "estoque-api/pdf"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// filtrosAplicados descreve os filtros da requisição para o cabeçalho do relatório
+func filtrosAplicados(c *gin.Context) []string {
+    var filtros []string
+    for _, campo := range append(camposFiltroProdutos, "q") {
+        if v := c.Query(campo); v != "" {
+            filtros = append(filtros, fmt.Sprintf("%s: %s", campo, v))
+        }
+    }
+    return filtros
+}
+
+// enviarPDF gera o documento e o envia como download
+func enviarPDF(c *gin.Context, nome string, relatorio *pdf.Relatorio) {
+    prepararDownload(c, nome, "pdf")
+    c.Header("Content-Type", "application/pdf")
+    relatorio.WriteTo(c.Writer)
+}
+
+// numero converte os tipos numéricos retornados pelas agregações em float64
+func numero(v interface{}) float64 {
+    switch n := v.(type) {
+    case int32:
+        return float64(n)
+    case int64:
+        return float64(n)
+    case int:
+        return float64(n)
+    case float64:
+        return n
+    }
+    return 0
+}
+
+func textoRelatorio(v interface{}) string {
+    if v == nil {
+        return ""
+    }
+    return fmt.Sprint(valorExportacao(v))
+}
+
+// formatarQuantidade escreve a quantidade com casas decimais apenas quando
+// fracionada
+func formatarQuantidade(v float64) string {
+    if inteira(v) {
+        return pdf.FormatarNumero(v, 0)
+    }
+    return pdf.FormatarNumero(v, 3)
+}
+
+func nomeCategoria(v interface{}) string {
+    if s, ok := v.(string); ok && s != "" {
+        return s
+    }
+    return "Sem categoria"
+}
+
+// relatorioEstoquePDF lista os produtos agrupados por categoria, com
+// subtotais por categoria e total geral. Os produtos devem vir ordenados por
+// categoria; proximo retorna false quando não houver mais produtos.
+func relatorioEstoquePDF(c *gin.Context, titulo string, proximo func() (models.Produto, bool)) {
+    relatorio := pdf.NovoRelatorio(config.Get("EMPRESA_NOME", "Estoque API"), titulo, filtrosAplicados(c), []pdf.Coluna{
+        {Titulo: "Código", Largura: 2},
+        {Titulo: "Produto", Largura: 4},
+        {Titulo: "Estoque", Largura: 1.2, Direita: true},
+        {Titulo: "Preço", Largura: 1.6, Direita: true},
+        {Titulo: "Valor", Largura: 1.8, Direita: true},
+    })
+
+    var categoriaAtual string
+    var itensCategoria, itensTotal, valorCategoria, valorTotal float64
+    primeira := true
+
+    fecharCategoria := func() {
+        relatorio.Subtotal([]string{"", "Subtotal " + categoriaAtual, formatarQuantidade(itensCategoria), "", pdf.FormatarMoeda(valorCategoria)})
+    }
+
+    for produto, ok := proximo(); ok; produto, ok = proximo() {
+        categoria := nomeCategoria(produto.Categoria)
+        if primeira || categoria != categoriaAtual {
+            if !primeira {
+                fecharCategoria()
+            }
+            primeira = false
+            categoriaAtual = categoria
+            itensCategoria, valorCategoria = 0, 0
+            relatorio.Secao(categoria)
+        }
+
+        valor := valorEstoque(produto)
+        relatorio.Linha([]string{
+            produto.CodigoBarras,
+            produto.Nome,
+            formatarQuantidade(produto.Estoque) + " " + unidadeProduto(produto),
+            pdf.FormatarMoeda(produto.Preco),
+            pdf.FormatarMoeda(valor),
+        })
+
+        itensCategoria += produto.Estoque
+        itensTotal += produto.Estoque
+        valorCategoria += valor
+        valorTotal += valor
+    }
+    if !primeira {
+        fecharCategoria()
+    }
+
+    relatorio.Total([]string{"", "Total geral", formatarQuantidade(itensTotal), "", pdf.FormatarMoeda(valorTotal)})
+    enviarPDF(c, "relatorio_estoque", relatorio)
+}
+
+// relatorioEstoqueAtualPDF gera o relatório de estoque com os saldos atuais
+func relatorioEstoqueAtualPDF(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    opts := options.Find().SetSort(bson.D{{Key: "categoria", Value: 1}, {Key: "nome", Value: 1}})
+    cursor, err := collection.Find(ctx, filtroProdutos(c), opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    relatorioEstoquePDF(c, "Relatório de Estoque", func() (models.Produto, bool) {
+        for cursor.Next(ctx) {
+            var produto models.Produto
+            if err := cursor.Decode(&produto); err == nil {
+                return produto, true
+            }
+        }
+        return models.Produto{}, false
+    })
+}
+
+// relatorioValorTotalPDF resume a valorização do estoque por categoria
+func relatorioValorTotalPDF(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    pipeline := []bson.M{
+        {"$match": filtroProdutos(c)},
+        {
+            "$group": bson.M{
+                "_id":            "$categoria",
+                "total_produtos": bson.M{"$sum": 1},
+                "total_itens":    bson.M{"$sum": "$estoque"},
+                "valor_total":    bson.M{"$sum": valorEstoqueExpr},
+            },
+        },
+        {"$sort": bson.M{"_id": 1}},
+    }
+
+    cursor, err := collection.Aggregate(ctx, pipeline)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    var resultados []bson.M
+    if err = cursor.All(ctx, &resultados); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    relatorio := pdf.NovoRelatorio(config.Get("EMPRESA_NOME", "Estoque API"), "Valorização do Estoque", filtrosAplicados(c), []pdf.Coluna{
+        {Titulo: "Categoria", Largura: 4},
+        {Titulo: "Produtos", Largura: 1.5, Direita: true},
+        {Titulo: "Itens", Largura: 1.5, Direita: true},
+        {Titulo: "Valor", Largura: 2.5, Direita: true},
+    })
+
+    var produtos, itens, valor float64
+    for _, r := range resultados {
+        relatorio.Linha([]string{
+            nomeCategoria(r["_id"]),
+            pdf.FormatarNumero(numero(r["total_produtos"]), 0),
+            pdf.FormatarNumero(numero(r["total_itens"]), 0),
+            pdf.FormatarMoeda(numero(r["valor_total"])),
+        })
+        produtos += numero(r["total_produtos"])
+        itens += numero(r["total_itens"])
+        valor += numero(r["valor_total"])
+    }
+
+    relatorio.Total([]string{
+        "Total geral",
+        pdf.FormatarNumero(produtos, 0),
+        pdf.FormatarNumero(itens, 0),
+        pdf.FormatarMoeda(valor),
+    })
+    enviarPDF(c, "valor_total_estoque", relatorio)
+}
+
+// relatorioMaisVendidosPDF imprime o ranking de produtos mais vendidos
+func relatorioMaisVendidosPDF(c *gin.Context, resultados []bson.M) {
+    relatorio := pdf.NovoRelatorio(config.Get("EMPRESA_NOME", "Estoque API"), "Produtos Mais Vendidos", filtrosAplicados(c), []pdf.Coluna{
+        {Titulo: "#", Largura: 0.6, Direita: true},
+        {Titulo: "Código", Largura: 2},
+        {Titulo: "Produto", Largura: 4},
+        {Titulo: "Categoria", Largura: 2},
+        {Titulo: "Vendas", Largura: 1.4, Direita: true},
+    })
+
+    var vendas float64
+    for i, r := range resultados {
+        relatorio.Linha([]string{
+            strconv.Itoa(i + 1),
+            textoRelatorio(r["codigo_barras"]),
+            textoRelatorio(r["nome"]),
+            nomeCategoria(r["categoria"]),
+            pdf.FormatarNumero(numero(r["vendas_totais"]), 0),
+        })
+        vendas += numero(r["vendas_totais"])
+    }
+
+    relatorio.Total([]string{"", "", "Total", "", pdf.FormatarNumero(vendas, 0)})
+    enviarPDF(c, "produtos_mais_vendidos", relatorio)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/auth"
+    "estoque-api/config"
+    "estoque-api/database"
+    "estoque-api/email"
+    "estoque-api/models"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "golang.org/x/crypto/bcrypt"
+)
+
+var redefinicaoSenhaCollection *mongo.Collection
+
+// Remetente dos emails da API (EMAIL_ENVIO: smtp, o padrão, log ou memoria).
+// O log escreve os links de redefinição na saída e só deve ser usado em
+// desenvolvimento, por escolha explícita. Sem SMTP configurado fica nil e a
+// redefinição de senha por email fica desativada.
+var remetenteEmail email.Remetente
+
+// inicializarSenhas configura o envio de emails e cria os índices dos
+// pedidos de redefinição, apagados pelo índice TTL depois de expirar
+func inicializarSenhas() {
+    redefinicaoSenhaCollection = database.DB.Collection("redefinicoes_senha")
+
+    tipo := config.Get("EMAIL_ENVIO", "smtp")
+    remetente, err := email.Novo(tipo)
+    switch {
+    case err != nil:
+        log.Printf("Atenção: envio de email não configurado (%v); a redefinição de senha por email está desativada. Defina SMTP_HOST e SMTP_REMETENTE, ou EMAIL_ENVIO=log em desenvolvimento", err)
+    case tipo != "smtp":
+        log.Printf("Atenção: EMAIL_ENVIO=%s, os emails (inclusive links de redefinição de senha) não são enviados", tipo)
+    }
+    if err == nil {
+        remetenteEmail = remetente
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    redefinicaoSenhaCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "hash", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {Keys: bson.D{{Key: "user_id", Value: 1}}},
+        {
+            Keys:    bson.D{{Key: "expira_em", Value: 1}},
+            Options: options.Index().SetExpireAfterSeconds(0),
+        },
+    })
+}
+
+// validarSenha confere a nova senha contra a política de senhas. Se ela for
+// recusada, responde com a lista de problemas e retorna false.
+func validarSenha(c *gin.Context, senha, email, nome string) bool {
+    problemas := auth.Politica().Validar(senha, email, nome)
+    if len(problemas) == 0 {
+        return true
+    }
+    c.JSON(http.StatusBadRequest, gin.H{"error": "A senha não atende à política de senhas", "details": problemas})
+    return false
+}
+
+// GetPoliticaSenha informa os requisitos das senhas, para que os clientes
+// possam orientar o usuário antes do envio
+func GetPoliticaSenha(c *gin.Context) {
+    c.JSON(http.StatusOK, auth.Politica())
+}
+
+// gravarSenha troca o hash da senha do usuário e encerra todas as sessões
+// dele, para que quem conhecia a senha antiga perca o acesso
+func gravarSenha(ctx context.Context, userID primitive.ObjectID, senha string) error {
+    hash, err := bcrypt.GenerateFromPassword([]byte(senha), bcrypt.DefaultCost)
+    if err != nil {
+        return err
+    }
+    _, err = userCollection.UpdateOne(ctx,
+        bson.M{"_id": userID},
+        bson.M{"$set": bson.M{"senha": string(hash), "data_alteracao_senha": time.Now()}},
+    )
+    if err != nil {
+        return err
+    }
+    return encerrarSessoesUsuario(ctx, userID, "senha alterada")
+}
+
+// mensagemRedefinicao monta o email com o token. Com SENHA_URL_REDEFINICAO
+// (por exemplo https://app.exemplo.com/redefinir-senha) o email traz o link
+// com o token; sem ela, apenas o token.
+func mensagemRedefinicao(user models.User, token string, validade time.Duration) email.Mensagem {
+    instrucao := "Use o código abaixo em POST /senha/redefinir:\n\n" + token
+    if base := config.Get("SENHA_URL_REDEFINICAO", ""); base != "" {
+        instrucao = "Acesse o link abaixo para criar uma nova senha:\n\n" + base + "?token=" + url.QueryEscape(token)
+    }
+    return email.Mensagem{
+        Para:    user.Email,
+        Assunto: "Redefinição de senha",
+        Corpo: fmt.Sprintf("Olá, %s.\n\nRecebemos um pedido para redefinir a sua senha. %s\n\n"+
+            "O pedido vale por %s e pode ser usado uma única vez. Se você não fez o pedido, ignore este email.\n",
+            user.Nome, instrucao, validade),
+    }
+}
+
+// EsqueciSenha envia por email um token para redefinir a senha. A resposta é
+// sempre a mesma, exista ou não o email, para não revelar quais contas
+// existem; o envio é feito em segundo plano pelo mesmo motivo.
+func EsqueciSenha(c *gin.Context) {
+    var dados struct {
+        Email string `json:"email" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o email"})
+        return
+    }
+
+    if remetenteEmail == nil {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Redefinição de senha por email não está disponível; procure um administrador"})
+        return
+    }
+
+    resposta := gin.H{"message": "Se o email estiver cadastrado, você receberá as instruções para redefinir a senha"}
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var user models.User
+    if err := userCollection.FindOne(ctx, bson.M{"email": dados.Email, "ativo": true, "conta_servico": bson.M{"$ne": true}}).Decode(&user); err != nil {
+        if err != mongo.ErrNoDocuments {
+            fmt.Printf("Erro ao buscar usuário para redefinição de senha: %v\n", err)
+        }
+        c.JSON(http.StatusOK, resposta)
+        return
+    }
+
+    token, hash, err := auth.GenerateOpaqueToken()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
+        return
+    }
+
+    // Um novo pedido invalida os anteriores ainda não usados
+    agora := time.Now()
+    validade := auth.ValidadeRedefinicaoSenha()
+    if _, err := redefinicaoSenhaCollection.DeleteMany(ctx, bson.M{"user_id": user.ID, "data_uso": bson.M{"$exists": false}}); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    _, err = redefinicaoSenhaCollection.InsertOne(ctx, models.RedefinicaoSenha{
+        ID:          primitive.NewObjectID(),
+        UserID:      user.ID,
+        Hash:        hash,
+        DataCriacao: agora,
+        ExpiraEm:    agora.Add(validade),
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    msg := mensagemRedefinicao(user, token, validade)
+    go func() {
+        ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+        defer cancel()
+        if err := remetenteEmail.Enviar(ctx, msg); err != nil {
+            fmt.Printf("Erro ao enviar o email de redefinição de senha para %s: %v\n", msg.Para, err)
+        }
+    }()
+
+    c.JSON(http.StatusOK, resposta)
+}
+
+// RedefinirSenha troca a senha usando o token recebido por email. O token é
+// marcado como usado antes da troca, então só vale uma vez.
+func RedefinirSenha(c *gin.Context) {
+    var dados struct {
+        Token     string `json:"token" binding:"required"`
+        NovaSenha string `json:"nova_senha" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o token e a nova_senha"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    // O pedido só é consumido depois que a nova senha passa pela política,
+    // para que o usuário possa tentar outra senha com o mesmo token
+    agora := time.Now()
+    filtro := bson.M{
+        "hash":      auth.HashOpaqueToken(dados.Token),
+        "data_uso":  bson.M{"$exists": false},
+        "expira_em": bson.M{"$gt": agora},
+    }
+    var pedido models.RedefinicaoSenha
+    err := redefinicaoSenhaCollection.FindOne(ctx, filtro).Decode(&pedido)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Token inválido ou expirado"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    var user models.User
+    if err := userCollection.FindOne(ctx, bson.M{"_id": pedido.UserID, "ativo": true}).Decode(&user); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Token inválido ou expirado"})
+        return
+    }
+    if !validarSenha(c, dados.NovaSenha, user.Email, user.Nome) {
+        return
+    }
+
+    filtro["_id"] = pedido.ID
+    resultado, err := redefinicaoSenhaCollection.UpdateOne(ctx, filtro, bson.M{"$set": bson.M{"data_uso": agora}})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if resultado.ModifiedCount == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Token inválido ou expirado"})
+        return
+    }
+    if err := gravarSenha(ctx, pedido.UserID, dados.NovaSenha); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao alterar a senha", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Senha redefinida, faça login com a nova senha"})
+}
+
+// AlterarSenha troca a senha do usuário autenticado, que precisa informar a
+// senha atual. As outras sessões são encerradas e a resposta traz os tokens
+// de uma nova sessão.
+func AlterarSenha(c *gin.Context) {
+    var dados struct {
+        SenhaAtual string `json:"senha_atual" binding:"required"`
+        NovaSenha  string `json:"nova_senha" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe a senha_atual e a nova_senha"})
+        return
+    }
+
+    id, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    user, ok := buscarUsuario(ctx, c, id)
+    if !ok {
+        return
+    }
+    if !conferirSenhaAtual(ctx, c, user, dados.SenhaAtual, "Senha atual incorreta") {
+        return
+    }
+    if !validarSenha(c, dados.NovaSenha, user.Email, user.Nome) {
+        return
+    }
+    if dados.NovaSenha == dados.SenhaAtual {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "A nova senha deve ser diferente da atual"})
+        return
+    }
+
+    if err := gravarSenha(ctx, id, dados.NovaSenha); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao alterar a senha", "details": err.Error()})
+        return
+    }
+    sessao, err := emitirSessao(ctx, user, primitive.NewObjectID())
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Senha alterada, mas houve erro ao gerar o token"})
+        return
+    }
+    sessao["message"] = "Senha alterada"
+    c.JSON(http.StatusOK, sessao)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/auth"
+    "estoque-api/database"
+    "estoque-api/models"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var refreshTokenCollection *mongo.Collection
+
+// inicializarSessoes cria os índices dos refresh tokens e da lista de tokens
+// revogados. Os refresh tokens expirados são apagados pelo índice TTL.
+func inicializarSessoes() {
+    refreshTokenCollection = database.DB.Collection("refresh_tokens")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    refreshTokenCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "hash", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {Keys: bson.D{{Key: "familia", Value: 1}}},
+        {Keys: bson.D{{Key: "user_id", Value: 1}}},
+        {
+            Keys:    bson.D{{Key: "expira_em", Value: 1}},
+            Options: options.Index().SetExpireAfterSeconds(0),
+        },
+    })
+    auth.InicializarRevogacao()
+}
+
+// emitirSessao gera um token de acesso e um refresh token para o usuário. O
+// refresh token pertence à família informada, que identifica a sessão.
+func emitirSessao(ctx context.Context, user models.User, familia primitive.ObjectID) (gin.H, error) {
+    token, claims, err := auth.GenerateToken(user.ID.Hex(), user.Role)
+    if err != nil {
+        return nil, err
+    }
+    refresh, hash, err := auth.GenerateOpaqueToken()
+    if err != nil {
+        return nil, err
+    }
+
+    agora := time.Now()
+    registro := models.RefreshToken{
+        ID:           primitive.NewObjectID(),
+        UserID:       user.ID,
+        Hash:         hash,
+        Familia:      familia,
+        AcessoJTI:    claims.Id,
+        AcessoExpira: time.Unix(claims.ExpiresAt, 0),
+        DataCriacao:  agora,
+        ExpiraEm:     agora.Add(auth.ValidadeRefreshToken()),
+    }
+    if _, err := refreshTokenCollection.InsertOne(ctx, registro); err != nil {
+        return nil, err
+    }
+
+    return gin.H{
+        "token":             token,
+        "expira_em":         registro.AcessoExpira,
+        "refresh_token":     refresh,
+        "refresh_expira_em": registro.ExpiraEm,
+    }, nil
+}
+
+// revogarSessoes encerra os refresh tokens do filtro e coloca na lista de
+// revogados os tokens de acesso emitidos com eles que ainda não expiraram,
+// inclusive os de refresh tokens já trocados
+func revogarSessoes(ctx context.Context, filtro bson.M, motivo string) error {
+    agora := time.Now()
+
+    acesso := bson.M{"acesso_expira": bson.M{"$gt": agora}}
+    for k, v := range filtro {
+        acesso[k] = v
+    }
+    cursor, err := refreshTokenCollection.Find(ctx, acesso)
+    if err != nil {
+        return err
+    }
+    var tokens []models.RefreshToken
+    if err := cursor.All(ctx, &tokens); err != nil {
+        return err
+    }
+    for _, t := range tokens {
+        if err := auth.RevogarToken(ctx, t.AcessoJTI, t.UserID.Hex(), t.AcessoExpira); err != nil {
+            return err
+        }
+    }
+
+    ativos := bson.M{"data_revogacao": bson.M{"$exists": false}}
+    for k, v := range filtro {
+        ativos[k] = v
+    }
+    _, err = refreshTokenCollection.UpdateMany(ctx, ativos, bson.M{"$set": bson.M{
+        "data_revogacao": agora,
+        "motivo":         motivo,
+    }})
+    return err
+}
+
+// encerrarSessoesUsuario revoga todas as sessões do usuário
+func encerrarSessoesUsuario(ctx context.Context, userID primitive.ObjectID, motivo string) error {
+    return revogarSessoes(ctx, bson.M{"user_id": userID}, motivo)
+}
+
+// Refresh troca um refresh token válido por um novo par de tokens. O token
+// usado é revogado; se ele for apresentado de novo, a sessão inteira é
+// encerrada, pois apenas quem o copiou poderia reutilizá-lo.
+func Refresh(c *gin.Context) {
+    var dados struct {
+        RefreshToken string `json:"refresh_token" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o refresh_token"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    agora := time.Now()
+    hash := auth.HashOpaqueToken(dados.RefreshToken)
+    var token models.RefreshToken
+    err := refreshTokenCollection.FindOneAndUpdate(ctx,
+        bson.M{"hash": hash, "data_revogacao": bson.M{"$exists": false}, "expira_em": bson.M{"$gt": agora}},
+        bson.M{"$set": bson.M{"data_revogacao": agora, "motivo": "renovado"}},
+    ).Decode(&token)
+    if err == mongo.ErrNoDocuments {
+        // Um token já trocado sendo usado de novo: encerra a sessão
+        if refreshTokenCollection.FindOne(ctx, bson.M{"hash": hash, "motivo": "renovado"}).Decode(&token) == nil {
+            fmt.Printf("Reuso de refresh token na sessão %s do usuário %s\n", token.Familia.Hex(), token.UserID.Hex())
+            if err := revogarSessoes(ctx, bson.M{"familia": token.Familia}, "reuso"); err != nil {
+                fmt.Printf("Erro ao encerrar a sessão %s: %v\n", token.Familia.Hex(), err)
+            }
+        }
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token inválido ou expirado"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    var user models.User
+    if err := userCollection.FindOne(ctx, bson.M{"_id": token.UserID, "ativo": true}).Decode(&user); err != nil {
+        revogarSessoes(ctx, bson.M{"familia": token.Familia}, "encerrado")
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token inválido ou expirado"})
+        return
+    }
+
+    // Sessões anteriores à exigência de dois fatores não são renovadas
+    if exigeDoisFatores(user) && !doisFatoresAtivo(user) {
+        revogarSessoes(ctx, bson.M{"familia": token.Familia}, "encerrado")
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "O seu perfil exige autenticação em dois fatores, faça login novamente"})
+        return
+    }
+
+    sessao, err := emitirSessao(ctx, user, token.Familia)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
+        return
+    }
+    c.JSON(http.StatusOK, sessao)
+}
+
+// Logout revoga o token de acesso usado na requisição e encerra a sessão do
+// refresh token informado. Com "todas": true encerra todas as sessões do
+// usuário, em todos os dispositivos.
+func Logout(c *gin.Context) {
+    var dados struct {
+        RefreshToken string `json:"refresh_token"`
+        Todas        bool   `json:"todas"`
+    }
+    if c.Request.ContentLength != 0 {
+        if err := c.ShouldBindJSON(&dados); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+            return
+        }
+    }
+
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if v, ok := c.Get("claims"); ok {
+        claims := v.(*auth.Claims)
+        if err := auth.RevogarToken(ctx, claims.Id, claims.UserID, time.Unix(claims.ExpiresAt, 0)); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    switch {
+    case dados.Todas:
+        err = encerrarSessoesUsuario(ctx, userID, "logout")
+    case dados.RefreshToken != "":
+        var token models.RefreshToken
+        filtro := bson.M{"hash": auth.HashOpaqueToken(dados.RefreshToken), "user_id": userID}
+        if refreshTokenCollection.FindOne(ctx, filtro).Decode(&token) == nil {
+            err = revogarSessoes(ctx, bson.M{"familia": token.Familia}, "logout")
+        }
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Sessão encerrada"})
+}
+
+// EncerrarSessoesUsuario revoga todas as sessões e tokens de acesso de um
+// usuário, por exemplo de um funcionário desligado ou de um token roubado
+func EncerrarSessoesUsuario(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if err := encerrarSessoesUsuario(ctx, userID, "encerrado"); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Sessões do usuário encerradas"})
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/cache"
+    "estoque-api/config"
+    "estoque-api/database"
+    "estoque-api/models"
+    "fmt"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Campos pelos quais as séries de tendência podem ser separadas
+var camposAgrupamentoTendencia = map[string]bool{
+    "categoria":  true,
+    "fornecedor": true,
+    "deposito":   true,
+    "status":     true,
+    "classe_abc": true,
+}
+
+var snapshotCollection *mongo.Collection
+
+// InitializeSnapshotHandlers inicializa a collection dos snapshots diários
+func InitializeSnapshotHandlers() {
+    snapshotCollection = database.DB.Collection("snapshots_estoque")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    snapshotCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "data", Value: 1}, {Key: "produto_id", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {Keys: bson.D{{Key: "produto_id", Value: 1}, {Key: "data", Value: 1}}},
+    })
+}
+
+// IniciarSnapshotsDiarios agenda a rotina que grava os snapshots. Na
+// inicialização e depois uma vez por dia (às SNAPSHOT_HORA, padrão 1h) são
+// gerados os snapshots dos dias encerrados que ainda não existem, recuperando
+// no máximo SNAPSHOT_DIAS_RETROATIVOS dias (padrão 7) se o serviço ficou parado.
+func IniciarSnapshotsDiarios() {
+    go func() {
+        for {
+            gerarSnapshotsPendentes()
+            time.Sleep(time.Until(proximaExecucaoSnapshot(time.Now())))
+        }
+    }()
+}
+
+// proximaExecucaoSnapshot calcula o próximo horário da rotina diária
+func proximaExecucaoSnapshot(agora time.Time) time.Time {
+    hora := config.GetInt("SNAPSHOT_HORA", 1)
+    if hora < 0 || hora > 23 {
+        hora = 1
+    }
+
+    proxima := time.Date(agora.Year(), agora.Month(), agora.Day(), hora, 0, 0, 0, time.Local)
+    if !proxima.After(agora) {
+        proxima = proxima.AddDate(0, 0, 1)
+    }
+    return proxima
+}
+
+// inicioDoDia retorna a meia-noite (horário local) do dia de t
+func inicioDoDia(t time.Time) time.Time {
+    t = t.In(time.Local)
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// gerarSnapshotsPendentes grava os snapshots de cada dia encerrado desde o
+// último snapshot existente, limitado aos dias retroativos configurados
+func gerarSnapshotsPendentes() {
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    hoje := inicioDoDia(time.Now())
+    inicio := hoje.AddDate(0, 0, -config.GetInt("SNAPSHOT_DIAS_RETROATIVOS", 7))
+
+    var ultimo models.SnapshotEstoque
+    err := snapshotCollection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"data": -1})).Decode(&ultimo)
+    if err == nil {
+        if seguinte := inicioDoDia(ultimo.Data).AddDate(0, 0, 1); seguinte.After(inicio) {
+            inicio = seguinte
+        }
+    } else if err != mongo.ErrNoDocuments {
+        log.Printf("Erro ao consultar o último snapshot de estoque: %v", err)
+        return
+    }
+
+    gerados := 0
+    for dia := inicio; dia.Before(hoje); dia = dia.AddDate(0, 0, 1) {
+        n, err := gerarSnapshot(ctx, dia)
+        if err != nil {
+            log.Printf("Erro ao gerar o snapshot de estoque de %s: %v", dia.Format("2006-01-02"), err)
+            break
+        }
+        log.Printf("Snapshot de estoque de %s gerado com %d produtos", dia.Format("2006-01-02"), n)
+        gerados++
+    }
+
+    if gerados > 0 {
+        cache.Invalidar()
+    }
+}
+
+// gerarSnapshot grava a posição de todos os produtos ao final do dia. O saldo
+// e o preço vêm do histórico de movimentações, então um dia já encerrado pode
+// ser gerado (ou refeito) a qualquer momento com o mesmo resultado.
+func gerarSnapshot(ctx context.Context, dia time.Time) (int, error) {
+    produtos, err := saldosNaData(ctx, bson.M{}, dia.AddDate(0, 0, 1))
+    if err != nil {
+        return 0, err
+    }
+    if len(produtos) == 0 {
+        return 0, nil
+    }
+
+    agora := time.Now()
+    modelos := make([]mongo.WriteModel, 0, len(produtos))
+    for _, p := range produtos {
+        // Sem _id: o upsert cria um novo ou mantém o do snapshot refeito
+        snapshot := models.SnapshotEstoque{
+            Data:         dia,
+            ProdutoID:    p.ID,
+            CodigoBarras: p.CodigoBarras,
+            Nome:         p.Nome,
+            Categoria:    p.Categoria,
+            Fornecedor:   p.Fornecedor,
+            Deposito:     p.Deposito,
+            Status:       p.Status,
+            ClasseABC:    p.ClasseABC,
+            Tags:         p.Tags,
+            Estoque:      p.Estoque,
+            Preco:        p.Preco,
+            Valor:        valorEstoque(p),
+            DataGeracao:  agora,
+        }
+        modelos = append(modelos, mongo.NewReplaceOneModel().
+            SetFilter(bson.M{"data": dia, "produto_id": p.ID}).
+            SetReplacement(snapshot).
+            SetUpsert(true))
+    }
+
+    if _, err := snapshotCollection.BulkWrite(ctx, modelos, options.BulkWrite().SetOrdered(false)); err != nil {
+        return 0, err
+    }
+    return len(produtos), nil
+}
+
+// GerarSnapshotEstoque refaz manualmente o snapshot de um dia já encerrado
+// (parâmetro data, YYYY-MM-DD; padrão ontem), por exemplo após corrigir
+// movimentações lançadas com atraso
+func GerarSnapshotEstoque(c *gin.Context) {
+    hoje := inicioDoDia(time.Now())
+    dia := hoje.AddDate(0, 0, -1)
+    if v := c.Query("data"); v != "" {
+        var err error
+        dia, err = time.ParseInLocation("2006-01-02", v, time.Local)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Data inválida, use o formato YYYY-MM-DD"})
+            return
+        }
+    }
+    if !dia.Before(hoje) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Só é possível gerar o snapshot de dias já encerrados"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    n, err := gerarSnapshot(ctx, dia)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar snapshot", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":  "Snapshot gerado com sucesso",
+        "data":     dia.Format("2006-01-02"),
+        "produtos": n,
+    })
+}
+
+// pontoTendencia é a posição agregada de estoque em um período da série
+type pontoTendencia struct {
+    Grupo           string  `json:"grupo,omitempty"`
+    Periodo         string  `json:"periodo"`
+    Data            string  `json:"data"`
+    TotalProdutos   int     `json:"total_produtos"`
+    TotalEstoque    float64 `json:"total_estoque"`
+    ValorTotal      float64 `json:"valor_total"`
+    VariacaoEstoque float64 `json:"variacao_estoque"`
+    VariacaoValor   float64 `json:"variacao_valor"`
+}
+
+// periodoTendencia retorna o rótulo do período que contém o dia
+func periodoTendencia(dia time.Time, agrupamento string) string {
+    switch agrupamento {
+    case "semana":
+        ano, semana := dia.ISOWeek()
+        return fmt.Sprintf("%d-W%02d", ano, semana)
+    case "mes":
+        return dia.Format("2006-01")
+    default:
+        return dia.Format("2006-01-02")
+    }
+}
+
+// RelatorioTendenciaEstoque monta a série histórica de estoque e valorização
+// a partir dos snapshots diários. Parâmetros, além dos filtros comuns:
+//   - inicio, fim: período da série (padrão: últimos 90 dias)
+//   - agrupamento: dia (padrão), semana ou mes; cada período usa o saldo do
+//     seu último dia, pois estoque é uma posição e não um fluxo
+//   - agrupar_por: categoria, fornecedor, deposito, status ou classe_abc para
+//     gerar uma série por valor do campo
+func RelatorioTendenciaEstoque(c *gin.Context) {
+    relatorioTendencia(c, filtroProdutos(c), "tendencia_estoque")
+}
+
+// RelatorioTendenciaProduto monta a série histórica de um único produto
+func RelatorioTendenciaProduto(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+    relatorioTendencia(c, bson.M{"produto_id": id}, "tendencia_produto_"+id.Hex())
+}
+
+// relatorioTendencia agrega os snapshots que atendem ao filtro em séries por período
+func relatorioTendencia(c *gin.Context, filtro bson.M, nome string) {
+    inicio, fim, err := periodoRelatorio(c, 90)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    agrupamento := c.DefaultQuery("agrupamento", "dia")
+    if agrupamento != "dia" && agrupamento != "semana" && agrupamento != "mes" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Agrupamento inválido, use dia, semana ou mes"})
+        return
+    }
+
+    agruparPor := c.Query("agrupar_por")
+    if agruparPor != "" && !camposAgrupamentoTendencia[agruparPor] {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "agrupar_por inválido, use categoria, fornecedor, deposito, status ou classe_abc"})
+        return
+    }
+
+    pontos, doCache, err := emCache(c, func(ctx context.Context) ([]pontoTendencia, error) {
+        filtro["data"] = bson.M{"$gte": inicio, "$lt": fim}
+
+        grupo := interface{}(nil)
+        if agruparPor != "" {
+            grupo = "$" + agruparPor
+        }
+
+        cursor, err := snapshotCollection.Aggregate(ctx, []bson.M{
+            {"$match": filtro},
+            {"$group": bson.M{
+                "_id":            bson.M{"data": "$data", "grupo": grupo},
+                "total_produtos": bson.M{"$sum": 1},
+                "total_estoque":  bson.M{"$sum": "$estoque"},
+                "valor_total":    bson.M{"$sum": "$valor"},
+            }},
+            {"$sort": bson.D{{Key: "_id.grupo", Value: 1}, {Key: "_id.data", Value: 1}}},
+        })
+        if err != nil {
+            return nil, err
+        }
+
+        var dias []struct {
+            ID struct {
+                Data  time.Time `bson:"data"`
+                Grupo string    `bson:"grupo"`
+            } `bson:"_id"`
+            TotalProdutos int     `bson:"total_produtos"`
+            TotalEstoque  float64 `bson:"total_estoque"`
+            ValorTotal    float64 `bson:"valor_total"`
+        }
+        if err := cursor.All(ctx, &dias); err != nil {
+            return nil, err
+        }
+
+        // Os dias chegam ordenados por grupo e data; cada dia sobrescreve o
+        // ponto do seu período, que termina com o saldo do último dia
+        pontos := []pontoTendencia{}
+        for _, d := range dias {
+            dia := d.ID.Data.In(time.Local)
+            periodo := periodoTendencia(dia, agrupamento)
+
+            n := len(pontos)
+            if n == 0 || pontos[n-1].Grupo != d.ID.Grupo || pontos[n-1].Periodo != periodo {
+                pontos = append(pontos, pontoTendencia{Grupo: d.ID.Grupo, Periodo: periodo})
+                n++
+            }
+            p := &pontos[n-1]
+            p.Data = dia.Format("2006-01-02")
+            p.TotalProdutos = d.TotalProdutos
+            p.TotalEstoque = d.TotalEstoque
+            p.ValorTotal = d.ValorTotal
+        }
+
+        for i := 1; i < len(pontos); i++ {
+            if pontos[i].Grupo == pontos[i-1].Grupo {
+                pontos[i].VariacaoEstoque = arredondarQuantidade(pontos[i].TotalEstoque - pontos[i-1].TotalEstoque)
+                pontos[i].VariacaoValor = pontos[i].ValorTotal - pontos[i-1].ValorTotal
+            }
+        }
+        return pontos, nil
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    meta := metaRelatorio(c, doCache, gin.H{
+        "periodo":     metaPeriodo(inicio, fim),
+        "agrupamento": agrupamento,
+        "agrupar_por": agruparPor,
+    })
+    if formato := c.DefaultQuery("formato", "json"); formato != "json" {
+        linhas := make([]bson.M, len(pontos))
+        for i, p := range pontos {
+            linhas[i] = bson.M{
+                "grupo": p.Grupo, "periodo": p.Periodo, "data": p.Data,
+                "total_produtos": p.TotalProdutos, "total_estoque": p.TotalEstoque, "valor_total": p.ValorTotal,
+                "variacao_estoque": p.VariacaoEstoque, "variacao_valor": p.VariacaoValor,
+            }
+        }
+        colunas := []colunaRelatorio{
+            {"periodo", "periodo"},
+            {"data", "data"},
+            {"total_produtos", "total_produtos"},
+            {"total_estoque", "total_estoque"},
+            {"valor_total", "valor_total"},
+            {"variacao_estoque", "variacao_estoque"},
+            {"variacao_valor", "variacao_valor"},
+        }
+        if agruparPor != "" {
+            colunas = append([]colunaRelatorio{{agruparPor, "grupo"}}, colunas...)
+        }
+        responderRelatorio(c, nome, colunas, linhas, meta)
+        return
+    }
+
+    meta["total_registros"] = len(pontos)
+    c.JSON(http.StatusOK, gin.H{"dados": pontos, "meta": meta})
+}
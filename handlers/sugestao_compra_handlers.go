@@ -0,0 +1,303 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/models"
+    "estoque-api/previsao"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    // Períodos por ciclo sazonal da série semanal (um ano)
+    semanasPorAno = 52
+    msPorSemana   = 7 * 24 * 60 * 60 * 1000
+)
+
+// sugestaoCompra é a recomendação de reposição de um produto ou, para
+// produtos com variantes, de cada variante
+type sugestaoCompra struct {
+    ID                 string  `json:"id"`
+    VarianteSKU        string  `json:"variante_sku,omitempty"`
+    CodigoBarras       string  `json:"codigo_barras"`
+    Nome               string  `json:"nome"`
+    Fornecedor         string  `json:"fornecedor"`
+    Estoque            float64 `json:"estoque"`
+    EmPedido           float64 `json:"em_pedido"`
+    Unidade            string  `json:"unidade"`
+    PrazoEntregaDias   int     `json:"prazo_entrega_dias"`
+    Metodo             string  `json:"metodo"`
+    DemandaSemanal     float64 `json:"demanda_semanal"`
+    DemandaPeriodo     float64 `json:"demanda_periodo"`
+    EstoqueSeguranca   float64 `json:"estoque_seguranca"`
+    EstoqueAlvo        float64 `json:"estoque_alvo"`
+    QuantidadeSugerida float64 `json:"quantidade_sugerida"`
+    // Sugestão expressa na unidade de compra do produto, arredondada para cima
+    UnidadeCompra    string  `json:"unidade_compra"`
+    QuantidadeCompra float64 `json:"quantidade_compra"`
+}
+
+// seriesSemanais monta, por produto e variante, a série de saídas semanais
+// entre inicio e fim. O índice 0 é a semana mais antiga.
+func seriesSemanais(ctx context.Context, inicio, fim time.Time, semanas int) (map[itemEstoque][]float64, error) {
+    cursor, err := movimentacaoCollection.Aggregate(ctx, []bson.M{
+        {"$match": bson.M{"tipo": "saida", "motivo": bson.M{"$nin": motivosInternos}, "data": bson.M{"$gte": inicio, "$lt": fim}}},
+        {"$group": bson.M{
+            "_id": bson.M{
+                "produto": "$produto_id",
+                "sku":     bson.M{"$ifNull": bson.A{"$variante_sku", ""}},
+                "semana":  bson.M{"$floor": bson.M{"$divide": []interface{}{bson.M{"$subtract": []interface{}{"$data", inicio}}, msPorSemana}}},
+            },
+            "quantidade": bson.M{"$sum": bson.M{"$abs": "$quantidade"}},
+        }},
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    var resultados []struct {
+        ID struct {
+            Produto primitive.ObjectID `bson:"produto"`
+            SKU     string             `bson:"sku"`
+            Semana  float64            `bson:"semana"`
+        } `bson:"_id"`
+        Quantidade float64 `bson:"quantidade"`
+    }
+    if err := cursor.All(ctx, &resultados); err != nil {
+        return nil, err
+    }
+
+    series := map[itemEstoque][]float64{}
+    for _, r := range resultados {
+        semana := int(r.ID.Semana)
+        if semana < 0 || semana >= semanas {
+            continue
+        }
+        item := itemEstoque{r.ID.Produto, r.ID.SKU}
+        serie, ok := series[item]
+        if !ok {
+            serie = make([]float64, semanas)
+            series[item] = serie
+        }
+        serie[semana] += r.Quantidade
+    }
+    return series, nil
+}
+
+// RelatorioSugestaoCompra recomenda quantidades de compra combinando a
+// previsão de demanda, o prazo de entrega do fornecedor e a posição de
+// estoque (saldo atual + pedidos em aberto). Produtos com variantes recebem
+// uma sugestão por variante, como os itens dos pedidos de compra; kits não
+// são sugeridos, pois o estoque deles vem dos componentes. Parâmetros:
+//   - historico_semanas: semanas de histórico usadas na previsão (padrão 104)
+//   - cobertura_dias: dias que o pedido deve cobrir após a entrega (padrão 30)
+//   - fator_seguranca: multiplicador do desvio da demanda (padrão 1.65, ~95%)
+//   - todos: "true" para incluir produtos sem necessidade de compra
+func RelatorioSugestaoCompra(c *gin.Context) {
+    semanas, err := strconv.Atoi(c.DefaultQuery("historico_semanas", "104"))
+    if err != nil || semanas < 4 || semanas > 520 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "historico_semanas deve estar entre 4 e 520"})
+        return
+    }
+    cobertura, err := strconv.Atoi(c.DefaultQuery("cobertura_dias", "30"))
+    if err != nil || cobertura < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "cobertura_dias inválido"})
+        return
+    }
+    fatorSeguranca, err := strconv.ParseFloat(c.DefaultQuery("fator_seguranca", "1.65"), 64)
+    if err != nil || fatorSeguranca < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "fator_seguranca inválido"})
+        return
+    }
+    todos, _ := strconv.ParseBool(c.Query("todos"))
+
+    hoje := time.Now()
+    fim := time.Date(hoje.Year(), hoje.Month(), hoje.Day(), 0, 0, 0, 0, time.Local)
+    inicio := fim.AddDate(0, 0, -7*semanas)
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeoutRelatorio())
+    defer cancel()
+
+    series, err := seriesSemanais(ctx, inicio, fim, semanas)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    emPedido, err := estoqueEmPedido(ctx)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    prazos := map[string]int{}
+    cursor, err := fornecedorCollection.Find(ctx, bson.M{})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var fornecedores []models.Fornecedor
+    if err := cursor.All(ctx, &fornecedores); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    for _, f := range fornecedores {
+        if f.PrazoEntregaDias > 0 {
+            prazos[f.Nome] = f.PrazoEntregaDias
+        }
+    }
+
+    filtro := filtroProdutos(c)
+    if _, ok := filtro["status"]; !ok {
+        filtro["status"] = bson.M{"$ne": "inativo"}
+    }
+    cursor, err = collection.Find(ctx, filtro)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var produtos []models.Produto
+    if err := cursor.All(ctx, &produtos); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    sugestoes := []sugestaoCompra{}
+    sugerir := func(p models.Produto, sku, codigo string, estoque float64) {
+        prazo, ok := prazos[p.Fornecedor]
+        if !ok {
+            prazo = prazoEntregaPadrao()
+        }
+        diasPeriodo := float64(prazo + cobertura)
+        horizonte := int(math.Ceil(diasPeriodo / 7))
+        if horizonte < 1 {
+            horizonte = 1
+        }
+
+        item := itemEstoque{p.ID, sku}
+        serie := series[item]
+        // Semanas anteriores ao cadastro do produto não contam como demanda zero
+        if !p.DataCriacao.IsZero() && p.DataCriacao.After(inicio) && serie != nil {
+            primeira := int(p.DataCriacao.Sub(inicio).Hours() / (24 * 7))
+            if primeira < len(serie) {
+                serie = serie[primeira:]
+            }
+        }
+
+        resultado := previsao.Prever(serie, semanasPorAno, horizonte)
+        demandaDiaria := resultado.Total() / float64(horizonte*7)
+
+        s := sugestaoCompra{
+            ID:               p.ID.Hex(),
+            VarianteSKU:      sku,
+            CodigoBarras:     codigo,
+            Nome:             p.Nome,
+            Fornecedor:       p.Fornecedor,
+            Estoque:          estoque,
+            EmPedido:         emPedido[item],
+            Unidade:          unidadeProduto(p),
+            UnidadeCompra:    unidadeProduto(p),
+            PrazoEntregaDias: prazo,
+            Metodo:           resultado.Metodo,
+            DemandaPeriodo:   demandaDiaria * diasPeriodo,
+            EstoqueSeguranca: previsao.EstoqueSeguranca(fatorSeguranca, resultado.DesvioPadrao, diasPeriodo/7),
+        }
+        if len(resultado.Previsoes) > 0 {
+            s.DemandaSemanal = resultado.Previsoes[0]
+        }
+        s.EstoqueAlvo = s.DemandaPeriodo + s.EstoqueSeguranca
+
+        necessidade := s.EstoqueAlvo - (s.Estoque + s.EmPedido)
+        if necessidade > 0 {
+            if unidadesMedida[s.Unidade] {
+                s.QuantidadeSugerida = arredondarQuantidade(necessidade)
+            } else {
+                s.QuantidadeSugerida = math.Ceil(necessidade)
+            }
+            s.QuantidadeCompra = s.QuantidadeSugerida
+            if fator, err := fatorUnidade(p, p.UnidadeCompra); err == nil && p.UnidadeCompra != "" {
+                s.UnidadeCompra = p.UnidadeCompra
+                s.QuantidadeCompra = math.Ceil(arredondarQuantidade(s.QuantidadeSugerida / fator))
+            }
+        }
+
+        if s.QuantidadeSugerida > 0 || todos {
+            sugestoes = append(sugestoes, s)
+        }
+    }
+
+    for _, p := range produtos {
+        if len(p.Componentes) > 0 {
+            continue
+        }
+        if len(p.Variantes) == 0 {
+            sugerir(p, "", p.CodigoBarras, p.Estoque)
+            continue
+        }
+        for _, v := range p.Variantes {
+            codigo := v.CodigoBarras
+            if codigo == "" {
+                codigo = p.CodigoBarras
+            }
+            sugerir(p, v.SKU, codigo, v.Estoque)
+        }
+    }
+
+    sort.Slice(sugestoes, func(i, j int) bool {
+        if sugestoes[i].Fornecedor != sugestoes[j].Fornecedor {
+            return sugestoes[i].Fornecedor < sugestoes[j].Fornecedor
+        }
+        if sugestoes[i].Nome != sugestoes[j].Nome {
+            return sugestoes[i].Nome < sugestoes[j].Nome
+        }
+        return sugestoes[i].VarianteSKU < sugestoes[j].VarianteSKU
+    })
+
+    meta := metaRelatorio(c, false, gin.H{
+        "historico_semanas": semanas,
+        "cobertura_dias":    cobertura,
+        "fator_seguranca":   fatorSeguranca,
+    })
+    if formato := c.DefaultQuery("formato", "json"); formato != "json" {
+        linhas := make([]bson.M, len(sugestoes))
+        for i, s := range sugestoes {
+            linhas[i] = bson.M{
+                "id": s.ID, "variante_sku": s.VarianteSKU, "codigo_barras": s.CodigoBarras, "nome": s.Nome, "fornecedor": s.Fornecedor,
+                "estoque": s.Estoque, "em_pedido": s.EmPedido, "unidade": s.Unidade, "prazo_entrega_dias": s.PrazoEntregaDias,
+                "metodo": s.Metodo, "demanda_semanal": s.DemandaSemanal, "demanda_periodo": s.DemandaPeriodo,
+                "estoque_seguranca": s.EstoqueSeguranca, "estoque_alvo": s.EstoqueAlvo,
+                "quantidade_sugerida": s.QuantidadeSugerida, "unidade_compra": s.UnidadeCompra,
+                "quantidade_compra": s.QuantidadeCompra,
+            }
+        }
+        responderRelatorio(c, "sugestao_compra", []colunaRelatorio{
+            {"fornecedor", "fornecedor"},
+            {"id", "id"},
+            {"variante_sku", "variante_sku"},
+            {"codigo_barras", "codigo_barras"},
+            {"nome", "nome"},
+            {"estoque", "estoque"},
+            {"em_pedido", "em_pedido"},
+            {"unidade", "unidade"},
+            {"prazo_entrega_dias", "prazo_entrega_dias"},
+            {"metodo", "metodo"},
+            {"demanda_semanal", "demanda_semanal"},
+            {"demanda_periodo", "demanda_periodo"},
+            {"estoque_seguranca", "estoque_seguranca"},
+            {"estoque_alvo", "estoque_alvo"},
+            {"quantidade_sugerida", "quantidade_sugerida"},
+            {"unidade_compra", "unidade_compra"},
+            {"quantidade_compra", "quantidade_compra"},
+        }, linhas, meta)
+        return
+    }
+
+    meta["total_registros"] = len(sugestoes)
+    c.JSON(http.StatusOK, gin.H{"dados": sugestoes, "meta": meta})
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "estoque-api/models"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+)
+
+// Unidades de medida aceitas como unidade do produto, indicando se admitem
+// quantidades fracionadas. Unidades de conversão fora desta lista (como
+// "cx12") são tratadas como inteiras.
+var unidadesMedida = map[string]bool{
+    "un":  false,
+    "par": false,
+    "dz":  false,
+    "cx":  false,
+    "pct": false,
+    "fd":  false,
+    "kg":  true,
+    "g":   true,
+    "l":   true,
+    "ml":  true,
+    "m":   true,
+    "cm":  true,
+    "m2":  true,
+}
+
+const unidadePadrao = "un"
+
+// unidadeProduto retorna a unidade de estoque do produto
+func unidadeProduto(produto models.Produto) string {
+    if produto.Unidade == "" {
+        return unidadePadrao
+    }
+    return produto.Unidade
+}
+
+// arredondarQuantidade limita as quantidades a três casas decimais, evitando
+// resíduos de ponto flutuante nas conversões e somas
+func arredondarQuantidade(v float64) float64 {
+    return math.Round(v*1000) / 1000
+}
+
+// inteira indica se a quantidade não tem parte fracionária
+func inteira(v float64) bool {
+    return v == math.Trunc(v)
+}
+
+// validarUnidades normaliza e confere a unidade do produto, as conversões e
+// as unidades padrão de compra e venda
+func validarUnidades(produto *models.Produto) error {
+    produto.Unidade = strings.ToLower(strings.TrimSpace(produto.Unidade))
+    if produto.Unidade == "" {
+        produto.Unidade = unidadePadrao
+    }
+    fracionavel, ok := unidadesMedida[produto.Unidade]
+    if !ok {
+        validas := make([]string, 0, len(unidadesMedida))
+        for u := range unidadesMedida {
+            validas = append(validas, u)
+        }
+        sort.Strings(validas)
+        return fmt.Errorf("unidade %s desconhecida, use: %s", produto.Unidade, strings.Join(validas, ", "))
+    }
+
+    vistas := map[string]bool{produto.Unidade: true}
+    for i := range produto.Conversoes {
+        conv := &produto.Conversoes[i]
+        conv.Unidade = strings.ToLower(strings.TrimSpace(conv.Unidade))
+        if conv.Unidade == "" || vistas[conv.Unidade] {
+            return fmt.Errorf("conversão %d: unidade vazia ou repetida", i+1)
+        }
+        vistas[conv.Unidade] = true
+        if conv.Fator <= 0 {
+            return fmt.Errorf("conversão %s: fator deve ser positivo", conv.Unidade)
+        }
+        if !fracionavel && !inteira(conv.Fator) {
+            return fmt.Errorf("conversão %s: fator deve ser inteiro para a unidade %s", conv.Unidade, produto.Unidade)
+        }
+    }
+
+    for _, u := range []*string{&produto.UnidadeCompra, &produto.UnidadeVenda} {
+        *u = strings.ToLower(strings.TrimSpace(*u))
+        if *u != "" && !vistas[*u] {
+            return fmt.Errorf("unidade %s não cadastrada nas conversões do produto", *u)
+        }
+    }
+
+    if !fracionavel {
+        if !inteira(produto.Estoque) {
+            return fmt.Errorf("estoque deve ser inteiro para a unidade %s", produto.Unidade)
+        }
+        for _, v := range produto.Variantes {
+            if !inteira(v.Estoque) {
+                return fmt.Errorf("variante %s: estoque deve ser inteiro para a unidade %s", v.SKU, produto.Unidade)
+            }
+        }
+    }
+    return nil
+}
+
+// fatorUnidade retorna quantas unidades do produto há em uma unidade
+// informada. Vazia, a unidade é a do próprio produto.
+func fatorUnidade(produto models.Produto, unidade string) (float64, error) {
+    unidade = strings.ToLower(strings.TrimSpace(unidade))
+    if unidade == "" || unidade == unidadeProduto(produto) {
+        return 1, nil
+    }
+    for _, conv := range produto.Conversoes {
+        if conv.Unidade == unidade {
+            return conv.Fator, nil
+        }
+    }
+    return 0, fmt.Errorf("unidade %s não cadastrada para o produto", unidade)
+}
+
+// converterQuantidade converte uma quantidade informada em unidade para a
+// unidade do produto. Frações só são aceitas em unidades fracionáveis, tanto
+// na quantidade informada quanto no resultado. A quantidade deve ser
+// positiva: o sentido da movimentação vem da operação, não do sinal.
+func converterQuantidade(produto models.Produto, quantidade float64, unidade string) (float64, error) {
+    if quantidade <= 0 {
+        return 0, errors.New("a quantidade deve ser maior que zero")
+    }
+    fator, err := fatorUnidade(produto, unidade)
+    if err != nil {
+        return 0, err
+    }
+
+    unidade = strings.ToLower(strings.TrimSpace(unidade))
+    if unidade == "" {
+        unidade = unidadeProduto(produto)
+    }
+    if !unidadesMedida[unidade] && !inteira(quantidade) {
+        return 0, fmt.Errorf("a unidade %s não aceita quantidades fracionadas", unidade)
+    }
+
+    convertida := arredondarQuantidade(quantidade * fator)
+    if convertida <= 0 {
+        return 0, errors.New("a quantidade convertida é pequena demais para a unidade do produto")
+    }
+    if !unidadesMedida[unidadeProduto(produto)] && !inteira(convertida) {
+        return 0, errors.New("a quantidade convertida deve ser inteira para a unidade do produto")
+    }
+    return convertida, nil
+}
+
+// registrarMovimentacaoConvertida grava a movimentação guardando também a
+// quantidade e a unidade como foram informadas, quando diferentes da
+// unidade do produto
+func registrarMovimentacaoConvertida(ctx context.Context, produto models.Produto, sku string, delta, informada float64, unidade, motivo, usuarioID string) error {
+    if delta == 0 {
+        return nil
+    }
+    movimentacao := novaMovimentacao(produto, sku, delta, motivo, usuarioID)
+    if unidade != "" && unidade != movimentacao.Unidade {
+        movimentacao.QuantidadeInformada = informada
+        movimentacao.UnidadeInformada = unidade
+    }
+    return gravarMovimentacao(ctx, movimentacao)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+    "estoque-api/models"
+    "testing"
+)
+
+func TestConverterQuantidade(t *testing.T) {
+    unidades := models.Produto{Unidade: "un", Conversoes: []models.ConversaoUnidade{{Unidade: "cx", Fator: 12}}}
+    granel := models.Produto{Unidade: "kg", Conversoes: []models.ConversaoUnidade{{Unidade: "g", Fator: 0.001}}}
+
+    casos := []struct {
+        nome       string
+        produto    models.Produto
+        quantidade float64
+        unidade    string
+        esperado   float64
+        erro       bool
+    }{
+        {nome: "unidade do produto", produto: unidades, quantidade: 3, esperado: 3},
+        {nome: "caixas", produto: unidades, quantidade: 2, unidade: "CX", esperado: 24},
+        {nome: "fração de unidade inteira", produto: unidades, quantidade: 1.5, erro: true},
+        {nome: "unidade não cadastrada", produto: unidades, quantidade: 1, unidade: "kg", erro: true},
+        {nome: "fração em unidade fracionável", produto: granel, quantidade: 1.25, esperado: 1.25},
+        {nome: "gramas", produto: granel, quantidade: 250, unidade: "g", esperado: 0.25},
+        {nome: "zero", produto: unidades, quantidade: 0, erro: true},
+        {nome: "negativa", produto: unidades, quantidade: -5, erro: true},
+        {nome: "negativa em outra unidade", produto: granel, quantidade: -250, unidade: "g", erro: true},
+        {nome: "arredondada para zero", produto: granel, quantidade: 0.4, unidade: "g", erro: true},
+    }
+    for _, caso := range casos {
+        t.Run(caso.nome, func(t *testing.T) {
+            n, err := converterQuantidade(caso.produto, caso.quantidade, caso.unidade)
+            if caso.erro {
+                if err == nil {
+                    t.Errorf("= %v, esperado erro", n)
+                }
+                return
+            }
+            if err != nil || n != caso.esperado {
+                t.Errorf("= %v, %v; esperado %v", n, err, caso.esperado)
+            }
+        })
+    }
+}
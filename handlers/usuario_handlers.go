@@ -0,0 +1,445 @@
+package handlers
+
+import (
+    "context"
+    "estoque-api/models"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Perfis de acesso aceitos
+var rolesValidas = map[string]bool{
+    "admin":   true,
+    "manager": true,
+    "user":    true,
+}
+
+// CreateUsuario cria uma conta com o perfil informado. Apenas admins criam
+// contas de funcionários (admin e manager) e contas de serviço, usadas pelas
+// integrações com chaves de API e que dispensam senha.
+func CreateUsuario(c *gin.Context) {
+    var dados struct {
+        Nome         string `json:"nome" binding:"required"`
+        Email        string `json:"email" binding:"required"`
+        Senha        string `json:"senha"`
+        Role         string `json:"role" binding:"required"`
+        ContaServico bool   `json:"conta_servico"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler dados do usuário", "details": err.Error()})
+        return
+    }
+    if !rolesValidas[dados.Role] {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Role inválida, use admin, manager ou user"})
+        return
+    }
+
+    criarUsuario(c, dados.Nome, dados.Email, dados.Senha, dados.Role, dados.ContaServico)
+}
+
+// AlterarRoleUsuario muda o perfil do usuário e encerra as sessões dele, para
+// que os tokens emitidos com o perfil anterior deixem de valer. O último
+// admin ativo não pode ser rebaixado.
+func AlterarRoleUsuario(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    var dados struct {
+        Role string `json:"role" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe a role"})
+        return
+    }
+    if !rolesValidas[dados.Role] {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Role inválida, use admin, manager ou user"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var user models.User
+    if err := userCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if user.Role == dados.Role {
+        c.JSON(http.StatusOK, user)
+        return
+    }
+
+    if user.Role == "admin" {
+        admins, err := userCollection.CountDocuments(ctx, bson.M{"role": "admin", "ativo": true})
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if admins <= 1 {
+            c.JSON(http.StatusConflict, gin.H{"error": "Não é possível rebaixar o último admin"})
+            return
+        }
+    }
+
+    // A role anterior no filtro evita sobrescrever uma alteração simultânea
+    err = userCollection.FindOneAndUpdate(ctx,
+        bson.M{"_id": id, "role": user.Role},
+        bson.M{"$set": bson.M{"role": dados.Role}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusConflict, gin.H{"error": "O usuário foi alterado, tente novamente"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    if err := encerrarSessoesUsuario(ctx, id, "role alterada"); err != nil {
+        fmt.Printf("Erro ao encerrar as sessões do usuário %s: %v\n", id.Hex(), err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Role alterada, mas as sessões não foram encerradas", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// GetUsuarios lista os usuários, ordenados pelo nome, com busca por nome ou
+// email (q), filtros por role e ativo e paginação (pagina, limite)
+func GetUsuarios(c *gin.Context) {
+    filtro := bson.M{}
+    if q := c.Query("q"); q != "" {
+        padrao := regexp.QuoteMeta(q)
+        filtro["$or"] = []bson.M{
+            {"nome": bson.M{"$regex": padrao, "$options": "i"}},
+            {"email": bson.M{"$regex": padrao, "$options": "i"}},
+        }
+    }
+    if role := c.Query("role"); role != "" {
+        filtro["role"] = role
+    }
+    if v := c.Query("ativo"); v != "" {
+        ativo, err := strconv.ParseBool(v)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "ativo deve ser true ou false"})
+            return
+        }
+        filtro["ativo"] = ativo
+    }
+
+    pagina, _ := strconv.Atoi(c.DefaultQuery("pagina", "1"))
+    if pagina < 1 {
+        pagina = 1
+    }
+    limite, _ := strconv.Atoi(c.DefaultQuery("limite", "20"))
+    if limite <= 0 || limite > 100 {
+        limite = 20
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    total, err := userCollection.CountDocuments(ctx, filtro)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    opts := options.Find().
+        SetSort(bson.D{{Key: "nome", Value: 1}, {Key: "_id", Value: 1}}).
+        SetSkip(int64((pagina - 1) * limite)).
+        SetLimit(int64(limite))
+    cursor, err := userCollection.Find(ctx, filtro, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    usuarios := []models.User{}
+    if err := cursor.All(ctx, &usuarios); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "usuarios": usuarios,
+        "total":    total,
+        "pagina":   pagina,
+        "limite":   limite,
+    })
+}
+
+// buscarUsuario carrega o usuário pelo ID, respondendo 404 se não existir
+func buscarUsuario(ctx context.Context, c *gin.Context, id primitive.ObjectID) (models.User, bool) {
+    var user models.User
+    err := userCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+        return user, false
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return user, false
+    }
+    return user, true
+}
+
+func GetUsuario(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if user, ok := buscarUsuario(ctx, c, id); ok {
+        c.JSON(http.StatusOK, user)
+    }
+}
+
+// atualizarDadosUsuario altera nome e email do usuário. Role, senha e
+// situação têm endpoints próprios. Quem altera o próprio email confirma a
+// senha atual, e a troca de email encerra as sessões do usuário.
+func atualizarDadosUsuario(c *gin.Context, id primitive.ObjectID, proprio bool) {
+    var dados struct {
+        Nome       *string `json:"nome"`
+        Email      *string `json:"email"`
+        SenhaAtual string  `json:"senha_atual"`
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler dados do usuário", "details": err.Error()})
+        return
+    }
+
+    set := bson.M{}
+    if dados.Nome != nil {
+        nome := strings.TrimSpace(*dados.Nome)
+        if nome == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Nome não pode ser vazio"})
+            return
+        }
+        set["nome"] = nome
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    atual, ok := buscarUsuario(ctx, c, id)
+    if !ok {
+        return
+    }
+
+    emailAlterado := false
+    if dados.Email != nil {
+        email := strings.TrimSpace(*dados.Email)
+        if email == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Email não pode ser vazio"})
+            return
+        }
+        emailAlterado = email != atual.Email
+    }
+    if emailAlterado {
+        email := strings.TrimSpace(*dados.Email)
+        if proprio {
+            // O email dá acesso à redefinição de senha: sem a senha atual, um
+            // token roubado bastaria para tomar a conta
+            if dados.SenhaAtual == "" {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Informe a senha_atual para alterar o email"})
+                return
+            }
+            if !conferirSenhaAtual(ctx, c, atual, dados.SenhaAtual, "Senha atual incorreta") {
+                return
+            }
+        }
+
+        err := userCollection.FindOne(ctx, bson.M{"email": email, "_id": bson.M{"$ne": id}}).Err()
+        if err == nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Email já cadastrado"})
+            return
+        }
+        if err != mongo.ErrNoDocuments {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        set["email"] = email
+    }
+    if len(set) == 0 {
+        if dados.Nome != nil || dados.Email != nil {
+            c.JSON(http.StatusOK, atual)
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Informe nome ou email"})
+        return
+    }
+
+    var user models.User
+    err := userCollection.FindOneAndUpdate(ctx,
+        bson.M{"_id": id},
+        bson.M{"$set": set},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if !emailAlterado {
+        c.JSON(http.StatusOK, user)
+        return
+    }
+
+    if err := encerrarSessoesUsuario(ctx, id, "email alterado"); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Email alterado, mas houve erro ao encerrar as sessões", "details": err.Error()})
+        return
+    }
+    if !proprio {
+        c.JSON(http.StatusOK, user)
+        return
+    }
+
+    // As sessões anteriores, inclusive a atual, foram encerradas: quem
+    // alterou o próprio email recebe uma sessão nova
+    sessao, err := emitirSessao(ctx, user, primitive.NewObjectID())
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Email alterado, mas houve erro ao gerar o token"})
+        return
+    }
+    sessao["user"] = user
+    c.JSON(http.StatusOK, sessao)
+}
+
+func UpdateUsuario(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+    atualizarDadosUsuario(c, id, false)
+}
+
+// DesativarUsuario bloqueia o acesso do usuário e encerra as sessões dele. O
+// usuário continua cadastrado, preservando o histórico de movimentações.
+func DesativarUsuario(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+    if id.Hex() == c.GetString("userID") {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Não é possível desativar o próprio usuário"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    user, ok := buscarUsuario(ctx, c, id)
+    if !ok {
+        return
+    }
+    if !user.Ativo {
+        c.JSON(http.StatusOK, user)
+        return
+    }
+    if user.Role == "admin" {
+        admins, err := userCollection.CountDocuments(ctx, bson.M{"role": "admin", "ativo": true})
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if admins <= 1 {
+            c.JSON(http.StatusConflict, gin.H{"error": "Não é possível desativar o último admin"})
+            return
+        }
+    }
+
+    agora := time.Now()
+    err = userCollection.FindOneAndUpdate(ctx,
+        bson.M{"_id": id},
+        bson.M{"$set": bson.M{"ativo": false, "data_desativacao": agora}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&user)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    if err := encerrarSessoesUsuario(ctx, id, "desativado"); err != nil {
+        fmt.Printf("Erro ao encerrar as sessões do usuário %s: %v\n", id.Hex(), err)
+    }
+    c.JSON(http.StatusOK, user)
+}
+
+func ReativarUsuario(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var user models.User
+    err = userCollection.FindOneAndUpdate(ctx,
+        bson.M{"_id": id},
+        bson.M{"$set": bson.M{"ativo": true}, "$unset": bson.M{"data_desativacao": ""}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, user)
+}
+
+// GetMe retorna o perfil do usuário autenticado
+func GetMe(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if user, ok := buscarUsuario(ctx, c, id); ok {
+        c.JSON(http.StatusOK, user)
+    }
+}
+
+// UpdateMe altera o nome e o email do próprio usuário
+func UpdateMe(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+        return
+    }
+    atualizarDadosUsuario(c, id, true)
+}
@@ -0,0 +1,478 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "estoque-api/models"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errVarianteNaoEncontrada = errors.New("variante não encontrada")
+
+// criarIndicesVariantes garante SKU e código de barras únicos entre todas as
+// variantes e permite localizá-las sem percorrer os produtos. Dentro de um
+// mesmo produto a unicidade é conferida por validarVariantes.
+func criarIndicesVariantes(ctx context.Context) {
+    _, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {
+            Keys: bson.M{"variantes.sku": 1},
+            Options: options.Index().SetUnique(true).
+                SetPartialFilterExpression(bson.M{"variantes.sku": bson.M{"$exists": true}}),
+        },
+        {
+            Keys: bson.M{"variantes.codigo_barras": 1},
+            Options: options.Index().SetUnique(true).
+                SetPartialFilterExpression(bson.M{"variantes.codigo_barras": bson.M{"$exists": true}}),
+        },
+    })
+    if err != nil {
+        // Sem os índices as variantes repetidas não são recusadas; em geral
+        // há dados duplicados a corrigir antes de reiniciar
+        fmt.Printf("Erro ao criar os índices de variantes (SKU e código de barras podem se repetir): %v\n", err)
+    }
+}
+
+// varianteProduto retorna a variante do produto com o SKU, ou nil
+func varianteProduto(produto models.Produto, sku string) *models.Variante {
+    if sku == "" {
+        return nil
+    }
+    for i := range produto.Variantes {
+        if produto.Variantes[i].SKU == sku {
+            return &produto.Variantes[i]
+        }
+    }
+    return nil
+}
+
+// valorEstoque é o valor do estoque do produto. Com variantes, cada uma é
+// valorizada pelo próprio preço ou, sem ele, pelo preço do produto.
+func valorEstoque(produto models.Produto) float64 {
+    if len(produto.Variantes) == 0 {
+        return produto.Preco * produto.Estoque
+    }
+    valor := 0.0
+    for _, v := range produto.Variantes {
+        preco := produto.Preco
+        if v.Preco != nil {
+            preco = *v.Preco
+        }
+        valor += preco * v.Estoque
+    }
+    return valor
+}
+
+// valorEstoqueExpr é o valorEstoque em expressão de agregação do MongoDB
+var valorEstoqueExpr = bson.M{"$cond": bson.A{
+    bson.M{"$gt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$variantes", bson.A{}}}}, 0}},
+    bson.M{"$reduce": bson.M{
+        "input":        "$variantes",
+        "initialValue": 0,
+        "in": bson.M{"$add": bson.A{"$$value", bson.M{"$multiply": bson.A{
+            bson.M{"$ifNull": bson.A{"$$this.preco", "$preco"}},
+            "$$this.estoque",
+        }}}},
+    }},
+    bson.M{"$multiply": bson.A{"$preco", "$estoque"}},
+}}
+
+// chaveAtributos representa a combinação de atributos de uma variante
+func chaveAtributos(atributos []string, valores map[string]string) string {
+    partes := make([]string, len(atributos))
+    for i, a := range atributos {
+        partes[i] = a + "=" + strings.ToLower(valores[a])
+    }
+    return strings.Join(partes, ";")
+}
+
+// validarVariantes confere as variantes do produto: SKU e código de barras
+// únicos, todos os atributos de variação preenchidos (e nenhum outro) e
+// combinações distintas. Sem atributos_variacao, eles são definidos pelos
+// atributos da primeira variante. O estoque do produto passa a ser a soma
+// do estoque das variantes.
+func validarVariantes(produto *models.Produto) error {
+    if len(produto.Variantes) == 0 {
+        return nil
+    }
+
+    if len(produto.AtributosVariacao) == 0 {
+        for a := range produto.Variantes[0].Atributos {
+            produto.AtributosVariacao = append(produto.AtributosVariacao, a)
+        }
+        sort.Strings(produto.AtributosVariacao)
+    }
+    if len(produto.AtributosVariacao) == 0 {
+        return errors.New("informe os atributos de variação (ex.: tamanho, cor)")
+    }
+
+    skus := map[string]bool{}
+    codigos := map[string]bool{}
+    combinacoes := map[string]bool{}
+    total := 0.0
+    for i := range produto.Variantes {
+        v := &produto.Variantes[i]
+        v.SKU = strings.TrimSpace(v.SKU)
+        if v.SKU == "" {
+            return fmt.Errorf("variante %d: sku é obrigatório", i+1)
+        }
+        if skus[v.SKU] {
+            return fmt.Errorf("sku %s repetido", v.SKU)
+        }
+        skus[v.SKU] = true
+
+        if v.CodigoBarras != "" {
+            if codigos[v.CodigoBarras] {
+                return fmt.Errorf("código de barras %s repetido", v.CodigoBarras)
+            }
+            codigos[v.CodigoBarras] = true
+        }
+
+        if len(v.Atributos) != len(produto.AtributosVariacao) {
+            return fmt.Errorf("variante %s: informe exatamente os atributos %s", v.SKU, strings.Join(produto.AtributosVariacao, ", "))
+        }
+        for _, a := range produto.AtributosVariacao {
+            if strings.TrimSpace(v.Atributos[a]) == "" {
+                return fmt.Errorf("variante %s: atributo %s é obrigatório", v.SKU, a)
+            }
+        }
+        chave := chaveAtributos(produto.AtributosVariacao, v.Atributos)
+        if combinacoes[chave] {
+            return fmt.Errorf("variante %s: já existe uma variante com os mesmos atributos", v.SKU)
+        }
+        combinacoes[chave] = true
+
+        if v.Estoque < 0 {
+            return fmt.Errorf("variante %s: estoque inválido", v.SKU)
+        }
+        if v.Preco != nil && *v.Preco < 0 {
+            return fmt.Errorf("variante %s: preço inválido", v.SKU)
+        }
+        total += v.Estoque
+    }
+
+    produto.Estoque = arredondarQuantidade(total)
+    return nil
+}
+
+// movimentarVariante aplica delta ao estoque da variante e, na mesma
+// operação, ao estoque total do produto. Retorna o produto atualizado.
+func movimentarVariante(ctx context.Context, produtoID primitive.ObjectID, sku string, delta float64) (models.Produto, error) {
+    var produto models.Produto
+    update := bson.M{
+        "$inc": bson.M{"estoque": delta, "variantes.$.estoque": delta},
+        "$set": bson.M{"ultima_atualizacao": time.Now()},
+    }
+    opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+    err := collection.FindOneAndUpdate(ctx, bson.M{"_id": produtoID, "variantes.sku": sku}, update, opts).Decode(&produto)
+    if err == mongo.ErrNoDocuments {
+        return produto, errVarianteNaoEncontrada
+    }
+    return produto, err
+}
+
+// buscarProdutoRota carrega o produto do parâmetro :id da rota
+func buscarProdutoRota(ctx context.Context, c *gin.Context) (models.Produto, bool) {
+    var produto models.Produto
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return produto, false
+    }
+    if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&produto); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Produto não encontrado"})
+        return produto, false
+    }
+    return produto, true
+}
+
+// GetVariantes lista as variantes de um produto
+func GetVariantes(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+
+    variantes := produto.Variantes
+    if variantes == nil {
+        variantes = []models.Variante{}
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "atributos_variacao": produto.AtributosVariacao,
+        "variantes":          variantes,
+        "estoque_total":      produto.Estoque,
+    })
+}
+
+// GetProdutoPorCodigo localiza um produto pelo código de barras do produto ou
+// pelo SKU ou código de barras de uma de suas variantes. Quando o código é de
+// uma variante, ela é retornada junto com o produto.
+func GetProdutoPorCodigo(c *gin.Context) {
+    codigo := c.Param("codigo")
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var produto models.Produto
+    filtro := bson.M{"$or": []bson.M{
+        {"codigo_barras": codigo},
+        {"variantes.sku": codigo},
+        {"variantes.codigo_barras": codigo},
+    }}
+    if err := collection.FindOne(ctx, filtro).Decode(&produto); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Produto não encontrado"})
+        return
+    }
+
+    lista := []models.Produto{produto}
+    prepararProdutos(ctx, lista)
+    produto = lista[0]
+
+    resposta := gin.H{"produto": produto}
+    for _, v := range produto.Variantes {
+        if v.SKU == codigo || v.CodigoBarras == codigo {
+            resposta["variante"] = v
+            break
+        }
+    }
+    c.JSON(http.StatusOK, resposta)
+}
+
+// AdicionarVariante inclui uma variante no produto. O estoque inicial da
+// variante é somado ao do produto e registrado no histórico.
+func AdicionarVariante(c *gin.Context) {
+    var variante models.Variante
+    if err := c.ShouldBindJSON(&variante); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+    // O estoque do produto passa a ser a soma das variantes, então o saldo
+    // anterior sem variante precisa ser zerado (ou movido) antes
+    if len(produto.Variantes) == 0 && produto.Estoque != 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Zere o estoque do produto antes de cadastrar a primeira variante"})
+        return
+    }
+    if len(produto.Componentes) > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Um kit não pode ter variantes"})
+        return
+    }
+    // Kits que usam o produto sem variante deixariam de saber qual baixar
+    if len(produto.Variantes) == 0 {
+        if n, _ := collection.CountDocuments(ctx, bson.M{"componentes": bson.M{"$elemMatch": bson.M{"produto_id": produto.ID, "variante_sku": bson.M{"$exists": false}}}}); n > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "O produto é componente de kits; ajuste a composição dos kits antes"})
+            return
+        }
+    }
+
+    anterior := produto.Estoque
+    produto.Variantes = append(produto.Variantes, variante)
+    if err := validarVariantes(&produto); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if !unidadesMedida[unidadeProduto(produto)] && !inteira(variante.Estoque) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "O estoque deve ser inteiro para a unidade " + unidadeProduto(produto)})
+        return
+    }
+    variante = produto.Variantes[len(produto.Variantes)-1]
+
+    // O filtro pelo estoque anterior evita perder movimentações concorrentes
+    update := bson.M{
+        "$push": bson.M{"variantes": variante},
+        "$set": bson.M{
+            "atributos_variacao": produto.AtributosVariacao,
+            "ultima_atualizacao": time.Now(),
+        },
+        "$inc": bson.M{"estoque": variante.Estoque},
+    }
+    result, err := collection.UpdateOne(ctx, bson.M{"_id": produto.ID, "estoque": anterior}, update)
+    if err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "SKU ou código de barras já utilizado por outro produto"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if result.ModifiedCount == 0 {
+        c.JSON(http.StatusConflict, gin.H{"error": "O produto foi alterado, tente novamente"})
+        return
+    }
+
+    registrarMovimentacaoVariante(ctx, produto, variante.SKU, variante.Estoque, "cadastro", usuarioAtual(c))
+
+    c.JSON(http.StatusCreated, variante)
+}
+
+// UpdateVariante altera código de barras, atributos e preço de uma variante.
+// O estoque só muda pelas movimentações.
+func UpdateVariante(c *gin.Context) {
+    var dados models.Variante
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    produto, ok := buscarProdutoRota(ctx, c)
+    if !ok {
+        return
+    }
+    sku := c.Param("sku")
+    v := varianteProduto(produto, sku)
+    if v == nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Variante não encontrada"})
+        return
+    }
+
+    v.CodigoBarras = dados.CodigoBarras
+    v.Atributos = dados.Atributos
+    v.Preco = dados.Preco
+    if err := validarVariantes(&produto); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    set := bson.M{
+        "variantes.$.codigo_barras": v.CodigoBarras,
+        "variantes.$.atributos":     v.Atributos,
+        "ultima_atualizacao":        time.Now(),
+    }
+    update := bson.M{"$set": set}
+    if v.Preco != nil {
+        set["variantes.$.preco"] = v.Preco
+    } else {
+        update["$unset"] = bson.M{"variantes.$.preco": ""}
+    }
+
+    if _, err := collection.UpdateOne(ctx, bson.M{"_id": produto.ID, "variantes.sku": sku}, update); err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Código de barras já utilizado por outro produto"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Variante atualizada com sucesso"})
+}
+
+// DeleteVariante remove uma variante sem estoque
+func DeleteVariante(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+    sku := c.Param("sku")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if recusarComponenteEmUso(ctx, c, id, sku) {
+        return
+    }
+
+    filtro := bson.M{"_id": id, "variantes": bson.M{"$elemMatch": bson.M{"sku": sku, "estoque": 0}}}
+    update := bson.M{
+        "$pull": bson.M{"variantes": bson.M{"sku": sku}},
+        "$set":  bson.M{"ultima_atualizacao": time.Now()},
+    }
+    result, err := collection.UpdateOne(ctx, filtro, update)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Variante não encontrada ou com estoque"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Variante removida com sucesso"})
+}
+
+// AtualizarEstoqueVariante movimenta o estoque de uma variante, com o mesmo
+// corpo de AtualizarEstoque
+func AtualizarEstoqueVariante(c *gin.Context) {
+    id, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+        return
+    }
+    sku := c.Param("sku")
+
+    var dados struct {
+        Quantidade float64 `json:"quantidade"`
+        Unidade    string  `json:"unidade"`  // padrão: unidade do produto
+        Operacao   string  `json:"operacao"` // "adicionar" ou "remover"
+        Motivo     string  `json:"motivo"`   // compra, venda, devolucao, ajuste, perda
+    }
+    if err := c.ShouldBindJSON(&dados); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if dados.Motivo == "" {
+        dados.Motivo = "ajuste"
+    }
+    if !motivosMovimentacao[dados.Motivo] {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Motivo inválido"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var produto models.Produto
+    if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&produto); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Produto não encontrado"})
+        return
+    }
+    delta, err := converterQuantidade(produto, dados.Quantidade, dados.Unidade)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if dados.Operacao != "adicionar" {
+        delta = -delta
+    }
+
+    produto, err = movimentarVariante(ctx, id, sku, delta)
+    if err == errVarianteNaoEncontrada {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Variante não encontrada"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    registrarMovimentacaoConvertida(ctx, produto, sku, delta, dados.Quantidade, dados.Unidade, dados.Motivo, usuarioAtual(c))
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":       "Estoque atualizado",
+        "modificados":   1,
+        "estoque":       varianteProduto(produto, sku).Estoque,
+        "estoque_total": produto.Estoque,
+    })
+}
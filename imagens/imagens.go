@@ -0,0 +1,122 @@
+// Package imagens identifica, valida e redimensiona as imagens enviadas para
+// os produtos usando apenas a biblioteca padrão
+package imagens
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "image"
+    "image/draw"
+    _ "image/gif" // registra o decodificador de GIF usado por image.Decode
+    "image/jpeg"
+    "image/png"
+    "net/http"
+)
+
+// Formatos aceitos, pelo tipo detectado no conteúdo, com a extensão usada
+// ao gravar o arquivo
+var extensoes = map[string]string{
+    "image/jpeg": ".jpg",
+    "image/png":  ".png",
+    "image/gif":  ".gif",
+}
+
+// ErrFormatoNaoSuportado indica um arquivo que não é JPEG, PNG nem GIF
+var ErrFormatoNaoSuportado = errors.New("formato de imagem não suportado, use JPEG, PNG ou GIF")
+
+// Imagem é uma imagem decodificada com o tipo detectado pelo conteúdo
+type Imagem struct {
+    Tipo     string
+    Extensao string
+    Largura  int
+    Altura   int
+    img      image.Image
+}
+
+// Decodificar identifica o formato pelos primeiros bytes (e não pela
+// extensão informada pelo cliente), confere as dimensões antes de
+// decodificar, evitando alocar imagens gigantes, e decodifica a imagem
+func Decodificar(dados []byte, dimensaoMaxima int) (*Imagem, error) {
+    tipo := http.DetectContentType(dados)
+    extensao, ok := extensoes[tipo]
+    if !ok {
+        return nil, ErrFormatoNaoSuportado
+    }
+
+    config, _, err := image.DecodeConfig(bytes.NewReader(dados))
+    if err != nil {
+        return nil, fmt.Errorf("imagem inválida: %v", err)
+    }
+    if config.Width <= 0 || config.Height <= 0 {
+        return nil, errors.New("imagem inválida: dimensões vazias")
+    }
+    if config.Width > dimensaoMaxima || config.Height > dimensaoMaxima {
+        return nil, fmt.Errorf("imagem de %dx%d excede o limite de %d pixels por lado", config.Width, config.Height, dimensaoMaxima)
+    }
+
+    img, _, err := image.Decode(bytes.NewReader(dados))
+    if err != nil {
+        return nil, fmt.Errorf("imagem inválida: %v", err)
+    }
+    return &Imagem{Tipo: tipo, Extensao: extensao, Largura: config.Width, Altura: config.Height, img: img}, nil
+}
+
+// Miniatura reduz a imagem para caber em um quadrado de lado pixels,
+// mantendo a proporção. Imagens menores não são ampliadas. O resultado é
+// JPEG para fotos e PNG para os formatos com transparência.
+func (i *Imagem) Miniatura(lado int) (dados []byte, extensao string, err error) {
+    largura, altura := i.Largura, i.Altura
+    if largura > lado || altura > lado {
+        if largura >= altura {
+            largura, altura = lado, max(1, altura*lado/largura)
+        } else {
+            largura, altura = max(1, largura*lado/altura), lado
+        }
+    }
+    reduzida := reduzir(i.img, largura, altura)
+
+    var buf bytes.Buffer
+    if i.Tipo == "image/jpeg" {
+        err = jpeg.Encode(&buf, reduzida, &jpeg.Options{Quality: 85})
+        return buf.Bytes(), ".jpg", err
+    }
+    err = png.Encode(&buf, reduzida)
+    return buf.Bytes(), ".png", err
+}
+
+// reduzir redimensiona pela média das áreas: cada pixel do destino é a média
+// dos pixels de origem que ele cobre, o que evita o serrilhado das reduções
+// grandes sem depender de bibliotecas externas
+func reduzir(origem image.Image, largura, altura int) *image.RGBA {
+    limites := origem.Bounds()
+    src := image.NewRGBA(image.Rect(0, 0, limites.Dx(), limites.Dy()))
+    draw.Draw(src, src.Bounds(), origem, limites.Min, draw.Src)
+
+    dst := image.NewRGBA(image.Rect(0, 0, largura, altura))
+    larguraOrigem, alturaOrigem := src.Bounds().Dx(), src.Bounds().Dy()
+    for y := 0; y < altura; y++ {
+        y0 := y * alturaOrigem / altura
+        y1 := max(y0+1, (y+1)*alturaOrigem/altura)
+        for x := 0; x < largura; x++ {
+            x0 := x * larguraOrigem / largura
+            x1 := max(x0+1, (x+1)*larguraOrigem/largura)
+
+            var r, g, b, a, n int
+            for sy := y0; sy < y1; sy++ {
+                linha := src.Pix[sy*src.Stride:]
+                for sx := x0; sx < x1; sx++ {
+                    p := linha[sx*4 : sx*4+4]
+                    r += int(p[0])
+                    g += int(p[1])
+                    b += int(p[2])
+                    a += int(p[3])
+                    n++
+                }
+            }
+            p := dst.Pix[y*dst.Stride+x*4:]
+            p[0], p[1], p[2], p[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+        }
+    }
+    return dst
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+    "estoque-api/config"
     "estoque-api/database"
     "estoque-api/handlers"
     "estoque-api/middleware"
+    "log"
+    "strings"
     "github.com/gin-gonic/gin"
 )
 
@@ -11,17 +14,90 @@ func main() {
     database.Connect()
     handlers.InitializeHandlers()
     handlers.InitializeAuthHandlers()
+    handlers.InitializeImportacaoHandlers()
+    handlers.InitializeMovimentacaoHandlers()
+    handlers.InitializeComprasHandlers()
+    handlers.InitializeSnapshotHandlers()
+    handlers.InitializeCategoriaHandlers()
+    handlers.InitializeImagemHandlers()
+    handlers.IniciarSnapshotsDiarios()
 
     r := gin.Default()
 
+    // O IP do cliente (limite de tentativas de login, último uso das chaves
+    // de API) só é lido do X-Forwarded-For quando a requisição vem de um
+    // proxy listado em PROXIES_CONFIAVEIS. Por padrão nenhum é confiável.
+    if err := r.SetTrustedProxies(proxiesConfiaveis()); err != nil {
+        log.Fatal("PROXIES_CONFIAVEIS inválido: ", err)
+    }
+
     // Rotas públicas
     r.POST("/register", handlers.Register)
     r.POST("/login", handlers.Login)
+    r.POST("/refresh", handlers.Refresh)
+
+    // Segunda etapa do login com autenticação em dois fatores
+    r.POST("/login/2fa", handlers.LoginDoisFatores)
+    r.POST("/login/2fa/cadastro", handlers.CadastroLoginDoisFatores)
+
+    // Política e redefinição de senha
+    r.GET("/senha/politica", handlers.GetPoliticaSenha)
+    r.POST("/senha/esqueci", handlers.EsqueciSenha)
+    r.POST("/senha/redefinir", handlers.RedefinirSenha)
+
+    // Arquivos enviados (imagens dos produtos e miniaturas)
+    r.GET("/uploads/*arquivo", handlers.ServirUpload)
 
     // Grupo de rotas autenticadas
     authenticated := r.Group("")
-    authenticated.Use(middleware.AuthRequired())
+    authenticated.Use(middleware.AuthRequired(), middleware.InvalidarCache())
     {
+        // Fluxo de eventos em tempo real (Server-Sent Events)
+        authenticated.GET("/eventos", handlers.GetEventos)
+
+        // Encerra a sessão atual (ou todas, com "todas": true)
+        authenticated.POST("/logout", handlers.Logout)
+
+        // Perfil do próprio usuário
+        authenticated.GET("/me", handlers.GetMe)
+        authenticated.PATCH("/me", handlers.UpdateMe)
+        authenticated.POST("/me/senha", handlers.AlterarSenha)
+
+        // Autenticação em dois fatores (TOTP) do próprio usuário
+        authenticated.GET("/me/2fa", handlers.GetDoisFatoresMe)
+        authenticated.POST("/me/2fa/iniciar", handlers.IniciarDoisFatores)
+        authenticated.POST("/me/2fa/ativar", handlers.AtivarDoisFatores)
+        authenticated.POST("/me/2fa/desativar", handlers.DesativarDoisFatores)
+        authenticated.POST("/me/2fa/codigos-recuperacao", handlers.RegerarCodigosRecuperacao)
+
+        // Chaves de API do próprio usuário, para scripts e integrações
+        authenticated.GET("/me/chaves-api", handlers.GetMinhasChavesAPI)
+        authenticated.POST("/me/chaves-api", handlers.CreateMinhaChaveAPI)
+        authenticated.DELETE("/me/chaves-api/:chave", handlers.RevogarMinhaChaveAPI)
+        authenticated.GET("/chaves-api/escopos", handlers.GetEscoposChaveAPI)
+
+        // Administração de usuários (apenas admin)
+        usuarios := authenticated.Group("/usuarios")
+        usuarios.Use(middleware.AdminRequired())
+        {
+            usuarios.GET("", handlers.GetUsuarios)
+            usuarios.GET("/:id", handlers.GetUsuario)
+            usuarios.POST("", handlers.CreateUsuario)
+            usuarios.PUT("/:id", handlers.UpdateUsuario)
+            usuarios.POST("/:id/desativar", handlers.DesativarUsuario)
+            usuarios.POST("/:id/reativar", handlers.ReativarUsuario)
+            usuarios.PATCH("/:id/role", handlers.AlterarRoleUsuario)
+            usuarios.DELETE("/:id/sessoes", handlers.EncerrarSessoesUsuario)
+            usuarios.POST("/:id/desbloquear", handlers.DesbloquearUsuario)
+            usuarios.DELETE("/:id/2fa", handlers.RedefinirDoisFatoresUsuario)
+            usuarios.GET("/:id/chaves-api", handlers.GetChavesAPIUsuario)
+            usuarios.POST("/:id/chaves-api", handlers.CreateChaveAPIUsuario)
+            usuarios.DELETE("/:id/chaves-api/:chave", handlers.RevogarChaveAPIUsuario)
+        }
+
+        // Bloqueios de login e demais eventos de segurança (apenas admin)
+        authenticated.GET("/seguranca/eventos", middleware.AdminRequired(), handlers.GetEventosSeguranca)
+
         // Rotas de Produtos
         produtos := authenticated.Group("/produtos")
         {
@@ -33,10 +109,68 @@ func main() {
             
             produtos.GET("/categoria/:categoria", handlers.GetProdutosPorCategoria)
             produtos.GET("/busca", handlers.BuscarProdutos)
+            produtos.GET("/exportar", handlers.ExportarProdutos)
             produtos.PATCH("/:id/estoque", middleware.ManagerRequired(), handlers.AtualizarEstoque)
+            produtos.GET("/:id/movimentacoes", handlers.GetMovimentacoesProduto)
             produtos.PATCH("/:id/preco", middleware.ManagerRequired(), handlers.AtualizarPreco)
             produtos.GET("/baixo-estoque", handlers.GetProdutosBaixoEstoque)
             produtos.POST("/:id/imagem", middleware.ManagerRequired(), handlers.UploadImagemProduto)
+
+            // Galeria de imagens com miniaturas
+            produtos.GET("/:id/imagens", handlers.GetImagensProduto)
+            produtos.POST("/:id/imagens", middleware.ManagerRequired(), handlers.AdicionarImagensProduto)
+            produtos.PUT("/:id/imagens/ordem", middleware.ManagerRequired(), handlers.OrdenarImagensProduto)
+            produtos.PATCH("/:id/imagens/:imagem/principal", middleware.ManagerRequired(), handlers.DefinirImagemPrincipal)
+            produtos.DELETE("/:id/imagens/:imagem", middleware.ManagerRequired(), handlers.RemoverImagemProduto)
+            produtos.POST("/imagens/limpar-orfas", middleware.AdminRequired(), handlers.LimparImagensOrfas)
+
+            // Variantes (tamanho, cor...) com SKU e estoque próprios
+            produtos.GET("/codigo/:codigo", handlers.GetProdutoPorCodigo)
+            produtos.GET("/:id/variantes", handlers.GetVariantes)
+            produtos.POST("/:id/variantes", middleware.ManagerRequired(), handlers.AdicionarVariante)
+            produtos.PUT("/:id/variantes/:sku", middleware.ManagerRequired(), handlers.UpdateVariante)
+            produtos.DELETE("/:id/variantes/:sku", middleware.ManagerRequired(), handlers.DeleteVariante)
+            produtos.PATCH("/:id/variantes/:sku/estoque", middleware.ManagerRequired(), handlers.AtualizarEstoqueVariante)
+
+            // Kits: estoque derivado dos componentes, montagem e desmontagem
+            produtos.GET("/:id/kit", handlers.GetKit)
+            produtos.PUT("/:id/kit", middleware.ManagerRequired(), handlers.DefinirComponentesKit)
+            produtos.POST("/:id/kit/montar", middleware.ManagerRequired(), handlers.MontarKit)
+            produtos.POST("/:id/kit/desmontar", middleware.ManagerRequired(), handlers.DesmontarKit)
+
+            // Importação em lote (CSV/XLSX)
+            produtos.POST("/importar", middleware.ManagerRequired(), handlers.ImportarProdutos)
+            produtos.GET("/importacoes/:id", middleware.ManagerRequired(), handlers.GetImportacao)
+        }
+
+        // Rotas de Categorias
+        categorias := authenticated.Group("/categorias")
+        {
+            categorias.GET("", handlers.GetCategorias)
+            categorias.GET("/:id", handlers.GetCategoria)
+            categorias.GET("/:id/atributos", handlers.GetAtributosCategoria)
+            categorias.POST("", middleware.ManagerRequired(), handlers.CreateCategoria)
+            categorias.PUT("/:id", middleware.ManagerRequired(), handlers.UpdateCategoria)
+            categorias.DELETE("/:id", middleware.ManagerRequired(), handlers.DeleteCategoria)
+            categorias.POST("/migrar", middleware.AdminRequired(), handlers.MigrarCategorias)
+        }
+
+        // Rotas de Compras (apenas admin e manager)
+        fornecedores := authenticated.Group("/fornecedores")
+        fornecedores.Use(middleware.ManagerRequired())
+        {
+            fornecedores.GET("", handlers.GetFornecedores)
+            fornecedores.POST("", handlers.CreateFornecedor)
+            fornecedores.PUT("/:id", handlers.UpdateFornecedor)
+        }
+
+        pedidosCompra := authenticated.Group("/pedidos-compra")
+        pedidosCompra.Use(middleware.ManagerRequired())
+        {
+            pedidosCompra.GET("", handlers.GetPedidosCompra)
+            pedidosCompra.POST("", handlers.CreatePedidoCompra)
+            pedidosCompra.POST("/:id/receber", handlers.ReceberPedidoCompra)
+            pedidosCompra.POST("/:id/cancelar", handlers.CancelarPedidoCompra)
         }
 
         // Rotas de Relatórios (apenas admin e manager)
@@ -46,8 +180,29 @@ func main() {
             relatorios.GET("/estoque", handlers.RelatorioEstoque)
             relatorios.GET("/produtos-mais-vendidos", handlers.RelatorioProdutosMaisVendidos)
             relatorios.GET("/valor-total-estoque", handlers.RelatorioValorTotalEstoque)
+            relatorios.GET("/curva-abc", handlers.RelatorioCurvaABC)
+            relatorios.POST("/curva-abc/salvar", handlers.SalvarCurvaABC)
+            relatorios.GET("/giro-estoque", handlers.RelatorioGiroEstoque)
+            relatorios.GET("/estoque-parado", handlers.RelatorioEstoqueParado)
+            relatorios.GET("/sugestao-compra", handlers.RelatorioSugestaoCompra)
+
+            // Tendências a partir dos snapshots diários de estoque
+            relatorios.GET("/tendencia-estoque", handlers.RelatorioTendenciaEstoque)
+            relatorios.GET("/tendencia-estoque/:id", handlers.RelatorioTendenciaProduto)
+            relatorios.POST("/snapshots", middleware.AdminRequired(), handlers.GerarSnapshotEstoque)
         }
     }
 
     r.Run(":8080")
 }
+
+// proxiesConfiaveis lê os IPs ou redes (CIDR) separados por vírgula
+func proxiesConfiaveis() []string {
+    var proxies []string
+    for _, p := range strings.Split(config.Get("PROXIES_CONFIAVEIS", ""), ",") {
+        if p = strings.TrimSpace(p); p != "" {
+            proxies = append(proxies, p)
+        }
+    }
+    return proxies
+}
@@ -1,14 +1,43 @@
 package middleware
 
 import (
+    "context"
     "estoque-api/auth"
+    "estoque-api/database"
     "strings"
     "net/http"
+    "time"
     "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// usuarioAtivo informa se o usuário do token existe e não foi desativado
+func usuarioAtivo(ctx context.Context, userID string) (bool, error) {
+    id, err := primitive.ObjectIDFromHex(userID)
+    if err != nil {
+        return false, nil
+    }
+    err = database.DB.Collection("users").FindOne(ctx,
+        bson.M{"_id": id, "ativo": true},
+        options.FindOne().SetProjection(bson.M{"_id": 1}),
+    ).Err()
+    if err == mongo.ErrNoDocuments {
+        return false, nil
+    }
+    return err == nil, err
+}
+
 func AuthRequired() gin.HandlerFunc {
     return func(c *gin.Context) {
+        // Integrações se autenticam com chaves de API em vez do JWT
+        if chave := chaveAPIRequisicao(c); chave != "" {
+            autenticarChaveAPI(c, chave)
+            return
+        }
+
         authHeader := c.GetHeader("Authorization")
         if authHeader == "" {
             c.JSON(http.StatusUnauthorized, gin.H{"error": "Token não fornecido"})
@@ -24,8 +53,34 @@ func AuthRequired() gin.HandlerFunc {
             return
         }
 
+        // Tokens revogados (logout, sessões encerradas) são recusados
+        // mesmo antes de expirar
+        ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+        revogado, err := auth.TokenRevogado(ctx, claims.Id)
+        ativo := false
+        if err == nil && !revogado {
+            ativo, err = usuarioAtivo(ctx, claims.UserID)
+        }
+        cancel()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao validar token"})
+            c.Abort()
+            return
+        }
+        if revogado {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revogado"})
+            c.Abort()
+            return
+        }
+        if !ativo {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário inativo"})
+            c.Abort()
+            return
+        }
+
         c.Set("userID", claims.UserID)
         c.Set("role", claims.Role)
+        c.Set("claims", claims)
         c.Next()
     }
 }
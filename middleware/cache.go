@@ -0,0 +1,20 @@
+package middleware
+
+import (
+    "estoque-api/cache"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+)
+
+// InvalidarCache descarta os resultados de relatórios em cache depois de
+// qualquer escrita bem-sucedida (métodos diferentes de GET)
+func InvalidarCache() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Next()
+
+        if c.Request.Method != http.MethodGet && c.Writer.Status() < http.StatusBadRequest {
+            cache.Invalidar()
+        }
+    }
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+    "context"
+    "estoque-api/auth"
+    "estoque-api/database"
+    "estoque-api/models"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Intervalo mínimo entre as gravações do último uso de uma chave, para não
+// gerar uma escrita a cada requisição das integrações
+const intervaloUltimoUso = time.Minute
+
+// escopoRota é a permissão exigida de uma chave de API para um método e rota
+type escopoRota struct {
+    Metodo string
+    Rota   string
+    Escopo string
+}
+
+// Rotas de escrita liberadas para chaves de API. As demais escritas são
+// recusadas para chaves, mesmo que o dono tenha permissão.
+var escoposEscrita = []escopoRota{
+    {http.MethodPatch, "/produtos/:id/estoque", "estoque:escrever"},
+    {http.MethodPatch, "/produtos/:id/variantes/:sku/estoque", "estoque:escrever"},
+    {http.MethodPost, "/produtos/:id/kit/montar", "estoque:escrever"},
+    {http.MethodPost, "/produtos/:id/kit/desmontar", "estoque:escrever"},
+}
+
+// Prefixos de rota liberados para leitura (GET) por escopo
+var escoposLeitura = []escopoRota{
+    {http.MethodGet, "/produtos", "produtos:ler"},
+    {http.MethodGet, "/categorias", "produtos:ler"},
+    {http.MethodGet, "/relatorios", "relatorios:ler"},
+}
+
+// escopoExigido retorna o escopo necessário para a rota, ou vazio se a rota
+// não pode ser usada com chaves de API
+func escopoExigido(metodo, rota string) string {
+    for _, e := range escoposEscrita {
+        if e.Metodo == metodo && e.Rota == rota {
+            return e.Escopo
+        }
+    }
+    for _, e := range escoposLeitura {
+        if e.Metodo == metodo && (rota == e.Rota || strings.HasPrefix(rota, e.Rota+"/")) {
+            return e.Escopo
+        }
+    }
+    return ""
+}
+
+// chaveAPIRequisicao lê a chave do cabeçalho X-API-Key ou do Authorization,
+// aceito como "ApiKey <chave>" ou "Bearer <chave>"
+func chaveAPIRequisicao(c *gin.Context) string {
+    if chave := strings.TrimSpace(c.GetHeader("X-API-Key")); chave != "" {
+        return chave
+    }
+    valor := strings.TrimSpace(c.GetHeader("Authorization"))
+    for _, esquema := range []string{"ApiKey ", "Bearer "} {
+        if len(valor) > len(esquema) && strings.EqualFold(valor[:len(esquema)], esquema) {
+            if chave := strings.TrimSpace(valor[len(esquema):]); auth.PareceChaveAPI(chave) {
+                return chave
+            }
+        }
+    }
+    return ""
+}
+
+// autenticarChaveAPI valida a chave, confere o escopo da rota e preenche o
+// contexto como o login faria, com o perfil atual do dono da chave
+func autenticarChaveAPI(c *gin.Context, valor string) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    agora := time.Now()
+    chaves := database.DB.Collection("chaves_api")
+    var chave models.ChaveAPI
+    err := chaves.FindOne(ctx, bson.M{
+        "hash":           auth.HashOpaqueToken(valor),
+        "data_revogacao": bson.M{"$exists": false},
+        "$or": bson.A{
+            bson.M{"expira_em": nil},
+            bson.M{"expira_em": bson.M{"$gt": agora}},
+        },
+    }).Decode(&chave)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Chave de API inválida, revogada ou expirada"})
+        c.Abort()
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao validar chave de API"})
+        c.Abort()
+        return
+    }
+
+    var user models.User
+    err = database.DB.Collection("users").FindOne(ctx,
+        bson.M{"_id": chave.UserID, "ativo": true},
+        options.FindOne().SetProjection(bson.M{"role": 1}),
+    ).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário inativo"})
+        c.Abort()
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao validar chave de API"})
+        c.Abort()
+        return
+    }
+
+    escopo := escopoExigido(c.Request.Method, c.FullPath())
+    if escopo == "" {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Rota não disponível para chaves de API"})
+        c.Abort()
+        return
+    }
+    permitido := false
+    for _, e := range chave.Escopos {
+        if e == escopo {
+            permitido = true
+            break
+        }
+    }
+    if !permitido {
+        c.JSON(http.StatusForbidden, gin.H{"error": "A chave de API não tem o escopo necessário", "details": escopo})
+        c.Abort()
+        return
+    }
+
+    // Falhas ao registrar o uso não impedem a requisição
+    _, err = chaves.UpdateOne(ctx,
+        bson.M{"_id": chave.ID, "$or": bson.A{
+            bson.M{"ultimo_uso": nil},
+            bson.M{"ultimo_uso": bson.M{"$lt": agora.Add(-intervaloUltimoUso)}},
+        }},
+        bson.M{"$set": bson.M{"ultimo_uso": agora, "ultimo_ip": c.ClientIP()}},
+    )
+    if err != nil {
+        fmt.Printf("Erro ao registrar o uso da chave de API %s: %v\n", chave.Prefixo, err)
+    }
+
+    c.Set("userID", chave.UserID.Hex())
+    c.Set("role", user.Role)
+    c.Set("chaveAPI", chave.ID.Hex())
+    c.Set("escopos", chave.Escopos)
+    c.Next()
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Categoria organiza os produtos em uma hierarquia. Caminho guarda os IDs dos
+// ancestrais, da raiz até o pai, para que as subcategorias de qualquer nível
+// sejam encontradas com uma única consulta ({"caminho": id}).
+type Categoria struct {
+    ID                primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+    Nome              string               `bson:"nome" json:"nome" binding:"required"`
+    Slug              string               `bson:"slug" json:"slug"`
+    Descricao         string               `bson:"descricao,omitempty" json:"descricao,omitempty"`
+    PaiID             *primitive.ObjectID  `bson:"pai_id,omitempty" json:"pai_id,omitempty"`
+    Caminho           []primitive.ObjectID `bson:"caminho" json:"caminho"`
+    Atributos         []AtributoCategoria  `bson:"atributos,omitempty" json:"atributos,omitempty"`
+    DataCriacao       time.Time            `bson:"data_criacao" json:"data_criacao"`
+    UltimaAtualizacao time.Time            `bson:"ultima_atualizacao" json:"ultima_atualizacao"`
+}
+
+// AtributoCategoria define uma especificação que os produtos da categoria
+// (e de suas subcategorias) podem ou devem informar
+type AtributoCategoria struct {
+    Chave       string   `bson:"chave" json:"chave"` // ex.: voltagem, teor_alcoolico
+    Nome        string   `bson:"nome" json:"nome"`
+    Tipo        string   `bson:"tipo" json:"tipo"` // texto, numero, inteiro, booleano, opcao ou data
+    Obrigatorio bool     `bson:"obrigatorio" json:"obrigatorio"`
+    Opcoes      []string `bson:"opcoes,omitempty" json:"opcoes,omitempty"`   // valores aceitos no tipo opcao
+    Unidade     string   `bson:"unidade,omitempty" json:"unidade,omitempty"` // apenas exibição, ex.: V, %
+    Minimo      *float64 `bson:"minimo,omitempty" json:"minimo,omitempty"`
+    Maximo      *float64 `bson:"maximo,omitempty" json:"maximo,omitempty"`
+}
+
+// NoCategoria é uma categoria com suas subcategorias, usada na listagem em árvore
+type NoCategoria struct {
+    Categoria
+    Subcategorias []*NoCategoria `json:"subcategorias"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fornecedor guarda os dados de reposição de um fornecedor. Os produtos o
+// referenciam pelo nome, no campo Produto.Fornecedor.
+type Fornecedor struct {
+    ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Nome             string             `bson:"nome" json:"nome" binding:"required"`
+    PrazoEntregaDias int                `bson:"prazo_entrega_dias" json:"prazo_entrega_dias"`
+    Contato          string             `bson:"contato,omitempty" json:"contato,omitempty"`
+    Email            string             `bson:"email,omitempty" json:"email,omitempty"`
+    DataCriacao      time.Time          `bson:"data_criacao" json:"data_criacao"`
+}
+
+// PedidoCompra é um pedido feito a um fornecedor. As quantidades ainda não
+// recebidas contam como estoque em pedido na sugestão de compra.
+type PedidoCompra struct {
+    ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Fornecedor      string             `bson:"fornecedor" json:"fornecedor"`
+    Status          string             `bson:"status" json:"status"` // aberto, parcial, recebido, cancelado
+    Itens           []ItemPedidoCompra `bson:"itens" json:"itens"`
+    DataCriacao     time.Time          `bson:"data_criacao" json:"data_criacao"`
+    DataPrevista    time.Time          `bson:"data_prevista,omitempty" json:"data_prevista,omitempty"`
+    DataRecebimento time.Time          `bson:"data_recebimento,omitempty" json:"data_recebimento,omitempty"`
+    UsuarioID       string             `bson:"usuario_id" json:"usuario_id"`
+}
+
+// ItemPedidoCompra é a quantidade pedida de um produto. O fator de conversão
+// é guardado no item para que mudanças no cadastro não afetem pedidos abertos.
+type ItemPedidoCompra struct {
+    ProdutoID          primitive.ObjectID `bson:"produto_id" json:"produto_id"`
+    VarianteSKU        string             `bson:"variante_sku,omitempty" json:"variante_sku,omitempty"` // obrigatório para produtos com variantes
+    Quantidade         float64            `bson:"quantidade" json:"quantidade"` // na unidade do item
+    QuantidadeRecebida float64            `bson:"quantidade_recebida" json:"quantidade_recebida"`
+    Unidade            string             `bson:"unidade,omitempty" json:"unidade,omitempty"` // padrão: unidade de compra do produto
+    Fator              float64            `bson:"fator,omitempty" json:"fator,omitempty"`     // unidades do produto por unidade do item, fixado na criação
+    PrecoUnitario      float64            `bson:"preco_unitario,omitempty" json:"preco_unitario,omitempty"`
+}
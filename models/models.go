@@ -9,13 +9,98 @@ type Produto struct {
     Descricao       string            `bson:"descricao" json:"descricao"`
     Preco           float64           `bson:"preco" json:"preco"`
     PrecoPromocional float64          `bson:"preco_promocional,omitempty" json:"preco_promocional,omitempty"`
-    Estoque         int               `bson:"estoque" json:"estoque"`
+    Estoque         float64           `bson:"estoque" json:"estoque"` // na unidade do produto
+    Unidade         string            `bson:"unidade,omitempty" json:"unidade,omitempty"` // un (padrão), kg, l, m...
+    Conversoes      []ConversaoUnidade `bson:"conversoes,omitempty" json:"conversoes,omitempty"`
+    UnidadeCompra   string            `bson:"unidade_compra,omitempty" json:"unidade_compra,omitempty"` // padrão dos pedidos de compra
+    UnidadeVenda    string            `bson:"unidade_venda,omitempty" json:"unidade_venda,omitempty"`
     Categoria       string            `bson:"categoria" json:"categoria"`
+    CategoriaID     *primitive.ObjectID `bson:"categoria_id,omitempty" json:"categoria_id,omitempty"` // nome da categoria fica em Categoria
     Fornecedor      string            `bson:"fornecedor" json:"fornecedor"`
+    Deposito        string            `bson:"deposito,omitempty" json:"deposito,omitempty"`
     CodigoBarras    string            `bson:"codigo_barras" json:"codigo_barras"`
     DataCriacao     time.Time         `bson:"data_criacao" json:"data_criacao"`
     UltimaAtualizacao time.Time       `bson:"ultima_atualizacao" json:"ultima_atualizacao"`
     Status          string            `bson:"status" json:"status"` // ativo, inativo, em_promocao
-    ImagemURL       string            `bson:"imagem_url,omitempty" json:"imagem_url,omitempty"`
+    ImagemURL       string            `bson:"imagem_url,omitempty" json:"imagem_url,omitempty"` // URL da imagem principal
+    Imagens         []ImagemProduto   `bson:"imagens,omitempty" json:"imagens,omitempty"` // galeria, na ordem de exibição
     Tags            []string          `bson:"tags,omitempty" json:"tags,omitempty"`
+    ClasseABC       string            `bson:"classe_abc,omitempty" json:"classe_abc,omitempty"` // A, B ou C, calculada pela curva ABC
+    // Valores dos atributos definidos pela categoria (ex.: voltagem, teor_alcoolico)
+    Especificacoes  map[string]interface{} `bson:"especificacoes,omitempty" json:"especificacoes,omitempty"`
+    // Produtos com variantes têm em Estoque a soma do estoque das variantes
+    AtributosVariacao []string        `bson:"atributos_variacao,omitempty" json:"atributos_variacao,omitempty"` // ex.: tamanho, cor
+    Variantes       []Variante        `bson:"variantes,omitempty" json:"variantes,omitempty"`
+    // Kits têm componentes; Estoque guarda apenas os kits já montados
+    Componentes     []ComponenteKit   `bson:"componentes,omitempty" json:"componentes,omitempty"`
+    EstoqueDisponivel *float64        `bson:"-" json:"estoque_disponivel,omitempty"` // kits: montados + montáveis com os componentes
+    // Preenchida só na cópia guardada em produtos_excluidos
+    DataExclusao    *time.Time        `bson:"data_exclusao,omitempty" json:"-"`
+}
+
+// ImagemProduto é uma imagem da galeria do produto. Os arquivos são
+// guardados pela chave relativa ao diretório de uploads; as URLs são
+// montadas na resposta.
+type ImagemProduto struct {
+    ID             string            `bson:"id" json:"id"`
+    Arquivo        string            `bson:"arquivo" json:"-"`
+    Miniaturas     map[string]string `bson:"miniaturas,omitempty" json:"-"` // tamanho -> arquivo
+    URL            string            `bson:"-" json:"url"`
+    URLsMiniaturas map[string]string `bson:"-" json:"miniaturas,omitempty"`
+    Principal      bool              `bson:"principal" json:"principal"`
+    TipoConteudo   string            `bson:"tipo_conteudo" json:"tipo_conteudo"`
+    Tamanho        int64             `bson:"tamanho" json:"tamanho"`
+    Largura        int               `bson:"largura" json:"largura"`
+    Altura         int               `bson:"altura" json:"altura"`
+    DataEnvio      time.Time         `bson:"data_envio" json:"data_envio"`
+}
+
+// ConversaoUnidade define uma unidade alternativa de compra ou venda pela
+// quantidade equivalente na unidade do produto (por exemplo cx = 12 un)
+type ConversaoUnidade struct {
+    Unidade string  `bson:"unidade" json:"unidade"`
+    Fator   float64 `bson:"fator" json:"fator"`
+}
+
+// ComponenteKit é a quantidade de um produto (ou de uma variante) em cada kit
+type ComponenteKit struct {
+    ProdutoID   primitive.ObjectID `bson:"produto_id" json:"produto_id"`
+    VarianteSKU string             `bson:"variante_sku,omitempty" json:"variante_sku,omitempty"`
+    Quantidade  float64            `bson:"quantidade" json:"quantidade"` // na unidade do componente
+}
+
+// Variante é uma combinação de atributos (por exemplo tamanho M, cor azul)
+// vendida com SKU, código de barras e estoque próprios. Sem Preco, vale o
+// preço do produto.
+type Variante struct {
+    SKU          string            `bson:"sku" json:"sku" binding:"required"`
+    CodigoBarras string            `bson:"codigo_barras,omitempty" json:"codigo_barras,omitempty"`
+    Atributos    map[string]string `bson:"atributos" json:"atributos"`
+    Preco        *float64          `bson:"preco,omitempty" json:"preco,omitempty"`
+    Estoque      float64           `bson:"estoque" json:"estoque"`
+}
+
+// Importacao registra um job assíncrono de importação de produtos
+type Importacao struct {
+    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Arquivo       string            `bson:"arquivo" json:"arquivo"`
+    Formato       string            `bson:"formato" json:"formato"` // csv, xlsx
+    DryRun        bool              `bson:"dry_run" json:"dry_run"`
+    Status        string            `bson:"status" json:"status"` // pendente, processando, concluida, falhou
+    TotalLinhas   int               `bson:"total_linhas" json:"total_linhas"`
+    Processadas   int               `bson:"processadas" json:"processadas"`
+    Criados       int               `bson:"criados" json:"criados"`
+    Atualizados   int               `bson:"atualizados" json:"atualizados"`
+    Falhas        int               `bson:"falhas" json:"falhas"`
+    Erros         []ErroImportacao  `bson:"erros" json:"erros"`
+    UsuarioID     string            `bson:"usuario_id" json:"usuario_id"`
+    DataCriacao   time.Time         `bson:"data_criacao" json:"data_criacao"`
+    DataConclusao time.Time         `bson:"data_conclusao,omitempty" json:"data_conclusao,omitempty"`
+}
+
+// ErroImportacao descreve o motivo da falha de uma linha do arquivo importado
+type ErroImportacao struct {
+    Linha    int    `bson:"linha" json:"linha"`
+    Campo    string `bson:"campo,omitempty" json:"campo,omitempty"`
+    Mensagem string `bson:"mensagem" json:"mensagem"`
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MovimentacaoEstoque registra cada alteração no estoque de um produto.
+// Quantidade é positiva para entradas e negativa para saídas.
+type MovimentacaoEstoque struct {
+    ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    ProdutoID   primitive.ObjectID  `bson:"produto_id" json:"produto_id"`
+    VarianteSKU string              `bson:"variante_sku,omitempty" json:"variante_sku,omitempty"`
+    KitID       *primitive.ObjectID `bson:"kit_id,omitempty" json:"kit_id,omitempty"` // kit vendido, montado ou desmontado
+    Tipo        string              `bson:"tipo" json:"tipo"`                         // entrada, saida
+    Motivo      string              `bson:"motivo" json:"motivo"`                     // cadastro, compra, venda, devolucao, ajuste, perda, importacao, montagem, desmontagem
+    Quantidade  float64             `bson:"quantidade" json:"quantidade"`             // na unidade do produto
+    Unidade     string              `bson:"unidade,omitempty" json:"unidade,omitempty"`
+    // Quantidade e unidade como informadas, quando houve conversão (ex.: 2 cx)
+    QuantidadeInformada float64   `bson:"quantidade_informada,omitempty" json:"quantidade_informada,omitempty"`
+    UnidadeInformada    string    `bson:"unidade_informada,omitempty" json:"unidade_informada,omitempty"`
+    SaldoAnterior       float64   `bson:"saldo_anterior" json:"saldo_anterior"`
+    SaldoPosterior      float64   `bson:"saldo_posterior" json:"saldo_posterior"`
+    PrecoUnitario       float64   `bson:"preco_unitario" json:"preco_unitario"`
+    Categoria           string    `bson:"categoria" json:"categoria"`
+    UsuarioID           string    `bson:"usuario_id" json:"usuario_id"`
+    Data                time.Time `bson:"data" json:"data"`
+}
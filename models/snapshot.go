@@ -0,0 +1,29 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SnapshotEstoque é a posição de um produto ao final de um dia, gravada pela
+// rotina diária de snapshots. Os campos de classificação são copiados do
+// produto para que os relatórios de tendência aceitem os mesmos filtros da
+// listagem sem consultar a collection de produtos.
+type SnapshotEstoque struct {
+    ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Data         time.Time          `bson:"data" json:"data"` // início do dia a que o saldo se refere
+    ProdutoID    primitive.ObjectID `bson:"produto_id" json:"produto_id"`
+    CodigoBarras string             `bson:"codigo_barras" json:"codigo_barras"`
+    Nome         string             `bson:"nome" json:"nome"`
+    Categoria    string             `bson:"categoria" json:"categoria"`
+    Fornecedor   string             `bson:"fornecedor" json:"fornecedor"`
+    Deposito     string             `bson:"deposito,omitempty" json:"deposito,omitempty"`
+    Status       string             `bson:"status" json:"status"`
+    ClasseABC    string             `bson:"classe_abc,omitempty" json:"classe_abc,omitempty"`
+    Tags         []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+    Estoque      float64            `bson:"estoque" json:"estoque"`
+    Preco        float64            `bson:"preco" json:"preco"`
+    Valor        float64            `bson:"valor" json:"valor"`
+    DataGeracao  time.Time          `bson:"data_geracao" json:"data_geracao"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken é um token de renovação da sessão, guardado apenas pelo hash.
+// Cada uso o revoga e gera outro na mesma família; o reuso de um token já
+// trocado indica roubo e encerra a família inteira. O jti do token de acesso
+// emitido junto é guardado para que ele também possa ser revogado.
+type RefreshToken struct {
+    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Hash          string             `bson:"hash" json:"-"`
+    Familia       primitive.ObjectID `bson:"familia" json:"familia"` // sessão iniciada por um login
+    AcessoJTI     string             `bson:"acesso_jti" json:"-"`
+    AcessoExpira  time.Time          `bson:"acesso_expira" json:"-"`
+    DataCriacao   time.Time          `bson:"data_criacao" json:"data_criacao"`
+    ExpiraEm      time.Time          `bson:"expira_em" json:"expira_em"`
+    DataRevogacao *time.Time         `bson:"data_revogacao,omitempty" json:"data_revogacao,omitempty"`
+    Motivo        string             `bson:"motivo,omitempty" json:"motivo,omitempty"` // renovado, logout, reuso, encerrado, role alterada, desativado, senha alterada, email alterado, 2fa redefinida
+}
+
+// RedefinicaoSenha é um pedido de redefinição de senha. O token enviado por
+// email é guardado apenas pelo hash e vale uma única vez até ExpiraEm.
+type RedefinicaoSenha struct {
+    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Hash        string             `bson:"hash" json:"-"`
+    DataCriacao time.Time          `bson:"data_criacao" json:"data_criacao"`
+    ExpiraEm    time.Time          `bson:"expira_em" json:"expira_em"`
+    DataUso     *time.Time         `bson:"data_uso,omitempty" json:"data_uso,omitempty"`
+}
+
+// DesafioLogin é a etapa intermediária do login de quem usa (ou precisa
+// cadastrar) a autenticação em dois fatores: a senha já foi conferida e o
+// token do desafio, guardado apenas pelo hash, é trocado pelos tokens da
+// sessão junto com o código do autenticador.
+type DesafioLogin struct {
+    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Hash        string             `bson:"hash" json:"-"`
+    Tipo        string             `bson:"tipo" json:"tipo"` // totp ou cadastro
+    Tentativas  int                `bson:"tentativas" json:"tentativas"`
+    DataCriacao time.Time          `bson:"data_criacao" json:"data_criacao"`
+    ExpiraEm    time.Time          `bson:"expira_em" json:"expira_em"`
+}
+
+// ChaveAPI é uma chave de acesso de longa duração para integrações, ligada a
+// um usuário (pessoal ou conta de serviço) e limitada aos escopos. A chave é
+// mostrada uma única vez na criação e guardada apenas pelo hash.
+type ChaveAPI struct {
+    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Nome          string             `bson:"nome" json:"nome"`
+    Prefixo       string             `bson:"prefixo" json:"prefixo"` // identifica a chave sem revelá-la
+    Hash          string             `bson:"hash" json:"-"`
+    Escopos       []string           `bson:"escopos" json:"escopos"`
+    DataCriacao   time.Time          `bson:"data_criacao" json:"data_criacao"`
+    CriadaPor     string             `bson:"criada_por" json:"criada_por"`
+    ExpiraEm      *time.Time         `bson:"expira_em,omitempty" json:"expira_em,omitempty"`
+    UltimoUso     *time.Time         `bson:"ultimo_uso,omitempty" json:"ultimo_uso,omitempty"`
+    UltimoIP      string             `bson:"ultimo_ip,omitempty" json:"ultimo_ip,omitempty"`
+    DataRevogacao *time.Time         `bson:"data_revogacao,omitempty" json:"data_revogacao,omitempty"`
+}
@@ -14,4 +14,38 @@ type User struct {
 	DataCriacao    time.Time         `bson:"data_criacao" json:"data_criacao"`
 	UltimoAcesso   time.Time         `bson:"ultimo_acesso" json:"ultimo_acesso"`
 	Ativo          bool              `bson:"ativo" json:"ativo"`
-} 
\ No newline at end of file
+	DataDesativacao *time.Time       `bson:"data_desativacao,omitempty" json:"data_desativacao,omitempty"`
+	DoisFatores    *DoisFatores      `bson:"dois_fatores,omitempty" json:"dois_fatores,omitempty"`
+	ContaServico   bool              `bson:"conta_servico,omitempty" json:"conta_servico,omitempty"` // integração, acessa apenas por chave de API
+}
+
+// DoisFatores é a configuração da autenticação em dois fatores (TOTP) do
+// usuário. Apenas a situação é exposta no JSON.
+type DoisFatores struct {
+	Ativo              bool       `bson:"ativo" json:"ativo"`
+	Segredo            string     `bson:"segredo,omitempty" json:"-"`
+	SegredoPendente    string     `bson:"segredo_pendente,omitempty" json:"-"` // cadastro ainda não confirmado
+	CodigosRecuperacao []string   `bson:"codigos_recuperacao,omitempty" json:"-"` // hashes dos códigos não usados
+	UltimoPasso        int64      `bson:"ultimo_passo,omitempty" json:"-"` // impede reutilizar o último código
+	DataAtivacao       *time.Time `bson:"data_ativacao,omitempty" json:"data_ativacao,omitempty"`
+} 
+// TentativasLogin conta as falhas de login recentes de uma conta ou de um IP
+type TentativasLogin struct {
+	Chave        string     `bson:"_id" json:"chave"` // conta:<email> ou ip:<endereço>
+	Falhas       int        `bson:"falhas" json:"falhas"`
+	UltimaFalha  time.Time  `bson:"ultima_falha" json:"ultima_falha"`
+	BloqueadoAte *time.Time `bson:"bloqueado_ate,omitempty" json:"bloqueado_ate,omitempty"`
+	ExpiraEm     time.Time  `bson:"expira_em" json:"-"`
+}
+
+// EventoSeguranca registra bloqueios de login e desbloqueios feitos por admins
+type EventoSeguranca struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Tipo         string             `bson:"tipo" json:"tipo"` // bloqueio_conta, bloqueio_ip, desbloqueio_conta
+	Email        string             `bson:"email,omitempty" json:"email,omitempty"`
+	IP           string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	Falhas       int                `bson:"falhas,omitempty" json:"falhas,omitempty"`
+	BloqueadoAte *time.Time         `bson:"bloqueado_ate,omitempty" json:"bloqueado_ate,omitempty"`
+	Responsavel  string             `bson:"responsavel,omitempty" json:"responsavel,omitempty"` // admin que desbloqueou
+	Data         time.Time          `bson:"data" json:"data"`
+}
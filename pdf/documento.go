@@ -0,0 +1,132 @@
+// Package pdf implementa um gerador de PDF mínimo, sem dependências externas,
+// suficiente para relatórios tabulares com as fontes padrão Helvetica.
+package pdf
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "strings"
+
+    "golang.org/x/text/encoding/charmap"
+)
+
+// Dimensões de uma página A4 em pontos
+const (
+    LarguraA4 = 595.28
+    AlturaA4  = 841.89
+)
+
+// Documento acumula as páginas e gera o arquivo PDF final
+type Documento struct {
+    paginas []*bytes.Buffer
+    atual   *bytes.Buffer
+}
+
+// Novo cria um documento vazio; a primeira página é criada com NovaPagina
+func Novo() *Documento {
+    return &Documento{}
+}
+
+// NovaPagina inicia uma nova página A4 retrato
+func (d *Documento) NovaPagina() {
+    d.atual = &bytes.Buffer{}
+    d.paginas = append(d.paginas, d.atual)
+}
+
+// TotalPaginas retorna a quantidade de páginas criadas até o momento
+func (d *Documento) TotalPaginas() int {
+    return len(d.paginas)
+}
+
+// Pagina seleciona uma página já criada (iniciando em 1) para escrita,
+// útil para adicionar rodapés com o total de páginas ao final
+func (d *Documento) Pagina(n int) {
+    d.atual = d.paginas[n-1]
+}
+
+// Texto escreve s na posição (x, y), medida a partir do canto superior esquerdo
+func (d *Documento) Texto(x, y, tamanho float64, negrito bool, s string) {
+    fonte := "F1"
+    if negrito {
+        fonte = "F2"
+    }
+    fmt.Fprintf(d.atual, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+        fonte, tamanho, x, AlturaA4-y, escapar(s))
+}
+
+// TextoDireita escreve s alinhado à direita terminando em x
+func (d *Documento) TextoDireita(x, y, tamanho float64, negrito bool, s string) {
+    d.Texto(x-LarguraTexto(s, tamanho, negrito), y, tamanho, negrito, s)
+}
+
+// Linha desenha uma linha entre dois pontos
+func (d *Documento) Linha(x1, y1, x2, y2, espessura float64) {
+    fmt.Fprintf(d.atual, "%.2f w %.2f %.2f m %.2f %.2f l S\n",
+        espessura, x1, AlturaA4-y1, x2, AlturaA4-y2)
+}
+
+// Retangulo preenche um retângulo com um tom de cinza (0 = preto, 1 = branco)
+func (d *Documento) Retangulo(x, y, largura, altura, cinza float64) {
+    fmt.Fprintf(d.atual, "q %.2f g %.2f %.2f %.2f %.2f re f Q\n",
+        cinza, x, AlturaA4-y-altura, largura, altura)
+}
+
+// WriteTo gera o arquivo PDF completo
+func (d *Documento) WriteTo(w io.Writer) (int64, error) {
+    var out bytes.Buffer
+    var offsets []int
+
+    objeto := func(conteudo string) {
+        offsets = append(offsets, out.Len())
+        fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), conteudo)
+    }
+
+    out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+    // Objetos fixos: 1 catálogo, 2 árvore de páginas, 3 e 4 fontes
+    kids := make([]string, len(d.paginas))
+    for i := range d.paginas {
+        kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+    }
+    objeto("<< /Type /Catalog /Pages 2 0 R >>")
+    objeto(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.paginas)))
+    objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+    objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+    for i, p := range d.paginas {
+        objeto(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+            "/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+            LarguraA4, AlturaA4, 6+i*2))
+        objeto(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+    }
+
+    xref := out.Len()
+    fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+    for _, off := range offsets {
+        fmt.Fprintf(&out, "%010d 00000 n \n", off)
+    }
+    fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+    return out.WriteTo(w)
+}
+
+// escapar converte o texto para WinAnsi e escapa os caracteres especiais do PDF
+func escapar(s string) string {
+    codificado, err := charmap.Windows1252.NewEncoder().String(s)
+    if err != nil {
+        // Caracteres fora do WinAnsi são substituídos individualmente
+        var b strings.Builder
+        for _, r := range s {
+            if c, err := charmap.Windows1252.NewEncoder().String(string(r)); err == nil {
+                b.WriteString(c)
+            } else {
+                b.WriteByte('?')
+            }
+        }
+        codificado = b.String()
+    }
+
+    r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", "", "\n", " ")
+    return r.Replace(codificado)
+}
@@ -0,0 +1,61 @@
+package pdf
+
+import "golang.org/x/text/unicode/norm"
+
+// Larguras dos caracteres ASCII 32 a 126 das fontes Helvetica e
+// Helvetica-Bold, em milésimos do tamanho da fonte (métricas AFM padrão)
+var larguraHelvetica = [95]int{
+    278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+    556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+    1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+    667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+    333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+    556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var larguraHelveticaNegrito = [95]int{
+    278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+    556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+    975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+    667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+    333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+    611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// LarguraTexto calcula a largura de s em pontos. Letras acentuadas usam a
+// largura da letra base, o que é exato para as fontes Helvetica.
+func LarguraTexto(s string, tamanho float64, negrito bool) float64 {
+    tabela := &larguraHelvetica
+    if negrito {
+        tabela = &larguraHelveticaNegrito
+    }
+
+    total := 0
+    for _, r := range norm.NFD.String(s) {
+        switch {
+        case r >= 32 && r <= 126:
+            total += tabela[r-32]
+        case r >= 0x300 && r <= 0x36f:
+            // Diacrítico combinante, já contabilizado na letra base
+        default:
+            total += 556
+        }
+    }
+    return float64(total) * tamanho / 1000
+}
+
+// Truncar corta s com reticências para que caiba na largura informada
+func Truncar(s string, largura, tamanho float64, negrito bool) string {
+    if LarguraTexto(s, tamanho, negrito) <= largura {
+        return s
+    }
+    runas := []rune(s)
+    for len(runas) > 0 {
+        runas = runas[:len(runas)-1]
+        candidato := string(runas) + "..."
+        if LarguraTexto(candidato, tamanho, negrito) <= largura {
+            return candidato
+        }
+    }
+    return ""
+}
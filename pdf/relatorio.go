@@ -0,0 +1,192 @@
+package pdf
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "strings"
+    "time"
+)
+
+const (
+    margem         = 40.0
+    alturaLinha    = 14.0
+    tamanhoFonte   = 9.0
+    limiteInferior = AlturaA4 - margem - 20
+)
+
+// Coluna define uma coluna da tabela do relatório. Largura é um peso
+// relativo: as larguras são distribuídas proporcionalmente na página.
+type Coluna struct {
+    Titulo  string
+    Largura float64
+    Direita bool
+}
+
+// Relatorio monta um relatório tabular paginado com cabeçalho da empresa,
+// data de geração, filtros aplicados, subtotais e totais
+type Relatorio struct {
+    Empresa  string
+    Titulo   string
+    GeradoEm time.Time
+    Filtros  []string
+
+    colunas  []Coluna
+    larguras []float64
+    doc      *Documento
+    y        float64
+}
+
+// NovoRelatorio cria o relatório e desenha a primeira página
+func NovoRelatorio(empresa, titulo string, filtros []string, colunas []Coluna) *Relatorio {
+    r := &Relatorio{
+        Empresa:  empresa,
+        Titulo:   titulo,
+        GeradoEm: time.Now(),
+        Filtros:  filtros,
+        colunas:  colunas,
+        doc:      Novo(),
+    }
+
+    pesoTotal := 0.0
+    for _, c := range colunas {
+        pesoTotal += c.Largura
+    }
+    util := LarguraA4 - 2*margem
+    for _, c := range colunas {
+        r.larguras = append(r.larguras, util*c.Largura/pesoTotal)
+    }
+
+    r.novaPagina()
+    return r
+}
+
+func (r *Relatorio) novaPagina() {
+    r.doc.NovaPagina()
+    r.y = margem
+
+    if r.doc.TotalPaginas() == 1 {
+        r.doc.Texto(margem, r.y+14, 14, true, r.Empresa)
+        r.doc.Texto(margem, r.y+32, 12, true, r.Titulo)
+        r.doc.Texto(margem, r.y+48, tamanhoFonte, false, "Gerado em "+r.GeradoEm.Format("02/01/2006 15:04:05"))
+
+        filtros := "Filtros: nenhum"
+        if len(r.Filtros) > 0 {
+            filtros = "Filtros: " + strings.Join(r.Filtros, "; ")
+        }
+        r.doc.Texto(margem, r.y+62, tamanhoFonte, false, Truncar(filtros, LarguraA4-2*margem, tamanhoFonte, false))
+        r.y += 72
+    } else {
+        r.doc.Texto(margem, r.y+10, tamanhoFonte, true, r.Empresa+" - "+r.Titulo)
+        r.y += 18
+    }
+
+    r.doc.Linha(margem, r.y, LarguraA4-margem, r.y, 1)
+    r.y += 4
+    r.doc.Retangulo(margem, r.y, LarguraA4-2*margem, alturaLinha, 0.85)
+    titulos := make([]string, len(r.colunas))
+    for i, c := range r.colunas {
+        titulos[i] = c.Titulo
+    }
+    r.escreverCelulas(titulos, true)
+}
+
+// garantirEspaco quebra a página se não houver espaço para n linhas
+func (r *Relatorio) garantirEspaco(n int) {
+    if r.y+float64(n)*alturaLinha > limiteInferior {
+        r.novaPagina()
+    }
+}
+
+func (r *Relatorio) escreverCelulas(valores []string, negrito bool) {
+    x := margem
+    base := r.y + alturaLinha - 4
+    for i, largura := range r.larguras {
+        if i < len(valores) {
+            texto := Truncar(valores[i], largura-6, tamanhoFonte, negrito)
+            if r.colunas[i].Direita {
+                r.doc.TextoDireita(x+largura-3, base, tamanhoFonte, negrito, texto)
+            } else {
+                r.doc.Texto(x+3, base, tamanhoFonte, negrito, texto)
+            }
+        }
+        x += largura
+    }
+    r.y += alturaLinha
+}
+
+// Secao inicia um agrupamento (por exemplo, uma categoria)
+func (r *Relatorio) Secao(titulo string) {
+    r.garantirEspaco(3)
+    r.y += 4
+    r.doc.Texto(margem, r.y+alturaLinha-4, tamanhoFonte+1, true, titulo)
+    r.y += alturaLinha
+}
+
+// Linha adiciona uma linha de detalhe
+func (r *Relatorio) Linha(valores []string) {
+    r.garantirEspaco(1)
+    r.escreverCelulas(valores, false)
+}
+
+// Subtotal adiciona uma linha em negrito separada por um traço
+func (r *Relatorio) Subtotal(valores []string) {
+    r.garantirEspaco(1)
+    r.doc.Linha(margem, r.y, LarguraA4-margem, r.y, 0.5)
+    r.escreverCelulas(valores, true)
+}
+
+// Total adiciona a linha de total geral destacada
+func (r *Relatorio) Total(valores []string) {
+    r.garantirEspaco(2)
+    r.y += 6
+    r.doc.Retangulo(margem, r.y, LarguraA4-2*margem, alturaLinha, 0.85)
+    r.escreverCelulas(valores, true)
+}
+
+// WriteTo adiciona a numeração das páginas e gera o PDF
+func (r *Relatorio) WriteTo(w io.Writer) (int64, error) {
+    total := r.doc.TotalPaginas()
+    for i := 1; i <= total; i++ {
+        r.doc.Pagina(i)
+        y := AlturaA4 - margem + 10
+        r.doc.Linha(margem, y-10, LarguraA4-margem, y-10, 0.5)
+        r.doc.Texto(margem, y, 8, false, r.Titulo+" - "+r.GeradoEm.Format("02/01/2006 15:04"))
+        r.doc.TextoDireita(LarguraA4-margem, y, 8, false, fmt.Sprintf("Página %d de %d", i, total))
+    }
+    return r.doc.WriteTo(w)
+}
+
+// FormatarNumero formata v no padrão brasileiro com o número de casas decimais informado
+func FormatarNumero(v float64, casas int) string {
+    negativo := v < 0
+    v = math.Abs(v)
+
+    texto := fmt.Sprintf("%.*f", casas, v)
+    inteiro, decimal := texto, ""
+    if i := strings.IndexByte(texto, '.'); i >= 0 {
+        inteiro, decimal = texto[:i], texto[i+1:]
+    }
+
+    var b strings.Builder
+    for i, d := range inteiro {
+        if i > 0 && (len(inteiro)-i)%3 == 0 {
+            b.WriteByte('.')
+        }
+        b.WriteRune(d)
+    }
+    if decimal != "" {
+        b.WriteByte(',')
+        b.WriteString(decimal)
+    }
+
+    if negativo {
+        return "-" + b.String()
+    }
+    return b.String()
+}
+
+// FormatarMoeda formata v como valor em reais
+func FormatarMoeda(v float64) string {
+    return "R$ " + FormatarNumero(v, 2)
+}
@@ -0,0 +1,229 @@
+package planilhas
+
+import (
+    "archive/zip"
+    "bufio"
+    "encoding/csv"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Escritor grava linhas de forma incremental em um dos formatos suportados,
+// sem precisar manter todo o conteúdo em memória.
+type Escritor interface {
+    EscreverLinha(valores []interface{}) error
+    Fechar() error
+}
+
+// FormatoSuportado indica se o formato pode ser usado em NovoEscritor
+func FormatoSuportado(formato string) bool {
+    switch formato {
+    case "csv", "xlsx", "jsonl":
+        return true
+    }
+    return false
+}
+
+// ContentType retorna o MIME type correspondente ao formato
+func ContentType(formato string) string {
+    switch formato {
+    case "csv":
+        return "text/csv; charset=utf-8"
+    case "xlsx":
+        return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+    case "jsonl":
+        return "application/x-ndjson"
+    }
+    return "application/octet-stream"
+}
+
+// NovoEscritor cria um escritor para o formato informado. As colunas são
+// usadas como cabeçalho (CSV/XLSX) ou como chaves dos objetos (JSON Lines).
+func NovoEscritor(formato string, w io.Writer, colunas []string) (Escritor, error) {
+    switch formato {
+    case "csv":
+        return novoEscritorCSV(w, colunas)
+    case "xlsx":
+        return novoEscritorXLSX(w, colunas)
+    case "jsonl":
+        return &escritorJSONL{enc: json.NewEncoder(w), colunas: colunas}, nil
+    }
+    return nil, fmt.Errorf("formato não suportado: %s", formato)
+}
+
+// textoCelula converte um valor para sua representação textual
+func textoCelula(v interface{}) string {
+    switch valor := v.(type) {
+    case nil:
+        return ""
+    case string:
+        return valor
+    case float64:
+        return strconv.FormatFloat(valor, 'f', -1, 64)
+    case float32:
+        return strconv.FormatFloat(float64(valor), 'f', -1, 32)
+    case time.Time:
+        if valor.IsZero() {
+            return ""
+        }
+        return valor.Format(time.RFC3339)
+    case []string:
+        return strings.Join(valor, "|")
+    }
+    return fmt.Sprint(v)
+}
+
+// Caracteres que, no início de uma célula de CSV, fazem as planilhas
+// interpretarem o texto como fórmula
+const inicioFormula = "=+-@\t\r"
+
+// protegerFormula prefixa com apóstrofo os textos que seriam lidos como
+// fórmula ao abrir o CSV em uma planilha. Só textos são alterados: números
+// negativos continuam números. No XLSX não é necessário, pois as células de
+// texto (inlineStr) nunca são avaliadas.
+func protegerFormula(texto string) string {
+    if texto != "" && strings.ContainsRune(inicioFormula, rune(texto[0])) {
+        return "'" + texto
+    }
+    return texto
+}
+
+type escritorCSV struct {
+    w *csv.Writer
+}
+
+func novoEscritorCSV(w io.Writer, colunas []string) (*escritorCSV, error) {
+    e := &escritorCSV{w: csv.NewWriter(w)}
+    if err := e.w.Write(colunas); err != nil {
+        return nil, err
+    }
+    return e, nil
+}
+
+func (e *escritorCSV) EscreverLinha(valores []interface{}) error {
+    registro := make([]string, len(valores))
+    for i, v := range valores {
+        registro[i] = textoCelula(v)
+        switch v.(type) {
+        case string, []string:
+            registro[i] = protegerFormula(registro[i])
+        }
+    }
+    return e.w.Write(registro)
+}
+
+func (e *escritorCSV) Fechar() error {
+    e.w.Flush()
+    return e.w.Error()
+}
+
+type escritorJSONL struct {
+    enc     *json.Encoder
+    colunas []string
+}
+
+func (e *escritorJSONL) EscreverLinha(valores []interface{}) error {
+    objeto := make(map[string]interface{}, len(e.colunas))
+    for i, coluna := range e.colunas {
+        if i < len(valores) {
+            objeto[coluna] = valores[i]
+        }
+    }
+    return e.enc.Encode(objeto)
+}
+
+func (e *escritorJSONL) Fechar() error {
+    return nil
+}
+
+// escritorXLSX gera um arquivo XLSX mínimo com uma única aba, usando
+// inline strings para que as linhas possam ser gravadas à medida que chegam.
+type escritorXLSX struct {
+    zip   *zip.Writer
+    sheet *bufio.Writer
+    linha int
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Dados" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+func novoEscritorXLSX(w io.Writer, colunas []string) (*escritorXLSX, error) {
+    z := zip.NewWriter(w)
+    fixos := []struct{ nome, conteudo string }{
+        {"[Content_Types].xml", xlsxContentTypes},
+        {"_rels/.rels", xlsxRels},
+        {"xl/workbook.xml", xlsxWorkbookXML},
+        {"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+    }
+    for _, f := range fixos {
+        fw, err := z.Create(f.nome)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := io.WriteString(fw, f.conteudo); err != nil {
+            return nil, err
+        }
+    }
+
+    // A aba precisa ser a última entrada, pois o zip só permite uma escrita aberta por vez
+    fw, err := z.Create("xl/worksheets/sheet1.xml")
+    if err != nil {
+        return nil, err
+    }
+
+    e := &escritorXLSX{zip: z, sheet: bufio.NewWriter(fw)}
+    e.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+    e.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+    cabecalho := make([]interface{}, len(colunas))
+    for i, c := range colunas {
+        cabecalho[i] = c
+    }
+    if err := e.EscreverLinha(cabecalho); err != nil {
+        return nil, err
+    }
+    return e, nil
+}
+
+func (e *escritorXLSX) EscreverLinha(valores []interface{}) error {
+    e.linha++
+    fmt.Fprintf(e.sheet, `<row r="%d">`, e.linha)
+    for _, v := range valores {
+        switch v.(type) {
+        case int, int32, int64, float32, float64:
+            fmt.Fprintf(e.sheet, `<c><v>%s</v></c>`, textoCelula(v))
+        case nil:
+            e.sheet.WriteString(`<c/>`)
+        default:
+            e.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+            if err := xml.EscapeText(e.sheet, []byte(textoCelula(v))); err != nil {
+                return err
+            }
+            e.sheet.WriteString(`</t></is></c>`)
+        }
+    }
+    _, err := e.sheet.WriteString(`</row>`)
+    return err
+}
+
+func (e *escritorXLSX) Fechar() error {
+    e.sheet.WriteString(`</sheetData></worksheet>`)
+    if err := e.sheet.Flush(); err != nil {
+        return err
+    }
+    return e.zip.Close()
+}
@@ -0,0 +1,75 @@
+package planilhas
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestCSVProtegeFormulas(t *testing.T) {
+    var buf bytes.Buffer
+    e, err := NovoEscritor("csv", &buf, []string{"nome", "tags", "preco", "obs"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    linhas := [][]interface{}{
+        {"=HYPERLINK(\"http://x\")", []string{"+a", "b"}, -5.5, "@SOMA(A1)"},
+        {"-promo", nil, 10.0, "\tcom tab"},
+        {"normal", []string{"a"}, 0.0, "a=b"},
+    }
+    for _, l := range linhas {
+        if err := e.EscreverLinha(l); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := e.Fechar(); err != nil {
+        t.Fatal(err)
+    }
+
+    esperado := "nome,tags,preco,obs\n" +
+        "\"'=HYPERLINK(\"\"http://x\"\")\",'+a|b,-5.5,'@SOMA(A1)\n" +
+        "'-promo,,10,'\tcom tab\n" +
+        "normal,a,0,a=b\n"
+    if buf.String() != esperado {
+        t.Errorf("csv =\n%q\nesperado\n%q", buf.String(), esperado)
+    }
+
+    // O apóstrofo é removido na leitura, e a exportação volta a ser importável
+    lidas, err := LerCSV(strings.NewReader(buf.String()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if lidas[1][0] != "=HYPERLINK(\"http://x\")" || lidas[1][1] != "+a|b" || lidas[1][2] != "-5.5" || lidas[2][0] != "-promo" {
+        t.Errorf("lido = %q", lidas)
+    }
+}
+
+func TestLerCSVMantemApostrofoComum(t *testing.T) {
+    lidas, err := LerCSV(strings.NewReader("nome\n'aspas'\n'\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if lidas[1][0] != "'aspas'" || lidas[2][0] != "'" {
+        t.Errorf("lido = %q", lidas)
+    }
+}
+
+func TestXLSXNaoAlteraTexto(t *testing.T) {
+    var buf bytes.Buffer
+    e, err := NovoEscritor("xlsx", &buf, []string{"nome"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    e.EscreverLinha([]interface{}{"=1+1"})
+    if err := e.Fechar(); err != nil {
+        t.Fatal(err)
+    }
+
+    lidas, err := LerXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(lidas) != 2 || lidas[1][0] != "=1+1" {
+        t.Errorf("lido = %q", lidas)
+    }
+}
@@ -0,0 +1,205 @@
+package planilhas
+
+import (
+    "archive/zip"
+    "bufio"
+    "encoding/csv"
+    "encoding/xml"
+    "errors"
+    "io"
+    "path"
+    "strconv"
+    "strings"
+)
+
+// LerCSV lê todas as linhas de um arquivo CSV. O separador (vírgula ou
+// ponto e vírgula) é detectado a partir da primeira linha. O apóstrofo que
+// a exportação acrescenta antes de possíveis fórmulas é removido, para que
+// um arquivo exportado possa ser importado de volta.
+func LerCSV(r io.Reader) ([][]string, error) {
+    br := bufio.NewReader(r)
+
+    // Remove o BOM que o Excel adiciona ao exportar CSV em UTF-8
+    if bom, err := br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+        br.Discard(3)
+    }
+
+    separador := ','
+    // Peek retorna os bytes disponíveis mesmo quando o arquivo é menor que o buffer
+    inicio, _ := br.Peek(4096)
+    linha := string(inicio)
+    if i := strings.IndexByte(linha, '\n'); i >= 0 {
+        linha = linha[:i]
+    }
+    if strings.Count(linha, ";") > strings.Count(linha, ",") {
+        separador = ';'
+    }
+
+    leitor := csv.NewReader(br)
+    leitor.Comma = separador
+    leitor.FieldsPerRecord = -1
+    leitor.TrimLeadingSpace = true
+    linhas, err := leitor.ReadAll()
+    for _, linha := range linhas {
+        for i, celula := range linha {
+            if len(celula) > 1 && celula[0] == '\'' && protegerFormula(celula[1:]) == celula {
+                linha[i] = celula[1:]
+            }
+        }
+    }
+    return linhas, err
+}
+
+// Estruturas mínimas do formato SpreadsheetML usadas na leitura
+type xlsxSharedStrings struct {
+    Itens []xlsxTexto `xml:"si"`
+}
+
+type xlsxTexto struct {
+    T    string `xml:"t"`
+    Runs []struct {
+        T string `xml:"t"`
+    } `xml:"r"`
+}
+
+func (t xlsxTexto) String() string {
+    if len(t.Runs) == 0 {
+        return t.T
+    }
+    var b strings.Builder
+    for _, r := range t.Runs {
+        b.WriteString(r.T)
+    }
+    return b.String()
+}
+
+type xlsxWorkbook struct {
+    Sheets []struct {
+        RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+    } `xml:"sheets>sheet"`
+}
+
+type xlsxRelacionamentos struct {
+    Itens []struct {
+        ID     string `xml:"Id,attr"`
+        Target string `xml:"Target,attr"`
+    } `xml:"Relationship"`
+}
+
+type xlsxPlanilha struct {
+    Linhas []struct {
+        Celulas []struct {
+            Ref    string    `xml:"r,attr"`
+            Tipo   string    `xml:"t,attr"`
+            Valor  string    `xml:"v"`
+            Inline xlsxTexto `xml:"is"`
+        } `xml:"c"`
+    } `xml:"sheetData>row"`
+}
+
+// LerXLSX lê as linhas da primeira planilha de um arquivo XLSX
+func LerXLSX(r io.ReaderAt, tamanho int64) ([][]string, error) {
+    arquivo, err := zip.NewReader(r, tamanho)
+    if err != nil {
+        return nil, errors.New("arquivo XLSX inválido")
+    }
+
+    arquivos := make(map[string]*zip.File, len(arquivo.File))
+    for _, f := range arquivo.File {
+        arquivos[f.Name] = f
+    }
+
+    var compartilhadas xlsxSharedStrings
+    if f, ok := arquivos["xl/sharedStrings.xml"]; ok {
+        if err := decodificarXML(f, &compartilhadas); err != nil {
+            return nil, err
+        }
+    }
+
+    caminho, err := primeiraPlanilha(arquivos)
+    if err != nil {
+        return nil, err
+    }
+
+    var planilha xlsxPlanilha
+    if err := decodificarXML(arquivos[caminho], &planilha); err != nil {
+        return nil, err
+    }
+
+    linhas := make([][]string, 0, len(planilha.Linhas))
+    for _, l := range planilha.Linhas {
+        var linha []string
+        for i, c := range l.Celulas {
+            coluna := i
+            if c.Ref != "" {
+                coluna = indiceColuna(c.Ref)
+            }
+            for len(linha) <= coluna {
+                linha = append(linha, "")
+            }
+
+            switch c.Tipo {
+            case "s":
+                idx, err := strconv.Atoi(c.Valor)
+                if err == nil && idx >= 0 && idx < len(compartilhadas.Itens) {
+                    linha[coluna] = compartilhadas.Itens[idx].String()
+                }
+            case "inlineStr":
+                linha[coluna] = c.Inline.String()
+            default:
+                linha[coluna] = c.Valor
+            }
+        }
+        linhas = append(linhas, linha)
+    }
+
+    return linhas, nil
+}
+
+// primeiraPlanilha resolve o caminho da primeira aba declarada no workbook
+func primeiraPlanilha(arquivos map[string]*zip.File) (string, error) {
+    var workbook xlsxWorkbook
+    var rels xlsxRelacionamentos
+    wb, okWb := arquivos["xl/workbook.xml"]
+    rel, okRel := arquivos["xl/_rels/workbook.xml.rels"]
+    if okWb && okRel && decodificarXML(wb, &workbook) == nil && decodificarXML(rel, &rels) == nil && len(workbook.Sheets) > 0 {
+        for _, r := range rels.Itens {
+            if r.ID != workbook.Sheets[0].RID {
+                continue
+            }
+            alvo := strings.TrimPrefix(r.Target, "/")
+            if !strings.HasPrefix(alvo, "xl/") {
+                alvo = path.Join("xl", alvo)
+            }
+            if _, ok := arquivos[alvo]; ok {
+                return alvo, nil
+            }
+        }
+    }
+
+    if _, ok := arquivos["xl/worksheets/sheet1.xml"]; ok {
+        return "xl/worksheets/sheet1.xml", nil
+    }
+    return "", errors.New("nenhuma planilha encontrada no arquivo XLSX")
+}
+
+func decodificarXML(f *zip.File, destino interface{}) error {
+    rc, err := f.Open()
+    if err != nil {
+        return err
+    }
+    defer rc.Close()
+    return xml.NewDecoder(rc).Decode(destino)
+}
+
+// indiceColuna converte uma referência como "C12" no índice de coluna 2
+func indiceColuna(ref string) int {
+    coluna := 0
+    for _, ch := range ref {
+        if ch < 'A' || ch > 'Z' {
+            break
+        }
+        coluna = coluna*26 + int(ch-'A'+1)
+    }
+    return coluna - 1
+}
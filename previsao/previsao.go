@@ -0,0 +1,215 @@
+// Package previsao estima a demanda futura a partir de uma série histórica
+// de consumo por período (por exemplo, saídas semanais de um produto).
+package previsao
+
+import "math"
+
+const (
+    // Janela padrão da média móvel, em períodos
+    JanelaMediaMovel = 4
+    // Constante de suavização padrão da suavização exponencial simples
+    Alfa = 0.3
+)
+
+// Resultado é a previsão escolhida para uma série
+type Resultado struct {
+    Metodo       string    `json:"metodo"` // sem_historico, media_movel, suavizacao_exponencial, sazonal
+    Previsoes    []float64 `json:"previsoes"`
+    ErroMedio    float64   `json:"erro_medio"`
+    DesvioPadrao float64   `json:"desvio_padrao"`
+}
+
+// Total soma a demanda prevista em todo o horizonte
+func (r Resultado) Total() float64 {
+    total := 0.0
+    for _, p := range r.Previsoes {
+        total += p
+    }
+    return total
+}
+
+// EstoqueSeguranca é o estoque que cobre a variação da demanda durante
+// periodos períodos: fator (por exemplo 1,65 para ~95% de atendimento) vezes
+// o desvio padrão por período, escalado pela raiz do número de períodos
+func EstoqueSeguranca(fator, desvioPadrao, periodos float64) float64 {
+    if fator <= 0 || desvioPadrao <= 0 || periodos <= 0 {
+        return 0
+    }
+    return fator * desvioPadrao * math.Sqrt(periodos)
+}
+
+// modelo guarda as previsões um passo à frente dentro da amostra (ajustes[t]
+// é a previsão para serie[t], NaN quando não há dados suficientes) e a
+// função que projeta os períodos futuros
+type modelo struct {
+    metodo  string
+    ajustes []float64
+    prever  func(h int) float64
+}
+
+// Prever ajusta média móvel, suavização exponencial e, quando houver ao menos
+// dois ciclos completos de periodoSazonal, um modelo sazonal multiplicativo.
+// O modelo com menor erro absoluto médio dentro da amostra é usado para
+// projetar os próximos horizonte períodos.
+func Prever(serie []float64, periodoSazonal, horizonte int) Resultado {
+    if len(serie) == 0 || soma(serie) == 0 {
+        return Resultado{Metodo: "sem_historico", Previsoes: make([]float64, horizonte)}
+    }
+
+    candidatos := []modelo{
+        mediaMovel(serie, JanelaMediaMovel),
+        suavizacaoExponencial(serie, Alfa),
+    }
+    if periodoSazonal > 1 && len(serie) >= 2*periodoSazonal {
+        candidatos = append(candidatos, sazonal(serie, periodoSazonal, Alfa))
+    }
+
+    // Todos os modelos são comparados sobre os mesmos períodos
+    inicio := JanelaMediaMovel
+    if inicio >= len(serie) {
+        inicio = 1
+    }
+
+    // Com histórico curto demais para avaliação, fica a média móvel
+    melhor := candidatos[0]
+    melhorErro, melhorDesvio := math.Inf(1), 0.0
+    for _, m := range candidatos {
+        erro, desvio := avaliar(serie, m.ajustes, inicio)
+        if erro < melhorErro {
+            melhor, melhorErro, melhorDesvio = m, erro, desvio
+        }
+    }
+
+    previsoes := make([]float64, horizonte)
+    for h := range previsoes {
+        previsoes[h] = math.Max(0, melhor.prever(h+1))
+    }
+
+    if math.IsInf(melhorErro, 1) {
+        melhorErro = 0
+    }
+    return Resultado{Metodo: melhor.metodo, Previsoes: previsoes, ErroMedio: melhorErro, DesvioPadrao: melhorDesvio}
+}
+
+// avaliar calcula o erro absoluto médio e o desvio padrão dos erros
+func avaliar(serie, ajustes []float64, inicio int) (float64, float64) {
+    var somaAbs, somaQuad float64
+    n := 0
+    for t := inicio; t < len(serie); t++ {
+        if math.IsNaN(ajustes[t]) {
+            continue
+        }
+        e := serie[t] - ajustes[t]
+        somaAbs += math.Abs(e)
+        somaQuad += e * e
+        n++
+    }
+    if n == 0 {
+        return math.Inf(1), 0
+    }
+    return somaAbs / float64(n), math.Sqrt(somaQuad / float64(n))
+}
+
+func mediaMovel(serie []float64, janela int) modelo {
+    if janela > len(serie) {
+        janela = len(serie)
+    }
+
+    ajustes := make([]float64, len(serie))
+    for t := range serie {
+        if t < janela {
+            ajustes[t] = math.NaN()
+            continue
+        }
+        ajustes[t] = soma(serie[t-janela:t]) / float64(janela)
+    }
+
+    proxima := soma(serie[len(serie)-janela:]) / float64(janela)
+    return modelo{
+        metodo:  "media_movel",
+        ajustes: ajustes,
+        prever:  func(int) float64 { return proxima },
+    }
+}
+
+func suavizacaoExponencial(serie []float64, alfa float64) modelo {
+    ajustes := make([]float64, len(serie))
+    nivel := serie[0]
+    ajustes[0] = math.NaN()
+    for t := 1; t < len(serie); t++ {
+        ajustes[t] = nivel
+        nivel = alfa*serie[t] + (1-alfa)*nivel
+    }
+
+    return modelo{
+        metodo:  "suavizacao_exponencial",
+        ajustes: ajustes,
+        prever:  func(int) float64 { return nivel },
+    }
+}
+
+// sazonal calcula índices sazonais multiplicativos pela média de cada posição
+// do ciclo em relação à média do seu ciclo, dessazonaliza a série e aplica a
+// suavização exponencial ao resultado
+func sazonal(serie []float64, periodo int, alfa float64) modelo {
+    ciclos := len(serie) / periodo
+    // Usa apenas ciclos completos, alinhados ao final da série
+    deslocamento := len(serie) - ciclos*periodo
+
+    indices := make([]float64, periodo)
+    contagem := make([]int, periodo)
+    for c := 0; c < ciclos; c++ {
+        ciclo := serie[deslocamento+c*periodo : deslocamento+(c+1)*periodo]
+        media := soma(ciclo) / float64(periodo)
+        if media == 0 {
+            continue
+        }
+        for k, v := range ciclo {
+            indices[k] += v / media
+            contagem[k]++
+        }
+    }
+
+    somaIndices := 0.0
+    for k := range indices {
+        if contagem[k] > 0 {
+            indices[k] /= float64(contagem[k])
+        } else {
+            indices[k] = 1
+        }
+        somaIndices += indices[k]
+    }
+    // Normaliza para que a média dos índices seja 1
+    for k := range indices {
+        indices[k] *= float64(periodo) / somaIndices
+    }
+
+    indice := func(t int) float64 {
+        k := ((t-deslocamento)%periodo + periodo) % periodo
+        // Piso para evitar divisão por zero em posições sem nenhum consumo
+        return math.Max(indices[k], 0.01)
+    }
+
+    ajustes := make([]float64, len(serie))
+    nivel := serie[0] / indice(0)
+    ajustes[0] = math.NaN()
+    for t := 1; t < len(serie); t++ {
+        ajustes[t] = nivel * indice(t)
+        nivel = alfa*(serie[t]/indice(t)) + (1-alfa)*nivel
+    }
+
+    n := len(serie)
+    return modelo{
+        metodo:  "sazonal",
+        ajustes: ajustes,
+        prever:  func(h int) float64 { return nivel * indice(n-1+h) },
+    }
+}
+
+func soma(valores []float64) float64 {
+    total := 0.0
+    for _, v := range valores {
+        total += v
+    }
+    return total
+}
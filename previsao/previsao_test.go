@@ -0,0 +1,168 @@
+package previsao
+
+import (
+    "math"
+    "testing"
+)
+
+const tolerancia = 1e-9
+
+func quase(a, b float64) bool {
+    return math.Abs(a-b) < tolerancia
+}
+
+func TestPrever(t *testing.T) {
+    casos := []struct {
+        nome      string
+        serie     []float64
+        periodo   int
+        horizonte int
+        metodo    string
+        previsoes []float64
+        erro      float64
+        desvio    float64
+    }{
+        {
+            nome:      "sem dados",
+            serie:     nil,
+            horizonte: 3,
+            metodo:    "sem_historico",
+            previsoes: []float64{0, 0, 0},
+        },
+        {
+            nome:      "só zeros",
+            serie:     []float64{0, 0, 0, 0, 0},
+            horizonte: 2,
+            metodo:    "sem_historico",
+            previsoes: []float64{0, 0},
+        },
+        {
+            nome:      "histórico curto demais para avaliar fica na média móvel",
+            serie:     []float64{3},
+            horizonte: 2,
+            metodo:    "media_movel",
+            previsoes: []float64{3, 3},
+        },
+        {
+            // Empate sem erro: vence o primeiro candidato
+            nome:      "demanda constante",
+            serie:     []float64{5, 5, 5, 5, 5, 5, 5, 5},
+            horizonte: 2,
+            metodo:    "media_movel",
+            previsoes: []float64{5, 5},
+        },
+        {
+            // Erros da média móvel a partir do período 4: 10; 7,5; 5; 2,5.
+            // A suavização erra 10; 7; 4,9; 3,43 e perde.
+            nome:      "mudança de patamar",
+            serie:     []float64{10, 10, 10, 10, 20, 20, 20, 20},
+            horizonte: 1,
+            metodo:    "media_movel",
+            previsoes: []float64{20},
+            erro:      6.25,
+            desvio:    math.Sqrt((100 + 56.25 + 25 + 6.25) / 4),
+        },
+        {
+            // Depois de um pico isolado a suavização converge mais rápido
+            // que a janela de 4 períodos: erros 0; 20; 6; 4,2; 2,94; 2,058
+            nome:      "pico isolado",
+            serie:     []float64{10, 10, 10, 10, 10, 30, 10, 10, 10, 10},
+            horizonte: 2,
+            metodo:    "suavizacao_exponencial",
+            previsoes: []float64{11.4406, 11.4406},
+            erro:      (20 + 6 + 4.2 + 2.94 + 2.058) / 6,
+            desvio:    math.Sqrt((400 + 36 + 4.2*4.2 + 2.94*2.94 + 2.058*2.058) / 6),
+        },
+        {
+            // Dois ciclos completos com o mesmo perfil: índices 0,4; 0,8;
+            // 1,2 e 1,6 sobre o nível 25, sem erro
+            nome:      "sazonalidade",
+            serie:     []float64{10, 20, 30, 40, 10, 20, 30, 40},
+            periodo:   4,
+            horizonte: 5,
+            metodo:    "sazonal",
+            previsoes: []float64{10, 20, 30, 40, 10},
+        },
+        {
+            // Sem o segundo ciclo completo o modelo sazonal não concorre. A
+            // média móvel erra 15; 5; 5 e a suavização 14,67; 0,269; 9,8117.
+            nome:      "sazonalidade exige dois ciclos",
+            serie:     []float64{10, 20, 30, 40, 10, 20, 30},
+            periodo:   4,
+            horizonte: 1,
+            metodo:    "suavizacao_exponencial",
+            previsoes: []float64{23.13181},
+            erro:      (14.67 + 0.269 + 9.8117) / 3,
+            desvio:    math.Sqrt((14.67*14.67 + 0.269*0.269 + 9.8117*9.8117) / 3),
+        },
+    }
+
+    for _, caso := range casos {
+        t.Run(caso.nome, func(t *testing.T) {
+            r := Prever(caso.serie, caso.periodo, caso.horizonte)
+            if r.Metodo != caso.metodo {
+                t.Fatalf("método = %s, esperado %s", r.Metodo, caso.metodo)
+            }
+            if len(r.Previsoes) != len(caso.previsoes) {
+                t.Fatalf("previsões = %v, esperado %v", r.Previsoes, caso.previsoes)
+            }
+            for i := range r.Previsoes {
+                if !quase(r.Previsoes[i], caso.previsoes[i]) {
+                    t.Errorf("previsões = %v, esperado %v", r.Previsoes, caso.previsoes)
+                    break
+                }
+            }
+            if !quase(r.ErroMedio, caso.erro) {
+                t.Errorf("erro médio = %v, esperado %v", r.ErroMedio, caso.erro)
+            }
+            if !quase(r.DesvioPadrao, caso.desvio) {
+                t.Errorf("desvio padrão = %v, esperado %v", r.DesvioPadrao, caso.desvio)
+            }
+        })
+    }
+}
+
+func TestPreverNuncaNegativo(t *testing.T) {
+    // Ciclo com queda a zero: o modelo sazonal não projeta demanda negativa
+    serie := []float64{0, 0, 50, 100, 0, 0, 60, 120, 0, 0, 70, 140}
+    for _, p := range Prever(serie, 4, 8).Previsoes {
+        if p < 0 {
+            t.Fatalf("previsão negativa: %v", p)
+        }
+    }
+}
+
+func TestResultadoTotal(t *testing.T) {
+    r := Resultado{Previsoes: []float64{1.5, 2, 3.25}}
+    if total := r.Total(); !quase(total, 6.75) {
+        t.Errorf("Total() = %v, esperado 6.75", total)
+    }
+    if total := (Resultado{}).Total(); total != 0 {
+        t.Errorf("Total() sem previsões = %v", total)
+    }
+}
+
+func TestEstoqueSeguranca(t *testing.T) {
+    casos := []struct {
+        nome     string
+        fator    float64
+        desvio   float64
+        periodos float64
+        esperado float64
+    }{
+        {"um período", 1.65, 10, 1, 16.5},
+        {"escala pela raiz dos períodos", 1.65, 10, 4, 33},
+        {"prazo fracionado", 2, 3, 2.25, 9},
+        {"sem variação", 1.65, 0, 4, 0},
+        {"fator zero", 0, 10, 4, 0},
+        {"sem períodos", 1.65, 10, 0, 0},
+        {"valores negativos são ignorados", -1, 10, 4, 0},
+    }
+    for _, caso := range casos {
+        t.Run(caso.nome, func(t *testing.T) {
+            if v := EstoqueSeguranca(caso.fator, caso.desvio, caso.periodos); !quase(v, caso.esperado) {
+                t.Errorf("EstoqueSeguranca(%v, %v, %v) = %v, esperado %v", caso.fator, caso.desvio, caso.periodos, v, caso.esperado)
+            }
+        })
+    }
+}